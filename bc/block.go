@@ -3,24 +3,36 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
+var ErrNoCoinbase = errors.New("block has no coinbase transaction")
+
+// witnessCommitmentHeader prefixes the coinbase data output committing to
+// the witnesses of the block transactions
+var witnessCommitmentHeader = []byte{0xaa, 0x21, 0xa9, 0xed}
+
 // Block keeps block information
 type Block struct {
 	Timestamp     int64          // the block creation timestamp
 	Transactions  []*Transaction // The block transactions
 	PrevBlockHash []byte         // the hash of the previous block
-	Hash          []byte         // the hash of the block
+	MerkleRoot    []byte         // the merkle root of the transactions
+	Difficulty    int64          // the difficulty set by the consensus engine
+	Hash          []byte         // the hash of the block header
 	Nonce         int            // the nonce of the block
+	Seal          []byte         // the seal of the consensus engine not covered by the hash, e.g. a signature
 }
 
 // NewBlock creates and returns a non-mined Block
 func NewBlock(timestamp int64, transactions []*Transaction, prevBlockHash []byte) *Block {
 	gob.Register(&Transaction{})
-	return &Block{timestamp, transactions, prevBlockHash, nil, 0}
+	b := &Block{Timestamp: timestamp, Transactions: transactions, PrevBlockHash: prevBlockHash}
+	b.updateMerkleRoot()
+	return b
 }
 
 // NewGenesisBlock creates and returns genesis Block
@@ -28,28 +40,130 @@ func NewGenesisBlock(timestamp int64, tx *Transaction) *Block {
 	return NewBlock(timestamp, []*Transaction{tx}, nil)
 }
 
-// Mine calculates and sets the block hash and nonce.
-func (b *Block) Mine() {
+// Header returns the header of the block
+func (b *Block) Header() BlockHeader {
+	h := BlockHeader{Timestamp: b.Timestamp, Difficulty: b.Difficulty, Nonce: int64(b.Nonce)}
+	copy(h.PrevBlockHash[:], b.PrevBlockHash)
+	copy(h.MerkleRoot[:], b.MerkleRoot)
+	return h
+}
+
+// updateMerkleRoot stores the merkle root of the transactions, it must be
+// called whenever they change
+func (b *Block) updateMerkleRoot() {
+	b.MerkleRoot = nil
+	if len(b.Transactions) > 0 {
+		b.MerkleRoot = b.HashTransactions()
+	}
+}
+
+// Mine calculates and sets the block hash and nonce with a proof-of-work.
+// The merkle root and the difficulty are set first when missing. It fails
+// when every nonce was tried, see Miner to roll an extra nonce.
+func (b *Block) Mine() error {
+	if b.MerkleRoot == nil {
+		b.updateMerkleRoot()
+	}
+	if b.Difficulty == 0 {
+		b.Difficulty = ActiveChainParams.PowAlgorithm.TargetBits()
+	}
 	pow := NewProofOfWork(b)
-	nonce, blockHash := pow.Run()
+	nonce, blockHash, err := pow.Run()
+	if err != nil {
+		return err
+	}
 	b.Nonce = nonce
 	b.Hash = blockHash
+	return nil
 }
 
 // HashTransactions returns a hash of the transactions in the block
-// This function iterates over all transactions in a block, serialize them
-// and make a merkle tree of it.
-// It return the merkle root hash.
+// This function iterates over all transactions in a block, hash their body
+// without the witness and make a merkle tree of it.
+// It return the merkle root hash. The witnesses are committed by the
+// WitnessRoot in the coinbase.
 func (b *Block) HashTransactions() []byte {
-	var serializedTxn [][]byte
+	var txids [][]byte
 	for _, t := range b.Transactions {
-		h := t.Serialize()
-		serializedTxn = append(serializedTxn, h)
+		txids = append(txids, t.Hash())
 	}
-	mrklTree := NewMerkleTree(serializedTxn)
+	mrklTree := NewMerkleTree(txids)
 	return mrklTree.MerkleRootHash()
 }
 
+// WitnessRoot returns the merkle root of the witness hashes of the block transactions
+func (b *Block) WitnessRoot() []byte {
+	var wtxids [][]byte
+	for _, t := range b.Transactions {
+		wtxids = append(wtxids, t.WitnessHash())
+	}
+	return NewMerkleTree(wtxids).MerkleRootHash()
+}
+
+// HasWitness checks whether any transaction of the block carries witness data
+func (b *Block) HasWitness() bool {
+	for _, t := range b.Transactions {
+		if t.HasWitness() {
+			return true
+		}
+	}
+	return false
+}
+
+// AddWitnessCommitment commits the coinbase to the witness root of the block.
+// The coinbase, the first transaction, is replaced by a copy having an extra
+// data-carrier output with the commitment, so the given one is left untouched.
+// A previous commitment is replaced, e.g. when a transaction was added since.
+// Blocks without witness data need no commitment.
+func (b *Block) AddWitnessCommitment() error {
+	if !b.HasWitness() {
+		return nil
+	}
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return ErrNoCoinbase
+	}
+	commitment, err := NewDataOutput(append(append([]byte{}, witnessCommitmentHeader...), b.WitnessRoot()...))
+	if err != nil {
+		return err
+	}
+	coinbase := *b.Transactions[0]
+	coinbase.Vout = nil
+	for _, out := range b.Transactions[0].Vout {
+		if !out.IsDataCarrier() || !bytes.HasPrefix(out.Data, witnessCommitmentHeader) {
+			coinbase.Vout = append(coinbase.Vout, out)
+		}
+	}
+	coinbase.Vout = append(coinbase.Vout, *commitment)
+	coinbase.ID = coinbase.Hash()
+	b.Transactions = append([]*Transaction{&coinbase}, b.Transactions[1:]...)
+	b.updateMerkleRoot()
+	return nil
+}
+
+// witnessCommitment returns the witness root the coinbase commits to, nil if none
+func (b *Block) witnessCommitment() []byte {
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return nil
+	}
+	var commitment []byte
+	for _, out := range b.Transactions[0].Vout {
+		if out.IsDataCarrier() && bytes.HasPrefix(out.Data, witnessCommitmentHeader) {
+			commitment = out.Data[len(witnessCommitmentHeader):]
+		}
+	}
+	return commitment
+}
+
+// ValidWitnessCommitment checks that the witnesses of the block transactions
+// are committed to by the coinbase
+func (b *Block) ValidWitnessCommitment() bool {
+	commitment := b.witnessCommitment()
+	if commitment == nil {
+		return !b.HasWitness()
+	}
+	return bytes.Equal(commitment, b.WitnessRoot())
+}
+
 // FindTransaction finds a transaction by its ID
 func (b *Block) FindTransaction(ID []byte) (*Transaction, error) {
 	for _, t := range b.Transactions {
@@ -64,7 +178,9 @@ func (b *Block) String() string {
 	var lines []string
 	lines = append(lines, fmt.Sprintf("============ Block %x ============", b.Hash))
 	lines = append(lines, fmt.Sprintf("Prev. hash: %x", b.PrevBlockHash))
+	lines = append(lines, fmt.Sprintf("Merkle root: %x", b.MerkleRoot))
 	lines = append(lines, fmt.Sprintf("Timestamp: %v", time.Unix(b.Timestamp, 0)))
+	lines = append(lines, fmt.Sprintf("Difficulty: %d", b.Difficulty))
 	lines = append(lines, fmt.Sprintf("Nonce: %d", b.Nonce))
 	lines = append(lines, fmt.Sprintf("Transactions:"))
 	for i, tx := range b.Transactions {
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"hash"
+)
+
+// BlockHeaderSize is the size in bytes of a serialized block header
+const BlockHeaderSize = 88
+
+// BlockHeader is the fixed-size part of a block the proof-of-work hashes.
+// It commits to the transactions with their merkle root.
+type BlockHeader struct {
+	PrevBlockHash [32]byte
+	MerkleRoot    [32]byte
+	Timestamp     int64
+	Difficulty    int64 // The target bits of the proof-of-work
+	Nonce         int64
+}
+
+// Serialize returns the big-endian encoding of the header fields, the nonce
+// last
+func (h *BlockHeader) Serialize() []byte {
+	header := make([]byte, 0, BlockHeaderSize)
+	header = append(header, h.PrevBlockHash[:]...)
+	header = append(header, h.MerkleRoot[:]...)
+	header = binary.BigEndian.AppendUint64(header, uint64(h.Timestamp))
+	header = binary.BigEndian.AppendUint64(header, uint64(h.Difficulty))
+	return addNonce(int(h.Nonce), header)
+}
+
+// Hash returns the double SHA-256 of the serialized header
+func (h *BlockHeader) Hash() []byte {
+	first := sha256.Sum256(h.Serialize())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// headerHasher hashes a header with different nonces, with the
+// proof-of-work algorithm of the active chain parameters. For SHA-256d, the
+// first 64 bytes of the header, a SHA-256 block, do not depend on the nonce:
+// the state of SHA-256 after them, the midstate, is computed once.
+type headerHasher struct {
+	algorithm PowAlgorithm
+	header    []byte // The header without the nonce
+	midstate  []byte
+	tail      []byte // The header after the first 64 bytes, without the nonce
+}
+
+// newHeaderHasher creates a hasher of the serialized header without its nonce
+func newHeaderHasher(header []byte) *headerHasher {
+	h := &headerHasher{algorithm: ActiveChainParams.PowAlgorithm, header: header[:len(header):len(header)]}
+	if h.algorithm != PowSHA256d {
+		return h
+	}
+	d := sha256.New()
+	d.Write(header[:sha256.BlockSize])
+	midstate, err := d.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	h.midstate, h.tail = midstate, header[sha256.BlockSize:]
+	return h
+}
+
+// hash returns the proof-of-work hash of the header with the nonce
+func (h *headerHasher) hash(nonce int) [32]byte {
+	if h.algorithm == PowScrypt {
+		// the full slice expression of header makes addNonce copy it, so
+		// that workers can hash concurrently
+		return scryptHash(addNonce(nonce, h.header))
+	}
+	d := h.resume()
+	d.Write(h.tail)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(nonce))
+	d.Write(n[:])
+	var first [32]byte
+	d.Sum(first[:0])
+	return sha256.Sum256(first[:])
+}
+
+// resume returns a SHA-256 digest in the midstate
+func (h *headerHasher) resume() hash.Hash {
+	d := sha256.New()
+	if err := d.(encoding.BinaryUnmarshaler).UnmarshalBinary(h.midstate); err != nil {
+		panic(err)
+	}
+	return d
+}
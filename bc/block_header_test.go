@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockHeader(t *testing.T) {
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "header")
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx}, make([]byte, 32))
+	block.PrevBlockHash[0] = 0xab
+	block.Nonce = 7
+	header := block.Header()
+	assert.Equal(t, block.HashTransactions(), header.MerkleRoot[:])
+
+	serialized := header.Serialize()
+	assert.Equal(t, BlockHeaderSize, len(serialized))
+	assert.Equal(t, block.PrevBlockHash, serialized[:32])
+	assert.Equal(t, block.MerkleRoot, serialized[32:64])
+	assert.Equal(t, IntToHex(7), serialized[80:])
+
+	first := sha256.Sum256(serialized)
+	second := sha256.Sum256(first[:])
+	assert.Equal(t, second[:], header.Hash())
+
+	// the midstate gives the same hashes
+	hasher := newHeaderHasher(serialized[:BlockHeaderSize-8])
+	for _, nonce := range []int{0, 7, 1 << 40} {
+		header.Nonce = int64(nonce)
+		hash := hasher.hash(nonce)
+		assert.Equal(t, header.Hash(), hash[:])
+	}
+}
+
+func TestValidatePoWSingleHash(t *testing.T) {
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "single hash")
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx}, nil)
+	block.Mine()
+	header := block.Header()
+	assert.Equal(t, header.Hash(), block.Hash)
+	assert.True(t, NewProofOfWork(block).Validate())
+
+	block.Nonce++
+	assert.False(t, NewProofOfWork(block).Validate())
+	block.Nonce--
+
+	// the proof-of-work commits to the stored merkle root only, the
+	// blockchain checks it matches the transactions
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	block = NewBlock(TestBlockTime, []*Transaction{cbTx}, bc.CurrentBlock().Hash)
+	block.Mine()
+	other, _ := NewCoinbaseTX(testAddressUser2, "other")
+	block.Transactions = []*Transaction{other}
+	assert.True(t, NewProofOfWork(block).Validate())
+	assert.ErrorIs(t, bc.ValidateBlock(block), ErrBadMerkleRoot)
+	block.updateMerkleRoot()
+	block.Mine()
+	assert.Nil(t, bc.ValidateBlock(block))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// BlockTemplate is a block ready to be solved: the miner only has to find
+// the nonce. The coinbase pays the block reward plus the fees of the
+// selected transactions.
+type BlockTemplate struct {
+	PrevBlockHash []byte
+	Height        int      // The height of the block
+	Difficulty    int64    // The difficulty set by the consensus engine
+	Target        *big.Int // The value the block hash must be below, for a proof-of-work
+	Timestamp     int64
+	CoinbaseValue int
+	Coinbase      *Transaction
+	Transactions  []BlockTemplateTx // The selected transactions, the coinbase excepted
+	MerkleRoot    []byte            // The merkle root of the coinbase and the transactions
+	LongPollID    int               // Passed to WaitChange to wait for a newer template
+}
+
+// BlockTemplateTx is a transaction selected for a block template
+type BlockTemplateTx struct {
+	Tx   *Transaction
+	Fee  int
+	Size int
+}
+
+// Block returns the unsolved block of the template
+func (t *BlockTemplate) Block() *Block {
+	txs := []*Transaction{t.Coinbase}
+	for _, tx := range t.Transactions {
+		txs = append(txs, tx.Tx)
+	}
+	block := NewBlock(t.Timestamp, txs, t.PrevBlockHash)
+	block.Difficulty = t.Difficulty
+	return block
+}
+
+// BlockAssembler builds block templates from the blockchain tip and the
+// mempool, and connects the solved blocks. It implements MempoolListener
+// to know when a new template is worth asking for.
+// As the blockchain and the mempool, it is not safe for concurrent use,
+// except WaitChange waiting for a change.
+type BlockAssembler struct {
+	bc      *Blockchain
+	mempool *Mempool
+	address string // The address the coinbase pays to
+
+	mu      sync.Mutex
+	version int           // Incremented at each change of the tip or the mempool
+	changed chan struct{} // Closed at the next change
+}
+
+// NewBlockAssembler creates a block assembler paying the coinbase of the
+// templates to address
+func NewBlockAssembler(bc *Blockchain, mp *Mempool, address string) *BlockAssembler {
+	a := &BlockAssembler{bc: bc, mempool: mp, address: address, changed: make(chan struct{})}
+	mp.AddListener(a)
+	return a
+}
+
+// Template returns a template for a block on top of the tip, with the
+// mempool transactions paying the highest fee rates
+func (a *BlockAssembler) Template() (*BlockTemplate, error) {
+	a.mu.Lock()
+	longPollID := a.version
+	a.mu.Unlock()
+
+	t := &BlockTemplate{
+		PrevBlockHash: a.bc.CurrentBlock().Hash,
+		Height:        a.bc.Height() + 1,
+		Timestamp:     time.Now().Unix(),
+		CoinbaseValue: BlockReward,
+		LongPollID:    longPollID,
+	}
+	txs := []*Transaction{nil}
+	for _, tx := range a.mempool.Select(MaxBlockSize) {
+		e, err := a.mempool.Get(tx.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Transactions = append(t.Transactions, BlockTemplateTx{Tx: tx, Fee: e.Fee, Size: e.Size})
+		t.CoinbaseValue += e.Fee
+		txs = append(txs, tx)
+	}
+	// the height makes the coinbase of each block unique
+	coinbase, err := NewCoinbaseTXWithValue(a.address, fmt.Sprintf("Reward at height %d", t.Height), t.CoinbaseValue)
+	if err != nil {
+		return nil, err
+	}
+	txs[0] = coinbase
+	block := NewBlock(t.Timestamp, txs, t.PrevBlockHash)
+	if err := block.AddWitnessCommitment(); err != nil {
+		return nil, err
+	}
+	if err := a.bc.Engine().Prepare(a.bc, block); err != nil {
+		return nil, err
+	}
+	t.Difficulty = block.Difficulty
+	t.Target = powTarget(block.Difficulty)
+	t.Coinbase = block.Transactions[0]
+	t.MerkleRoot = block.MerkleRoot
+	return t, nil
+}
+
+// WaitChange waits until the tip or the mempool changed since the
+// template of longPollID, and returns the LongPollID of the next template.
+// It returns at once when they already changed. It only signals the change:
+// the goroutine owning the blockchain and the mempool asks for the new
+// template, as the waiters may be woken while the mempool is changing.
+func (a *BlockAssembler) WaitChange(ctx context.Context, longPollID int) (int, error) {
+	a.mu.Lock()
+	version, changed := a.version, a.changed
+	a.mu.Unlock()
+	if version != longPollID {
+		return version, nil
+	}
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.version, nil
+}
+
+// SubmitBlock validates a solved block and connects it. Its transactions
+// leave the mempool.
+func (a *BlockAssembler) SubmitBlock(block *Block) error {
+	if err := a.bc.ConnectBlock(block); err != nil {
+		return err
+	}
+	a.mempool.BlockConnected(block)
+	return nil
+}
+
+// notify wakes up the calls of WaitChange
+func (a *BlockAssembler) notify() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.version++
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// TxAdded implements MempoolListener
+func (a *BlockAssembler) TxAdded(e *MempoolEntry) {
+	a.notify()
+}
+
+// TxRemoved implements MempoolListener
+func (a *BlockAssembler) TxRemoved(e *MempoolEntry) {
+	a.notify()
+}
+
+// BlockConnected implements MempoolListener
+func (a *BlockAssembler) BlockConnected(block *Block) {
+	a.notify()
+}
+
+// BlockDisconnected implements MempoolListener
+func (a *BlockAssembler) BlockDisconnected(block *Block) {
+	a.notify()
+}
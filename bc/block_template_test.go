@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockTemplate(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+	a := NewBlockAssembler(bc, mp, testAddressUser2)
+
+	tmpl, err := a.Template()
+	assert.Nil(t, err)
+	assert.Equal(t, bc.CurrentBlock().Hash, tmpl.PrevBlockHash)
+	assert.Equal(t, 2, tmpl.Height)
+	assert.Equal(t, int64(TARGETBITS), tmpl.Difficulty)
+	assert.Equal(t, powTarget(TARGETBITS), tmpl.Target)
+	assert.Equal(t, BlockReward+6, tmpl.CoinbaseValue)
+	assert.Equal(t, BlockReward+6, tmpl.Coinbase.Vout[0].Value)
+	assert.Equal(t, []BlockTemplateTx{
+		{Tx: txB, Fee: 2, Size: len(txB.Serialize())},
+		{Tx: txC, Fee: 3, Size: len(txC.Serialize())},
+		{Tx: txA, Fee: 1, Size: len(txA.Serialize())},
+	}, tmpl.Transactions)
+	block := tmpl.Block()
+	assert.Equal(t, tmpl.MerkleRoot, block.HashTransactions())
+
+	block.Mine()
+	assert.Nil(t, a.SubmitBlock(block))
+	assert.Equal(t, 2, bc.Height())
+	assert.Equal(t, block, bc.CurrentBlock())
+	assert.Equal(t, 0, mp.Len())
+	balance := getBalance(testAddressUser2, bc.FindUTXOSet())
+	assert.Equal(t, BlockReward+6+9+4+1, balance.Funds)
+}
+
+func TestSubmitBlockErrors(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	assert.Nil(t, mp.Add(txA))
+	a := NewBlockAssembler(bc, mp, testAddressUser1)
+
+	// the coinbase claims more than the reward and the fees
+	tmpl, err := a.Template()
+	assert.Nil(t, err)
+	tmpl.Coinbase.Vout[0].Value++
+	tmpl.Coinbase.ID = tmpl.Coinbase.Hash()
+	block := tmpl.Block()
+	block.Mine()
+	assert.ErrorIs(t, a.SubmitBlock(block), ErrCoinbaseValue)
+
+	// a block spending the same output twice
+	tmpl, err = a.Template()
+	assert.Nil(t, err)
+	block = tmpl.Block()
+	block.Transactions = append(block.Transactions, txA)
+	block.Mine()
+	err = a.SubmitBlock(block)
+	assert.ErrorIs(t, err, ErrInvalidBlock)
+	assert.ErrorIs(t, err, ErrInputSpent)
+
+	// a block solved on a former tip
+	block = tmpl.Block()
+	block.Mine()
+	assert.Nil(t, a.SubmitBlock(block))
+	assert.ErrorIs(t, a.SubmitBlock(block), ErrStaleBlock)
+	assert.Equal(t, 2, bc.Height())
+}
+
+func TestWaitChange(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	a := NewBlockAssembler(bc, mp, testAddressUser1)
+	tmpl, err := a.Template()
+	assert.Nil(t, err)
+	assert.Empty(t, tmpl.Transactions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = a.WaitChange(ctx, tmpl.LongPollID)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	changes := make(chan int)
+	go func() {
+		longPollID, err := a.WaitChange(context.Background(), tmpl.LongPollID)
+		assert.Nil(t, err)
+		changes <- longPollID
+	}()
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	assert.Nil(t, mp.Add(txA))
+	longPollID := <-changes
+	assert.NotEqual(t, tmpl.LongPollID, longPollID)
+
+	// the owner of the mempool builds the new template
+	newTmpl, err := a.Template()
+	assert.Nil(t, err)
+	assert.Equal(t, longPollID, newTmpl.LongPollID)
+	assert.Equal(t, []BlockTemplateTx{{Tx: txA, Fee: 1, Size: len(txA.Serialize())}}, newTmpl.Transactions)
+
+	// the template is outdated already
+	longPollID, err = a.WaitChange(context.Background(), tmpl.LongPollID)
+	assert.Nil(t, err)
+	assert.Equal(t, newTmpl.LongPollID, longPollID)
+}
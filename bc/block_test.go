@@ -25,13 +25,19 @@ func TestGenesisBlock(t *testing.T) {
 
 func TestBlockHashTransactions(t *testing.T) {
 	// Merkle root of block1
-	merkleRootTxsHash := Hex2Bytes("153b097cb029051834d285f69901237812f13d6dc166d684778096422f331677")
+	merkleRootTxsHash := Hex2Bytes("6ae3b6d69114dec85fb94215541fe7dfa47daec3f0a9f277a014b182d888daba")
 	b := &Block{
 		Transactions: []*Transaction{testTransactions["tx1"]},
 	}
 	root := b.HashTransactions()
 
 	assert.Equalf(t, merkleRootTxsHash, root, "The block hash %x isn't equal to %x", root, merkleRootTxsHash)
+
+	// the witness is committed by the witness root only
+	unsigned := testTransactions["tx1"].TrimmedCopy()
+	b.Transactions = []*Transaction{&unsigned}
+	assert.Equal(t, merkleRootTxsHash, b.HashTransactions())
+	assert.NotEqual(t, (&Block{Transactions: []*Transaction{testTransactions["tx1"]}}).WitnessRoot(), b.WitnessRoot())
 }
 
 func TestMine(t *testing.T) {
@@ -62,3 +68,67 @@ func TestFindTransaction(t *testing.T) {
 	}
 	assert.Equalf(t, expectedTX, tx, "The found tx: %x is not equal to the expected tx: %x", tx.ID, expectedTX.ID)
 }
+
+func TestWitnessCommitment(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	tx, err := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(tx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "witness")
+	cbID := cbTx.ID
+
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx, tx}, bc.CurrentBlock().Hash)
+	assert.False(t, block.ValidWitnessCommitment(), "witness data must be committed")
+	assert.Nil(t, block.AddWitnessCommitment())
+	assert.True(t, block.ValidWitnessCommitment())
+	assert.Equal(t, cbID, cbTx.ID, "the given coinbase is left untouched")
+	assert.Equal(t, 1, len(cbTx.Vout))
+
+	coinbase := block.Transactions[0]
+	assert.Equal(t, coinbase.ID, coinbase.Hash())
+	commitment := coinbase.Vout[len(coinbase.Vout)-1]
+	assert.True(t, commitment.IsDataCarrier())
+	assert.Equal(t, append(append([]byte{}, witnessCommitmentHeader...), block.WitnessRoot()...), commitment.Data)
+
+	// adding the commitment again replaces it
+	assert.Nil(t, block.AddWitnessCommitment())
+	assert.Equal(t, coinbase.Vout, block.Transactions[0].Vout)
+
+	block.Mine()
+	assert.Nil(t, bc.ValidateBlock(block))
+
+	// a malleated witness breaks the commitment
+	malleated := *tx
+	malleated.Vin = append([]TXInput{}, tx.Vin...)
+	malleated.Vin[0].PubKey = Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882")
+	block.Transactions[1] = &malleated
+	assert.False(t, block.ValidWitnessCommitment())
+
+	// blocks without witness data need no commitment
+	block = NewBlock(TestBlockTime, []*Transaction{cbTx}, bc.CurrentBlock().Hash)
+	assert.Nil(t, block.AddWitnessCommitment())
+	assert.Equal(t, cbTx, block.Transactions[0])
+	assert.True(t, block.ValidWitnessCommitment())
+
+	block = NewBlock(TestBlockTime, []*Transaction{tx}, bc.CurrentBlock().Hash)
+	assert.ErrorIs(t, block.AddWitnessCommitment(), ErrNoCoinbase)
+}
+
+func TestMineBlockCommitsWitness(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	tx, _ := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, bc.SignTransaction(tx, *privKey1))
+
+	_, err = bc.MineBlock([]*Transaction{tx})
+	assert.ErrorIs(t, err, ErrNoCoinbase)
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "witness")
+	block, err := bc.MineBlock([]*Transaction{cbTx, tx})
+	assert.Nil(t, err)
+	assert.True(t, block.ValidWitnessCommitment())
+	assert.Equal(t, 2, len(block.Transactions[0].Vout))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
@@ -15,14 +16,23 @@ var (
 	ErrNoValidTx     = errors.New("there is no valid transaction")
 	ErrBlockNotFound = errors.New("block not found")
 	ErrInvalidBlock  = errors.New("block is not valid")
+	ErrGenesisBlock  = errors.New("the genesis block cannot be disconnected")
+	ErrStaleBlock    = errors.New("block does not build on the chain tip")
+	ErrCoinbaseValue = errors.New("coinbase pays more than the block reward and fees")
+	ErrEmptyBlock    = errors.New("block has no transactions")
+	ErrBadMerkleRoot = errors.New("merkle root does not match the transactions")
+	ErrBadWitness    = errors.New("witness commitment does not match the transactions")
 )
 
 // Blockchain keeps a sequence of Blocks
 type Blockchain struct {
-	blocks []*Block
+	blocks   []*Block
+	engine   ConsensusEngine
+	finality *FinalityGadget
 }
 
-// NewBlockchain creates a new blockchain with genesis Block
+// NewBlockchain creates a new blockchain with genesis Block, sealed by the
+// consensus engine of the active chain parameters
 func NewBlockchain(address string) (*Blockchain, error) {
 	txn, err := NewCoinbaseTX(address, GenesisCoinbaseData)
 	if err != nil {
@@ -31,19 +41,98 @@ func NewBlockchain(address string) (*Blockchain, error) {
 	txn.ID = txn.Hash()
 	ts := time.Now().Unix()
 	gensisBlock := NewGenesisBlock(ts, txn)
-	gensisBlock.Mine()
-	return &Blockchain{blocks: []*Block{gensisBlock}}, nil
+	bc := &Blockchain{engine: ActiveChainParams.Consensus, finality: ActiveChainParams.Finality}
+	if err := bc.Engine().Prepare(bc, gensisBlock); err != nil {
+		return nil, err
+	}
+	if err := bc.Engine().Seal(context.Background(), bc, gensisBlock); err != nil {
+		return nil, err
+	}
+	bc.blocks = []*Block{gensisBlock}
+	return bc, nil
+}
+
+// Engine returns the consensus engine of the blockchain, the one of the
+// active chain parameters when not set
+func (bc *Blockchain) Engine() ConsensusEngine {
+	if bc.engine == nil {
+		return ActiveChainParams.Consensus
+	}
+	return bc.engine
 }
 
 // addBlock saves the block into the blockchain
 func (bc *Blockchain) addBlock(block *Block) error {
-	if !bc.ValidateBlock(block) {
-		return ErrInvalidBlock
+	if err := bc.ValidateBlock(block); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBlock, err)
 	}
 	bc.blocks = append(bc.blocks, block)
 	return nil
 }
 
+// DisconnectTip removes the last block from the blockchain, e.g. to replace
+// it with the blocks of a longer chain, and returns it. A final block
+// cannot be disconnected.
+func (bc *Blockchain) DisconnectTip() (*Block, error) {
+	if len(bc.blocks) <= 1 {
+		return nil, ErrGenesisBlock
+	}
+	if err := bc.checkFinality(bc.Height() - 1); err != nil {
+		return nil, err
+	}
+	tip := bc.CurrentBlock()
+	bc.blocks = bc.blocks[:len(bc.blocks)-1]
+	return tip, nil
+}
+
+// Reorganize replaces the blocks after the parent of the branch with the
+// blocks of the branch, when the consensus engine prefers it and no final
+// block is disconnected. The branch
+// blocks are validated as they are connected, and the chain is left
+// unchanged when any is invalid.
+// It returns the disconnected blocks, whose transactions may go back to the
+// mempool.
+func (bc *Blockchain) Reorganize(branch []*Block) ([]*Block, error) {
+	if len(branch) == 0 {
+		return nil, ErrInvalidBlock
+	}
+	fork := -1
+	for i, b := range bc.blocks {
+		if bytes.Equal(b.Hash, branch[0].PrevBlockHash) {
+			fork = i
+			break
+		}
+	}
+	if fork < 0 {
+		return nil, ErrBlockNotFound
+	}
+	if err := bc.checkFinality(fork); err != nil {
+		return nil, err
+	}
+	disconnected := bc.blocks[fork+1:]
+	if !bc.Engine().ForkChoice(disconnected, branch) {
+		return nil, ErrForkChoice
+	}
+	saved := bc.blocks
+	bc.blocks = bc.blocks[: fork+1 : fork+1]
+	for _, b := range branch {
+		if err := bc.ConnectBlock(b); err != nil {
+			bc.blocks = saved
+			return nil, fmt.Errorf("block %x: %w", b.Hash, err)
+		}
+	}
+	return disconnected, nil
+}
+
+// checkFinality checks that keeping the blocks up to height leaves the final
+// checkpoint, if any, in the blockchain
+func (bc *Blockchain) checkFinality(height int) error {
+	if bc.finality == nil {
+		return nil
+	}
+	return bc.finality.checkFork(bc, height)
+}
+
 // GetGenesisBlock returns the Genesis Block
 func (bc Blockchain) GetGenesisBlock() *Block {
 	gensisBlock := bc.blocks[0]
@@ -69,45 +158,227 @@ func (bc Blockchain) GetBlock(hash []byte) (*Block, error) {
 	return nil, ErrBlockNotFound
 }
 
-// ValidateBlock validates the block before adding it to the blockchain
-func (bc *Blockchain) ValidateBlock(block *Block) bool {
+// parentOf returns the block the given block builds on, nil if not in the
+// blockchain, e.g. for the genesis block
+func (bc *Blockchain) parentOf(block *Block) *Block {
+	parent, err := bc.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		return nil
+	}
+	return parent
+}
+
+// heightOf returns the height of the block of the given hash, -1 when it is
+// not in the blockchain
+func (bc *Blockchain) heightOf(hash []byte) int {
+	for height, b := range bc.blocks {
+		if bytes.Equal(b.Hash, hash) {
+			return height
+		}
+	}
+	return -1
+}
+
+// ValidateBlock validates the block before adding it to the blockchain.
+// An invalid signature is reported with a *TxValidationError.
+func (bc *Blockchain) ValidateBlock(block *Block) error {
 	if block == nil || len(block.Transactions) == 0 {
-		return false
+		return ErrEmptyBlock
+	}
+	if err := bc.Engine().VerifySeal(bc, block); err != nil {
+		return err
 	}
-	pow := NewProofOfWork(block)
-	validPow := pow.Validate()
-	return validPow
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ErrBadMerkleRoot
+	}
+	if !block.ValidWitnessCommitment() {
+		return ErrBadWitness
+	}
+	return bc.verifyBlockSignatures(block)
 }
 
-// MineBlock mines a new block with the provided transactions
+// verifyBlockSignatures verifies the IDs and signatures of the block
+// transactions. The Schnorr signatures of the whole block are checked at
+// once with a batch verification.
+func (bc *Blockchain) verifyBlockSignatures(block *Block) error {
+	batch := &SchnorrBatch{}
+	blockTXs := make(map[string]*Transaction)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			prevTXs := make(map[string]*Transaction)
+			for i, in := range tx.Vin {
+				txID := fmt.Sprintf("%x", in.Txid)
+				prevTX, ok := blockTXs[txID]
+				if !ok {
+					var err error
+					if prevTX, err = bc.FindTransaction(in.Txid); err != nil {
+						return txError(ErrTxInputNotFound, i)
+					}
+				}
+				prevTXs[txID] = prevTX
+			}
+			if err := tx.verify(prevTXs, batch); err != nil {
+				return err
+			}
+		} else if err := tx.Verify(nil); err != nil {
+			return err
+		}
+		blockTXs[fmt.Sprintf("%x", tx.ID)] = tx
+	}
+	if !batch.Verify() {
+		return txError(ErrBadSignature, -1)
+	}
+	return nil
+}
+
+// Height returns the height of the last block, the genesis block is at height 0
+func (bc Blockchain) Height() int {
+	return len(bc.blocks) - 1
+}
+
+// MineBlock mines a new block with the provided transactions.
+// Invalid transactions are left out, a transaction may spend the outputs of
+// the transactions before it.
 func (bc *Blockchain) MineBlock(transactions []*Transaction) (*Block, error) {
 	var validTxns []*Transaction
+	utxos := bc.FindUTXOSet()
+	pending := make(map[string]*Transaction)
 	for _, t := range transactions {
-		if bc.VerifyTransaction(t) {
+		if bc.verifyTransaction(t, utxos, pending) == nil {
 			validTxns = append(validTxns, t)
+			utxos.Update([]*Transaction{t})
+			pending[fmt.Sprintf("%x", t.ID)] = t
 		}
 	}
 	if len(validTxns) > 0 {
 		block := NewBlock(time.Now().Unix(), validTxns, bc.CurrentBlock().Hash)
-		block.Mine()
-		bc.addBlock(block)
+		if err := block.AddWitnessCommitment(); err != nil {
+			return nil, err
+		}
+		if err := bc.Engine().Prepare(bc, block); err != nil {
+			return nil, err
+		}
+		if err := bc.Engine().Seal(context.Background(), bc, block); err != nil {
+			return nil, err
+		}
+		if err := bc.addBlock(block); err != nil {
+			return nil, err
+		}
 		return block, nil
 	}
 	return nil, ErrNoValidTx
 }
 
-// VerifyTransaction verifies if referred inputs exist
-func (bc Blockchain) VerifyTransaction(tx *Transaction) bool {
+// ConnectBlock validates a block solved outside of MineBlock, e.g. by an
+// external miner, and adds it to the blockchain. Unlike MineBlock, the block
+// is rejected when any of its transactions is invalid.
+func (bc *Blockchain) ConnectBlock(block *Block) error {
+	if block == nil || len(block.Transactions) == 0 {
+		return ErrInvalidBlock
+	}
+	if !bytes.Equal(block.PrevBlockHash, bc.CurrentBlock().Hash) {
+		return ErrStaleBlock
+	}
+	if bc.finality != nil {
+		if err := bc.finality.checkBlock(bc.Height()+1, block); err != nil {
+			return err
+		}
+	}
+	if err := bc.verifyBlockTransactions(block); err != nil {
+		return err
+	}
+	return bc.addBlock(block)
+}
+
+// verifyBlockTransactions verifies the transactions of a block against the
+// tip, and that the coinbase claims at most the block reward and the fees
+func (bc *Blockchain) verifyBlockTransactions(block *Block) error {
+	coinbase := block.Transactions[0]
+	if !coinbase.IsCoinbase() {
+		return ErrNoCoinbase
+	}
+	if err := coinbase.Verify(nil); err != nil {
+		return fmt.Errorf("%w: coinbase %x: %w", ErrInvalidBlock, coinbase.ID, err)
+	}
+	utxos := bc.FindUTXOSet()
+	pending := make(map[string]*Transaction)
+	value := BlockReward
+	for _, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return fmt.Errorf("%w: more than one coinbase", ErrInvalidBlock)
+		}
+		if err := bc.verifyTransaction(tx, utxos, pending); err != nil {
+			return fmt.Errorf("%w: transaction %x: %w", ErrInvalidBlock, tx.ID, err)
+		}
+		for _, in := range tx.Vin {
+			value += utxos[fmt.Sprintf("%x", in.Txid)][in.OutIdx].Value
+		}
+		for _, out := range tx.Vout {
+			value -= out.Value
+		}
+		utxos.Update([]*Transaction{tx})
+		pending[fmt.Sprintf("%x", tx.ID)] = tx
+	}
+	for _, out := range coinbase.Vout {
+		value -= out.Value
+	}
+	if value < 0 {
+		return ErrCoinbaseValue
+	}
+	return nil
+}
+
+// VerifyTransaction verifies if the transaction can be included in the next
+// block: it must be final, spend existing, unspent and mature outputs, and
+// be valid. The returned error is a *TxValidationError.
+func (bc Blockchain) VerifyTransaction(tx *Transaction) error {
+	return bc.verifyTransaction(tx, bc.FindUTXOSet(), nil)
+}
+
+// verifyTransaction verifies the transaction against the unspent outputs of
+// utxos. Its inputs may spend the outputs of the unconfirmed transactions of
+// pending, which must be part of utxos.
+func (bc Blockchain) verifyTransaction(tx *Transaction, utxos UTXOSet, pending map[string]*Transaction) error {
 	if tx.IsCoinbase() {
-		return true
+		return nil
 	}
-	for _, inPuts := range tx.Vin {
-		_, err := bc.FindTransaction(inPuts.Txid)
-		if err != nil {
-			return false
+	height := bc.Height() + 1
+	if tx.LockTime > height {
+		return txError(ErrNonFinal, -1)
+	}
+	prevTXs := make(map[string]*Transaction)
+	for i, in := range tx.Vin {
+		txID := fmt.Sprintf("%x", in.Txid)
+		prevTX, ok := pending[txID]
+		prevHeight := height
+		if !ok {
+			var err error
+			if prevTX, prevHeight, err = bc.findTransactionHeight(in.Txid); err != nil {
+				return txError(ErrTxInputNotFound, i)
+			}
+		}
+		if !prevTX.hasSpendableOutput(in.OutIdx) {
+			return txError(ErrTxInputNotFound, i)
+		}
+		if _, ok := utxos[txID][in.OutIdx]; !ok {
+			return txError(ErrInputSpent, i)
+		}
+		if prevTX.IsCoinbase() && height-prevHeight < ActiveChainParams.CoinbaseMaturity {
+			return txError(ErrImmatureCoinbase, i)
 		}
+		prevTXs[txID] = prevTX
 	}
-	return true
+	return tx.Verify(prevTXs)
+}
+
+// findTransactionHeight finds a transaction and the height of its block
+func (bc Blockchain) findTransactionHeight(ID []byte) (*Transaction, int, error) {
+	for height, b := range bc.blocks {
+		if tx, err := b.FindTransaction(ID); err == nil {
+			return tx, height, nil
+		}
+	}
+	return nil, 0, ErrTxNotFound
 }
 
 // FindTransaction finds a transaction by its ID in the whole blockchain
@@ -145,6 +416,9 @@ func (bc Blockchain) FindUTXOSet() UTXOSet {
 				}
 			}
 			for idx, out := range txn.Vout { // O(m)
+				if out.IsDataCarrier() {
+					continue
+				}
 				outMap[idx] = out
 				utxos[fmt.Sprintf("%x", txn.ID)] = outMap
 			}
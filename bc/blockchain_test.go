@@ -7,7 +7,7 @@ import (
 )
 
 func newMockBlockchain() *Blockchain {
-	return &Blockchain{[]*Block{testBlockchainData["block0"]}}
+	return &Blockchain{blocks: []*Block{testBlockchainData["block0"]}}
 }
 
 func addMockBlock(bc *Blockchain, newBlock *Block) {
@@ -15,7 +15,7 @@ func addMockBlock(bc *Blockchain, newBlock *Block) {
 }
 
 func TestBlockchain(t *testing.T) {
-	bc, err := NewBlockchain("14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh")
+	bc, err := NewBlockchain("13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug")
 	if bc == nil {
 		t.Fatal("Blockchain is nil")
 	}
@@ -41,7 +41,7 @@ func TestGetGenesisBlock(t *testing.T) {
 		assert.Nil(t, coinbaseTx.Vin[0].Txid)
 		assert.Equal(t, []byte(GenesisCoinbaseData), coinbaseTx.Vin[0].PubKey)
 		assert.Equal(t, BlockReward, coinbaseTx.Vout[0].Value)
-		assert.Equal(t, Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"), coinbaseTx.Vout[0].PubKeyHash)
+		assert.Equal(t, Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"), coinbaseTx.Vout[0].PubKeyHash)
 	} else {
 		t.Errorf("No transactions found on the Genesis block")
 	}
@@ -107,12 +107,12 @@ func TestMineBlockWithInvalidTxInput(t *testing.T) {
 				Txid:      Hex2Bytes("non-existentID"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
-			{Value: 5, PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04")},
-			{Value: 5, PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38")},
+			{Value: 5, PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3")},
+			{Value: 5, PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d")},
 		},
 	}
 
@@ -125,23 +125,23 @@ func TestMineBlock(t *testing.T) {
 	bc := newMockBlockchain()
 
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
-				Signature: Hex2Bytes("add1f5693b8606c0273672e8ca515efcaee68c22d1a826280c77cbb43c871e2a32bd7ffce5e5081a9cbb03b31a95e713a9415be63c8d48d40678a92fc28df5f7"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
@@ -173,23 +173,23 @@ func TestMineBlock(t *testing.T) {
 func TestSignTransaction(t *testing.T) {
 	bc := newMockBlockchain()
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
@@ -202,23 +202,23 @@ func TestSignTransaction(t *testing.T) {
 func TestSignTransactionWithInvalidTxInput(t *testing.T) {
 	bc := newMockBlockchain()
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
 				Txid:      Hex2Bytes("non-existentID"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
@@ -231,84 +231,82 @@ func TestSignTransactionWithInvalidTxInput(t *testing.T) {
 
 func TestVerifyTransaction(t *testing.T) {
 	bc := newMockBlockchain()
-	assert.True(t, bc.VerifyTransaction(testTransactions["tx0"]))
+	assert.Nil(t, bc.VerifyTransaction(testTransactions["tx0"]))
 
 	signedTX := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
-				Signature: Hex2Bytes("add1f5693b8606c0273672e8ca515efcaee68c22d1a826280c77cbb43c871e2a32bd7ffce5e5081a9cbb03b31a95e713a9415be63c8d48d40678a92fc28df5f7"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
-	assert.True(t, bc.VerifyTransaction(signedTX))
+	assert.Nil(t, bc.VerifyTransaction(signedTX))
 }
 
 func TestVerifyTransactionInvalidTxInput(t *testing.T) {
 	bc := newMockBlockchain()
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
 				Txid:      Hex2Bytes("non-existentID"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
-	assert.False(t, bc.VerifyTransaction(tx))
+	assert.ErrorIs(t, bc.VerifyTransaction(tx), ErrTxInputNotFound)
 }
 
 func TestValidateBlock(t *testing.T) {
 	bc := newMockBlockchain()
+	// a block mined from its transactions, independently of the fixtures
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	tx1 := *testTransactions["tx1"]
+	tx1.Vin = append([]TXInput{}, tx1.Vin...)
+	assert.Nil(t, bc.SignTransaction(&tx1, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser2, "mined")
+	mined := NewBlock(TestBlockTime, []*Transaction{cbTx, &tx1}, testBlockchainData["block0"].Hash)
+	assert.Nil(t, mined.AddWitnessCommitment())
+	mined.Mine()
 
 	for _, b := range []struct {
 		name  string
 		block *Block
-		valid bool
+		err   error
 	}{
 		{
 			name:  "valid genesis",
 			block: testBlockchainData["block0"],
-			valid: true,
 		},
 		{
-			name: "valid mined",
-			block: &Block{
-				Timestamp: TestBlockTime,
-				Transactions: []*Transaction{
-					minerCoinbaseTx["tx1"],
-					testTransactions["tx1"],
-				},
-				PrevBlockHash: testBlockchainData["block0"].Hash,
-				Hash:          Hex2Bytes("0017379eb3ca189e5deaecc58523533883452ffe7dbba43cd71c3319d392a931"),
-				Nonce:         35,
-			},
-			valid: true,
+			name:  "valid mined",
+			block: mined,
 		},
 		{
 			name: "invalid block hash",
@@ -316,10 +314,11 @@ func TestValidateBlock(t *testing.T) {
 				Timestamp:     TestBlockTime,
 				Transactions:  []*Transaction{testTransactions["tx0"]},
 				PrevBlockHash: nil,
+				Difficulty:    TARGETBITS,
 				Hash:          Hex2Bytes("73d40a0510b6327d0fbcd4a2baf6e7a70f2de174ad2c84538a7b09320e9db3f2"),
 				Nonce:         164,
 			},
-			valid: false,
+			err: ErrInvalidSeal,
 		},
 		{
 			name: "invalid block nonce",
@@ -327,10 +326,11 @@ func TestValidateBlock(t *testing.T) {
 				Timestamp:     TestBlockTime,
 				Transactions:  []*Transaction{testTransactions["tx0"]},
 				PrevBlockHash: nil,
+				Difficulty:    TARGETBITS,
 				Hash:          Hex2Bytes("00b8075f4a34f54c1cf0c7f6ec9605a52161ee21e974abb4fa8a39ab7553049a"),
 				Nonce:         1,
 			},
-			valid: false,
+			err: ErrInvalidSeal,
 		},
 		{
 			name: "missing coinbase",
@@ -341,10 +341,11 @@ func TestValidateBlock(t *testing.T) {
 					testTransactions["tx3"],
 				},
 				PrevBlockHash: testBlockchainData["block1"].Hash,
+				Difficulty:    TARGETBITS,
 				Hash:          Hex2Bytes("001b92bf4f15fccc72d5f3be56c430507f83179014da38d9289dbdc03c790c3f"),
 				Nonce:         153,
 			},
-			valid: false,
+			err: ErrInvalidSeal,
 		},
 		{
 			name: "wrong coinbase order",
@@ -356,26 +357,55 @@ func TestValidateBlock(t *testing.T) {
 					minerCoinbaseTx["tx1"],
 				},
 				PrevBlockHash: testBlockchainData["block0"].Hash,
+				Difficulty:    TARGETBITS,
 				Hash:          Hex2Bytes("005209ca671422e9295965054ce9940f3ecbf1e15823d7fe5b1ce144ad1cc28f"),
 				Nonce:         410,
 			},
-			valid: false,
+			err: ErrInvalidSeal,
 		},
 		{
 			name:  "nil block",
 			block: nil,
-			valid: false,
+			err:   ErrEmptyBlock,
 		},
 		{
 			name:  "empty transaction list",
 			block: NewBlock(TestBlockTime, []*Transaction{}, nil),
-			valid: false,
+			err:   ErrEmptyBlock,
 		},
 	} {
 		t.Run(b.name, func(t *testing.T) {
-			assert.Equal(t, b.valid, bc.ValidateBlock(b.block))
+			assert.ErrorIs(t, bc.ValidateBlock(b.block), b.err)
 		})
 	}
+
+	// the offending input of an invalid signature is reported
+	tampered := *testTransactions["tx1"]
+	tampered.Vin = append([]TXInput{}, tampered.Vin...)
+	tampered.Vin[0].Signature = testTransactions["tx2"].Vin[0].Signature
+	block := NewBlock(TestBlockTime, []*Transaction{minerCoinbaseTx["tx1"], &tampered}, testBlockchainData["block0"].Hash)
+	assert.Nil(t, block.AddWitnessCommitment())
+	block.Mine()
+	err := bc.ValidateBlock(block)
+	var txErr *TxValidationError
+	assert.ErrorAs(t, err, &txErr)
+	assert.ErrorIs(t, err, ErrBadSignature)
+	assert.Equal(t, 0, txErr.Input)
+
+	// the witness is committed by the coinbase
+	block.Transactions[1] = testTransactions["tx1"]
+	assert.ErrorIs(t, bc.ValidateBlock(block), ErrBadWitness)
+	block.Transactions[1] = testTransactions["tx2"]
+	assert.ErrorIs(t, bc.ValidateBlock(block), ErrBadMerkleRoot)
+
+	// a block committing to a transaction ID that is not its hash is invalid
+	flipped := tx1
+	flipped.ID = append([]byte{}, tx1.ID...)
+	flipped.ID[0] ^= 0xff
+	block = NewBlock(TestBlockTime, []*Transaction{cbTx, &flipped}, testBlockchainData["block0"].Hash)
+	assert.Nil(t, block.AddWitnessCommitment())
+	block.Mine()
+	assert.ErrorIs(t, bc.ValidateBlock(block), ErrTxIDMismatch)
 }
 
 func TestFindTransactionSuccess(t *testing.T) {
@@ -414,3 +444,37 @@ func TestFindUTXOSet(t *testing.T) {
 	utxos = bc.FindUTXOSet()
 	diff(t, expectedUTXOs, utxos, "incorrect UTXO Set")
 }
+
+func TestDisconnectTip(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	_, err = bc.DisconnectTip()
+	assert.ErrorIs(t, err, ErrGenesisBlock)
+
+	genesis := bc.CurrentBlock()
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "tip")
+	block, err := bc.MineBlock([]*Transaction{cbTx})
+	assert.Nil(t, err)
+	tip, err := bc.DisconnectTip()
+	assert.Nil(t, err)
+	assert.Equal(t, block, tip)
+	assert.Equal(t, genesis, bc.CurrentBlock())
+	assert.Equal(t, 0, bc.Height())
+}
+
+func TestMineBlockChainedTransactions(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	genesisTx := bc.GetGenesisBlock().Transactions[0]
+	utxos := bc.FindUTXOSet()
+	parent := spendTestCoin(t, utxos, genesisTx, 0, 5, 0)
+	utxos.Update([]*Transaction{parent})
+	child := spendTestCoin(t, utxos, parent, 1, 5, 0)
+	doubleSpend := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 10, 0)
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "chained")
+	block, err := bc.MineBlock([]*Transaction{cbTx, parent, child, doubleSpend})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(block.Transactions), "the double spend is left out")
+	assert.Equal(t, child.ID, block.Transactions[2].ID)
+}
@@ -1,16 +1,34 @@
 package main
 
-import "crypto/ecdsa"
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
 
 const QUERY = `1: Create a blockchain
-2: Transfer 10 coins from a (miner) to b
+2: Transfer 9 coins from a (miner) to b
 3: Mine a block
 4: Print chain
 5: Print txs and all orher related info for a block
 6: Print a spesific txs
 7: Transfer coins from c
 8: Transfer 5 coins from b to c
-9: Get balance\n10: print utxo set` + "\n"
+9: Get balance
+10: print utxo set
+11: Anchor data (e.g., a document hash) on chain from a
+12: Create a partially signed transaction from a to b
+13: Sign a partially signed transaction
+14: Combine partially signed transactions
+15: Finalize a partially signed transaction
+16: Print the mempool
+17: Disconnect the last block
+18: Bump the fee of a pending transaction of a
+19: Save the mempool and the fee estimates, and quit
+20: Estimate the fee rate to confirm within a number of blocks` + "\n"
 
 type Balance struct {
 	Address string
@@ -26,6 +44,104 @@ func getBalance(address string, u UTXOSet) *Balance {
 	return &Balance{Address: address, Funds: balance}
 }
 
+// readLines sends the lines read from r to the returned channel, which is
+// closed at the end of the input
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+// nextLine returns the next line entered by the user. An interrupt or the
+// end of the input saves the mempool and the fee estimates and exits, from
+// the main goroutine so that nothing modifies them meanwhile.
+func nextLine() string {
+	select {
+	case <-interrupt:
+		shutdown()
+	case line, ok := <-input:
+		if !ok {
+			shutdown()
+		}
+		return strings.TrimSpace(line)
+	}
+	return ""
+}
+
+// readLine prints a prompt and returns the line entered by the user
+func readLine(prompt string) string {
+	fmt.Println(prompt)
+	return nextLine()
+}
+
+// addToMempool submits a transaction to the mempool and reports the outcome
+func addToMempool(txn *Transaction, accepted string) {
+	if mempool == nil {
+		fmt.Println("Plase make sure a blockchain is created and try again!")
+		return
+	}
+	if err := mempool.Add(txn); err != nil {
+		fmt.Println("Transaction rejected:", err)
+		return
+	}
+	fmt.Println(accepted)
+}
+
+// newPayment creates an unsigned transaction paying amount from the coins
+// of from to the address to. The builder pays the fee of the default
+// minimum relay fee rate, so that the mempool accepts it.
+func newPayment(from *Indetity, to string, amount int) (*Transaction, error) {
+	builder := NewTxBuilder(from.pubkey, utxos)
+	if err := builder.AddOutput(to, amount); err != nil {
+		return nil, err
+	}
+	return builder.Build()
+}
+
+// printLoadResult tells what became of the saved mempool transactions
+func printLoadResult(r *MempoolLoadResult) {
+	if r.Added > 0 {
+		fmt.Printf("%d saved transaction(s) back in the mempool!\n", r.Added)
+	}
+	if r.Expired > 0 {
+		fmt.Printf("%d saved transaction(s) dropped: expired\n", r.Expired)
+	}
+	for reason, n := range r.Invalid {
+		fmt.Printf("%d saved transaction(s) dropped: %s\n", n, reason)
+	}
+	if r.Invalid[ErrTxInputNotFound.Error()] > 0 {
+		// the keys and the genesis block are new on every run
+		fmt.Println("Saved transactions spending the coins of a previous blockchain cannot be loaded in a new one.")
+	}
+}
+
+// shutdown saves the mempool and the fee estimates, to be loaded on the
+// next start, and exits
+func shutdown() {
+	if err := feeEstimator.Save(FeeEstimatesFile); err != nil {
+		fmt.Println("Could not save the fee estimates:", err)
+	}
+	if g := ActiveChainParams.Finality; g != nil {
+		if err := g.Save(JustificationsFile); err != nil {
+			fmt.Println("Could not save the final checkpoints:", err)
+		}
+	}
+	if mempool != nil {
+		if err := mempool.Save(MempoolFile); err != nil {
+			fmt.Println("Could not save the mempool:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d pending transaction(s) saved to %s\n", mempool.Len(), MempoolFile)
+	}
+	os.Exit(0)
+}
+
 type Indetity struct {
 	pk      ecdsa.PrivateKey
 	pubkey  []byte
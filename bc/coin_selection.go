@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+)
+
+// CostOfChange is the largest excess a selection can have to be considered
+// a near-exact match. Such a selection pays the excess as fee instead of
+// creating a change output.
+const CostOfChange = 1
+
+// bnbMaxTries bounds the number of branches explored by BranchAndBound
+const bnbMaxTries = 100000
+
+// Coin represents an unspent output that can fund a new transaction
+type Coin struct {
+	Txid   []byte   // The ID of the transaction containing the output
+	OutIdx int      // The index of the output in the transaction
+	Output TXOutput // The unspent output
+}
+
+// CoinSelector chooses which coins fund a transaction
+type CoinSelector interface {
+	// Select returns a non-empty subset of coins whose value covers target.
+	// It returns ErrNoFunds if the coins cannot cover it.
+	Select(coins []Coin, target int) ([]Coin, error)
+}
+
+// DefaultCoinSelector is the strategy used by NewUTXOTransaction
+var DefaultCoinSelector CoinSelector = BranchAndBound{}
+
+// LargestFirst selects the largest coins first, minimizing the number of inputs
+type LargestFirst struct{}
+
+// Select implements CoinSelector
+func (LargestFirst) Select(coins []Coin, target int) ([]Coin, error) {
+	return accumulateCoins(sortCoins(coins, true), target)
+}
+
+// SmallestFirst selects the smallest coins first, consolidating the wallet
+type SmallestFirst struct{}
+
+// Select implements CoinSelector
+func (SmallestFirst) Select(coins []Coin, target int) ([]Coin, error) {
+	return accumulateCoins(sortCoins(coins, false), target)
+}
+
+// RandomSelector selects coins in random order
+type RandomSelector struct {
+	Rand *rand.Rand // The source of randomness, if nil the global source is used
+}
+
+// Select implements CoinSelector
+func (s RandomSelector) Select(coins []Coin, target int) ([]Coin, error) {
+	shuffled := make([]Coin, len(coins))
+	copy(shuffled, coins)
+	shuffle := rand.Shuffle
+	if s.Rand != nil {
+		shuffle = s.Rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulateCoins(shuffled, target)
+}
+
+// BranchAndBound searches for a set of coins matching the target with an
+// excess of at most CostOfChange, so that no change output is needed.
+// If there is no such set, the Fallback strategy (LargestFirst if nil) is used.
+type BranchAndBound struct {
+	Fallback CoinSelector
+}
+
+// Select implements CoinSelector
+func (s BranchAndBound) Select(coins []Coin, target int) ([]Coin, error) {
+	sorted := sortCoins(coins, true)
+	available := 0
+	for _, c := range sorted {
+		available += c.Output.Value
+	}
+	if available < target || len(sorted) == 0 {
+		return nil, ErrNoFunds
+	}
+
+	var selected, best []Coin
+	bestExcess := -1
+	tries := 0
+	var search func(i, total, remaining int)
+	search = func(i, total, remaining int) {
+		if tries >= bnbMaxTries || bestExcess == 0 {
+			return
+		}
+		tries++
+		if total > target+CostOfChange || total+remaining < target {
+			return
+		}
+		if total >= target && len(selected) > 0 {
+			if bestExcess == -1 || total-target < bestExcess {
+				bestExcess = total - target
+				best = append([]Coin{}, selected...)
+			}
+			return
+		}
+		if i == len(sorted) {
+			return
+		}
+		value := sorted[i].Output.Value
+		// explore the branch including the coin first
+		selected = append(selected, sorted[i])
+		search(i+1, total+value, remaining-value)
+		selected = selected[:len(selected)-1]
+		search(i+1, total, remaining-value)
+	}
+	search(0, 0, available)
+
+	if best != nil {
+		return best, nil
+	}
+	fallback := s.Fallback
+	if fallback == nil {
+		fallback = LargestFirst{}
+	}
+	return fallback.Select(coins, target)
+}
+
+// accumulateCoins takes coins in order until their value covers target
+func accumulateCoins(coins []Coin, target int) ([]Coin, error) {
+	var selected []Coin
+	total := 0
+	for _, c := range coins {
+		if total >= target && len(selected) > 0 {
+			break
+		}
+		selected = append(selected, c)
+		total += c.Output.Value
+	}
+	if total < target || len(selected) == 0 {
+		return nil, ErrNoFunds
+	}
+	return selected, nil
+}
+
+// sortCoins returns a copy of coins sorted by value
+// Coins of equal value are ordered by their outpoint to keep selections deterministic
+func sortCoins(coins []Coin, descending bool) []Coin {
+	sorted := make([]Coin, len(coins))
+	copy(sorted, coins)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Output.Value != sorted[j].Output.Value {
+			if descending {
+				return sorted[i].Output.Value > sorted[j].Output.Value
+			}
+			return sorted[i].Output.Value < sorted[j].Output.Value
+		}
+		return lessOutpoint(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+func lessOutpoint(a, b Coin) bool {
+	if c := bytes.Compare(a.Txid, b.Txid); c != 0 {
+		return c < 0
+	}
+	return a.OutIdx < b.OutIdx
+}
+
+// coinsValue returns the total value of the coins
+func coinsValue(coins []Coin) int {
+	total := 0
+	for _, c := range coins {
+		total += c.Output.Value
+	}
+	return total
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCoins(values ...int) []Coin {
+	var coins []Coin
+	for i, v := range values {
+		coins = append(coins, Coin{
+			Txid:   []byte{byte(i)},
+			OutIdx: 0,
+			Output: TXOutput{Value: v, PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d")},
+		})
+	}
+	return coins
+}
+
+func coinValues(coins []Coin) []int {
+	var values []int
+	for _, c := range coins {
+		values = append(values, c.Output.Value)
+	}
+	return values
+}
+
+func TestCoinSelectors(t *testing.T) {
+	coins := newTestCoins(3, 10, 1, 5, 2)
+	for _, test := range []struct {
+		name     string
+		selector CoinSelector
+		target   int
+		expected []int
+	}{
+		{name: "largest first", selector: LargestFirst{}, target: 12, expected: []int{10, 5}},
+		{name: "smallest first", selector: SmallestFirst{}, target: 5, expected: []int{1, 2, 3}},
+		{name: "branch and bound exact match", selector: BranchAndBound{}, target: 9, expected: []int{5, 3, 1}},
+		{name: "branch and bound near-exact match", selector: BranchAndBound{}, target: 20, expected: []int{10, 5, 3, 2}},
+		{name: "at least one input", selector: LargestFirst{}, target: 0, expected: []int{10}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := test.selector.Select(coins, test.target)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, coinValues(selected))
+		})
+	}
+}
+
+func TestBranchAndBoundFallback(t *testing.T) {
+	// there is no selection with an excess of at most CostOfChange
+	coins := newTestCoins(10, 7)
+
+	selected, err := BranchAndBound{}.Select(coins, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{10}, coinValues(selected))
+
+	selected, err = BranchAndBound{Fallback: SmallestFirst{}}.Select(coins, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{7}, coinValues(selected))
+}
+
+func TestRandomSelector(t *testing.T) {
+	coins := newTestCoins(3, 10, 1, 5, 2)
+	selector := RandomSelector{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 10; i++ {
+		selected, err := selector.Select(coins, 7)
+		assert.Nil(t, err)
+		total := coinsValue(selected)
+		assert.GreaterOrEqual(t, total, 7)
+		// removing the last selected coin must not cover the target
+		assert.Less(t, total-selected[len(selected)-1].Output.Value, 7)
+	}
+}
+
+func TestCoinSelectorsNoFunds(t *testing.T) {
+	coins := newTestCoins(3, 10, 1)
+	for _, selector := range []CoinSelector{LargestFirst{}, SmallestFirst{}, BranchAndBound{}, RandomSelector{}} {
+		_, err := selector.Select(coins, 15)
+		assert.ErrorIs(t, err, ErrNoFunds)
+		_, err = selector.Select(nil, 0)
+		assert.ErrorIs(t, err, ErrNoFunds)
+	}
+}
+
+func TestNewUTXOTransactionWithFee(t *testing.T) {
+	pubKey1Bytes := Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d")
+	toAddress := "1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs"
+	utxos := getTestExpectedUTXOSet("block2") // 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug owns 4 and 3 coins
+
+	// Only the coin covering amount plus fee is spent
+	tx, err := NewUTXOTransactionWithFee(pubKey1Bytes, toAddress, 2, 1, utxos, SmallestFirst{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tx.Vin))
+	assert.Equal(t, Hex2Bytes("4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154"), tx.Vin[0].Txid)
+	assert.Equal(t, 0, tx.Vin[0].OutIdx)
+	assert.Equal(t, 1, len(tx.Vout), "an exact match should not create change")
+
+	// A near-exact match pays the excess as fee instead of creating change
+	tx, err = NewUTXOTransactionWithFee(pubKey1Bytes, toAddress, 5, 1, utxos, BranchAndBound{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tx.Vin))
+	assert.Equal(t, []TXOutput{{Value: 5, PubKeyHash: GetPubKeyHashFromAddress(toAddress)}}, tx.Vout)
+
+	// Change is created otherwise
+	tx, err = NewUTXOTransactionWithFee(pubKey1Bytes, toAddress, 1, 1, utxos, LargestFirst{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tx.Vin))
+	assert.Equal(t, 2, len(tx.Vout))
+	assert.Equal(t, 2, tx.Vout[1].Value)
+
+	_, err = NewUTXOTransactionWithFee(pubKey1Bytes, toAddress, 7, 1, utxos, LargestFirst{})
+	assert.ErrorIs(t, err, ErrNoFunds)
+}
+
+func TestFindCoins(t *testing.T) {
+	utxos := getTestExpectedUTXOSet("block2")
+	coins := utxos.FindCoins(Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"))
+	assert.Equal(t, []Coin{
+		{Txid: Hex2Bytes("481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a"), OutIdx: 1, Output: testTransactions["tx3"].Vout[1]},
+		{Txid: Hex2Bytes("4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154"), OutIdx: 0, Output: testTransactions["tx2"].Vout[0]},
+	}, coins)
+}
@@ -1,8 +1,85 @@
 package main
 
+import (
+	"errors"
+	"time"
+)
+
 // BlockReward represents the reward given by mining a new block
 const BlockReward = 10
 
 // GenesisCoinbaseData contains the message of the genesis transaction.
 // Historically: https://en.bitcoin.it/wiki/File:Jonny1000thetimes.png
 const GenesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+
+// MaxDataCarrierSize is the maximum number of bytes a data-carrier output can hold
+const MaxDataCarrierSize = 80
+
+// MaxTxSize is the maximum size in bytes of a serialized transaction
+const MaxTxSize = 100000
+
+// MaxBlockSize is the maximum size in bytes of the transactions of a block
+const MaxBlockSize = 1000000
+
+// MempoolFile is the file the mempool is saved to on shutdown
+const MempoolFile = "mempool.dat"
+
+// FeeEstimatesFile is the file the fee estimator is saved to on shutdown
+const FeeEstimatesFile = "fee_estimates.dat"
+
+// JustificationsFile is the file the final checkpoints are saved to on
+// shutdown
+const JustificationsFile = "justifications.dat"
+
+// DefaultMempoolExpiry is the age after which an unconfirmed transaction
+// leaves the mempool
+const DefaultMempoolExpiry = 14 * 24 * time.Hour
+
+// ChainParams defines the consensus rules a chain is created with
+type ChainParams struct {
+	Name string
+	// KeyType is the curve of the keys signing transactions
+	KeyType KeyType
+	// CoinbaseMaturity is the number of blocks after which a coinbase can be
+	// spent, 1 lets the next block spend it
+	CoinbaseMaturity int
+	// Consensus seals and verifies the blocks, and chooses between forks
+	Consensus ConsensusEngine
+	// Finality finalizes the checkpoint blocks, nil when blocks are never
+	// final
+	Finality *FinalityGadget
+	// PowAlgorithm is the hash function of the proof-of-work
+	PowAlgorithm PowAlgorithm
+}
+
+var (
+	// P256ChainParams signs transactions with P-256 keys
+	P256ChainParams = ChainParams{Name: "p256", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: NewProofOfWorkEngine(0)}
+	// Secp256k1ChainParams signs transactions with secp256k1 keys, as Bitcoin does
+	Secp256k1ChainParams = ChainParams{Name: "secp256k1", KeyType: KeyTypeSecp256k1, CoinbaseMaturity: 1, Consensus: NewProofOfWorkEngine(0)}
+	// ScryptChainParams mine blocks with the memory-hard scrypt, e.g. for a
+	// test network open to CPU miners
+	ScryptChainParams = ChainParams{Name: "scrypt", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: NewProofOfWorkEngine(0), PowAlgorithm: PowScrypt}
+	// ProofOfAuthorityChainParams seal blocks with the signatures of a set
+	// of signers instead of a proof-of-work, e.g. for a private network.
+	// The signers are set with SetSigners before the chain is created.
+	ProofOfAuthorityChainParams = ChainParams{Name: "poa", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: NewProofOfAuthorityEngine(nil)}
+	// ProofOfStakeChainParams seal blocks with the coins held instead of a
+	// proof-of-work. The key of the staked outputs is set with Authorize.
+	ProofOfStakeChainParams = ChainParams{Name: "pos", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: NewProofOfStakeEngine()}
+)
+
+var ErrUnknownChainParams = errors.New("unknown chain parameters")
+
+// ActiveChainParams are the parameters of the running chain
+var ActiveChainParams = &P256ChainParams
+
+// ParseChainParams returns the chain parameters of the given name
+func ParseChainParams(name string) (*ChainParams, error) {
+	for _, params := range []*ChainParams{&P256ChainParams, &Secp256k1ChainParams, &ScryptChainParams, &ProofOfAuthorityChainParams, &ProofOfStakeChainParams} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return nil, ErrUnknownChainParams
+}
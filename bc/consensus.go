@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrInvalidSeal   = errors.New("block seal is not valid")
+	ErrBadDifficulty = errors.New("block difficulty is not valid")
+	ErrForkChoice    = errors.New("branch is not preferred over the current chain")
+)
+
+// ConsensusEngine decides who may add a block to the chain and which chain
+// is followed. The blockchain only calls the engine of its chain parameters,
+// so a deployment can replace the proof-of-work by another engine.
+type ConsensusEngine interface {
+	// Prepare sets the consensus fields of a new block, e.g. its
+	// difficulty, before its transactions are sealed
+	Prepare(chain *Blockchain, block *Block) error
+	// Seal finds or signs the seal of a prepared block, setting its hash.
+	// It stops with the context error when ctx is canceled.
+	Seal(ctx context.Context, chain *Blockchain, block *Block) error
+	// VerifySeal checks that the block is sealed according to the rules of
+	// the engine, its difficulty included
+	VerifySeal(chain *Blockchain, block *Block) error
+	// Difficulty returns the difficulty of a block built on parent, nil for
+	// the genesis block
+	Difficulty(chain *Blockchain, parent *Block) int64
+	// ForkChoice reports whether the candidate branch should replace the
+	// current one, both starting after their common ancestor
+	ForkChoice(current, candidate []*Block) bool
+}
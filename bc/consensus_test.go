@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBranch seals n blocks with only a coinbase on top of parent
+func newTestBranch(t *testing.T, bc *Blockchain, parent *Block, name string, n int) []*Block {
+	var branch []*Block
+	for i := 0; i < n; i++ {
+		cbTx, err := NewCoinbaseTX(testAddressUser1, fmt.Sprintf("%s %d", name, i))
+		assert.Nil(t, err)
+		block := NewBlock(TestBlockTime, []*Transaction{cbTx}, parent.Hash)
+		assert.Nil(t, bc.Engine().Prepare(bc, block))
+		assert.Nil(t, bc.Engine().Seal(context.Background(), bc, block))
+		branch = append(branch, block)
+		parent = block
+	}
+	return branch
+}
+
+func TestProofOfWorkEngine(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	engine := NewProofOfWorkEngine(2)
+	assert.Nil(t, engine.VerifySeal(bc, bc.GetGenesisBlock()))
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "engine")
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx}, bc.CurrentBlock().Hash)
+	assert.Nil(t, engine.Prepare(bc, block))
+	assert.Equal(t, int64(TARGETBITS), block.Difficulty)
+	assert.Nil(t, engine.Seal(context.Background(), bc, block))
+	assert.Nil(t, engine.VerifySeal(bc, block))
+	assert.Greater(t, engine.Miner().Hashrate(), 0.0)
+
+	block.Nonce++
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrInvalidSeal)
+	block.Nonce--
+	block.Difficulty = TARGETBITS - 1
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrBadDifficulty)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, engine.Seal(ctx, bc, block), context.Canceled)
+}
+
+func TestProofOfWorkForkChoice(t *testing.T) {
+	engine := NewProofOfWorkEngine(1)
+	one := []*Block{{Difficulty: TARGETBITS}}
+	two := []*Block{{Difficulty: TARGETBITS}, {Difficulty: TARGETBITS}}
+	harder := []*Block{{Difficulty: TARGETBITS + 2}}
+
+	assert.True(t, engine.ForkChoice(one, two))
+	assert.False(t, engine.ForkChoice(two, one))
+	assert.False(t, engine.ForkChoice(one, one), "the current branch is kept on a tie")
+	assert.True(t, engine.ForkChoice(two, harder), "the work counts, not the length")
+	assert.True(t, engine.ForkChoice(nil, one))
+}
+
+func TestReorganize(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	genesis := bc.GetGenesisBlock()
+	current := newTestBranch(t, bc, genesis, "current", 1)
+	assert.Nil(t, bc.ConnectBlock(current[0]))
+
+	// a branch with as much work is not preferred
+	_, err = bc.Reorganize(newTestBranch(t, bc, genesis, "same", 1))
+	assert.ErrorIs(t, err, ErrForkChoice)
+	assert.Equal(t, current[0], bc.CurrentBlock())
+
+	// an invalid block leaves the chain unchanged
+	invalid := newTestBranch(t, bc, genesis, "invalid", 2)
+	invalid[1].Nonce++
+	_, err = bc.Reorganize(invalid)
+	assert.ErrorIs(t, err, ErrInvalidBlock)
+	assert.Equal(t, []*Block{genesis, current[0]}, bc.blocks)
+
+	branch := newTestBranch(t, bc, genesis, "branch", 2)
+	disconnected, err := bc.Reorganize(branch)
+	assert.Nil(t, err)
+	assert.Equal(t, current, disconnected)
+	assert.Equal(t, []*Block{genesis, branch[0], branch[1]}, bc.blocks)
+
+	_, err = bc.Reorganize([]*Block{{PrevBlockHash: make([]byte, 32)}})
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+}
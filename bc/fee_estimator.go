@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	// FeeEstimatorMaxTarget is the maximum number of blocks a fee can be
+	// estimated for
+	FeeEstimatorMaxTarget = 25
+	// feeEstimatorDecay scales down the past observations at each block, so
+	// that the estimates follow the recent blocks
+	feeEstimatorDecay = 0.998
+	// feeEstimatorSuccess is the share of the transactions of a fee rate
+	// that must have confirmed within the target
+	feeEstimatorSuccess = 0.85
+	// feeEstimatorMinSamples is the number of transactions a fee rate
+	// estimate is based on at least
+	feeEstimatorMinSamples = 2
+	// maxBucketFeeRate is the fee rate per 1000 bytes of the highest bucket
+	maxBucketFeeRate = 1e6
+	// feeBucketSpacing is the ratio of the fee rates of consecutive buckets
+	feeBucketSpacing = 1.2
+)
+
+// feeEstimatesMagic starts every saved fee estimator
+var feeEstimatesMagic = []byte("fees\xff")
+
+var (
+	ErrFeeTarget               = errors.New("invalid fee estimation target")
+	ErrNoFeeEstimate           = errors.New("not enough confirmed transactions to estimate the fee")
+	ErrInvalidFeeEstimatesFile = errors.New("invalid fee estimates file")
+)
+
+// feeBucketRates are the lowest fee rates per 1000 bytes of the buckets
+var feeBucketRates = func() []float64 {
+	rates := []float64{0}
+	for rate := 1.0; rate <= maxBucketFeeRate; rate *= feeBucketSpacing {
+		rates = append(rates, rate)
+	}
+	return rates
+}()
+
+// FeeEstimator estimates the fee rate a transaction must pay to confirm
+// within a number of blocks. It tracks how long the mempool transactions
+// take to confirm, grouped by fee rate in buckets.
+// It implements MempoolListener.
+type FeeEstimator struct {
+	height  int // The number of blocks connected since the start
+	buckets []feeBucket
+	tracked map[string]trackedTx // The mempool transactions by ID
+}
+
+// feeBucket holds the decayed counts of the confirmed transactions of a
+// range of fee rates
+type feeBucket struct {
+	FeeRate   float64   // The lowest fee rate of the bucket
+	Txs       float64   // The number of confirmed transactions
+	Confirmed []float64 // The number of transactions confirmed within i+1 blocks
+}
+
+type trackedTx struct {
+	height int // The height the transaction entered the mempool at
+	bucket int
+}
+
+// NewFeeEstimator creates a fee estimator without observations
+func NewFeeEstimator() *FeeEstimator {
+	buckets := make([]feeBucket, len(feeBucketRates))
+	for i, rate := range feeBucketRates {
+		buckets[i] = feeBucket{FeeRate: rate, Confirmed: make([]float64, FeeEstimatorMaxTarget)}
+	}
+	return &FeeEstimator{buckets: buckets, tracked: make(map[string]trackedTx)}
+}
+
+// bucketOf returns the bucket of the fee rate of a transaction
+func bucketOf(fee, size int) int {
+	rate := float64(fee) * 1000 / float64(size)
+	return sort.Search(len(feeBucketRates), func(i int) bool {
+		return feeBucketRates[i] > rate
+	}) - 1
+}
+
+// TxAdded implements MempoolListener
+func (f *FeeEstimator) TxAdded(e *MempoolEntry) {
+	txID := fmt.Sprintf("%x", e.Tx.ID)
+	if _, ok := f.tracked[txID]; !ok {
+		f.tracked[txID] = trackedTx{height: f.height, bucket: bucketOf(e.Fee, e.Size)}
+	}
+}
+
+// TxRemoved implements MempoolListener. The transactions confirmed by a
+// block are already recorded, the others are not observations.
+func (f *FeeEstimator) TxRemoved(e *MempoolEntry) {
+	delete(f.tracked, fmt.Sprintf("%x", e.Tx.ID))
+}
+
+// BlockConnected implements MempoolListener. It records the number of
+// blocks the tracked transactions of the block took to confirm.
+func (f *FeeEstimator) BlockConnected(block *Block) {
+	f.height++
+	for i := range f.buckets {
+		b := &f.buckets[i]
+		b.Txs *= feeEstimatorDecay
+		for t := range b.Confirmed {
+			b.Confirmed[t] *= feeEstimatorDecay
+		}
+	}
+	for _, tx := range block.Transactions {
+		txID := fmt.Sprintf("%x", tx.ID)
+		t, ok := f.tracked[txID]
+		if !ok {
+			continue
+		}
+		delete(f.tracked, txID)
+		b := &f.buckets[t.bucket]
+		b.Txs++
+		for blocks := max(f.height-t.height, 1); blocks <= FeeEstimatorMaxTarget; blocks++ {
+			b.Confirmed[blocks-1]++
+		}
+	}
+}
+
+// BlockDisconnected implements MempoolListener
+func (f *FeeEstimator) BlockDisconnected(block *Block) {
+	f.height--
+}
+
+// EstimateFee returns the lowest fee rate at which most transactions
+// confirmed within targetBlocks blocks. The transactions still waiting after
+// targetBlocks blocks count as not confirmed in time.
+// Starting from the highest fee rates, buckets are grouped until they hold
+// enough transactions, and the estimate is the lowest group confirming in
+// time, before the first group failing to.
+func (f *FeeEstimator) EstimateFee(targetBlocks int) (FeeRatePerKB, error) {
+	if targetBlocks < 1 || targetBlocks > FeeEstimatorMaxTarget {
+		return 0, fmt.Errorf("%w: %d, between 1 and %d", ErrFeeTarget, targetBlocks, FeeEstimatorMaxTarget)
+	}
+	waiting := make([]float64, len(f.buckets))
+	for _, t := range f.tracked {
+		if f.height-t.height >= targetBlocks {
+			waiting[t.bucket]++
+		}
+	}
+
+	best := -1
+	txs, confirmed := 0.0, 0.0
+	for i := len(f.buckets) - 1; i >= 0; i-- {
+		txs += f.buckets[i].Txs + waiting[i]
+		confirmed += f.buckets[i].Confirmed[targetBlocks-1]
+		if txs < feeEstimatorMinSamples {
+			continue
+		}
+		if confirmed/txs < feeEstimatorSuccess {
+			break
+		}
+		best = i
+		txs, confirmed = 0, 0
+	}
+	if best < 0 {
+		return 0, ErrNoFeeEstimate
+	}
+	return FeeRatePerKB(math.Ceil(f.buckets[best].FeeRate)), nil
+}
+
+// Save writes the observations of the estimator to a file. The tracked
+// transactions are not saved, the reloaded mempool adds them back.
+func (f *FeeEstimator) Save(path string) error {
+	return writeGobFile(path, feeEstimatesMagic, f.buckets)
+}
+
+// LoadFeeEstimator creates a fee estimator with the observations saved by
+// Save. A missing file gives an estimator without observations.
+func LoadFeeEstimator(path string) (*FeeEstimator, error) {
+	f := NewFeeEstimator()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, feeEstimatesMagic) {
+		return nil, ErrInvalidFeeEstimatesFile
+	}
+	var buckets []feeBucket
+	dec := gob.NewDecoder(bytes.NewReader(data[len(feeEstimatesMagic):]))
+	if err := dec.Decode(&buckets); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeeEstimatesFile, err)
+	}
+	// the observations are kept only for the same buckets
+	if len(buckets) != len(f.buckets) {
+		return nil, ErrInvalidFeeEstimatesFile
+	}
+	for i, b := range buckets {
+		if b.FeeRate != f.buckets[i].FeeRate || len(b.Confirmed) != FeeEstimatorMaxTarget {
+			return nil, ErrInvalidFeeEstimatesFile
+		}
+	}
+	f.buckets = buckets
+	return f, nil
+}
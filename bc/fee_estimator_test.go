@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestEntries returns mempool entries of 1000 bytes paying fee each
+func newTestEntries(first byte, n, fee int) []*MempoolEntry {
+	var entries []*MempoolEntry
+	for i := 0; i < n; i++ {
+		tx := &Transaction{ID: []byte{first + byte(i)}}
+		entries = append(entries, &MempoolEntry{Tx: tx, Fee: fee, Size: 1000})
+	}
+	return entries
+}
+
+func blockOf(entries []*MempoolEntry) *Block {
+	block := &Block{}
+	for _, e := range entries {
+		block.Transactions = append(block.Transactions, e.Tx)
+	}
+	return block
+}
+
+func TestFeeEstimator(t *testing.T) {
+	f := NewFeeEstimator()
+	_, err := f.EstimateFee(1)
+	assert.ErrorIs(t, err, ErrNoFeeEstimate)
+	_, err = f.EstimateFee(0)
+	assert.ErrorIs(t, err, ErrFeeTarget)
+	_, err = f.EstimateFee(FeeEstimatorMaxTarget + 1)
+	assert.ErrorIs(t, err, ErrFeeTarget)
+
+	// the high fee transactions confirm in the next block, the low fee
+	// ones three blocks later
+	high := newTestEntries(0, 3, 10)
+	low := newTestEntries(10, 3, 1)
+	for _, e := range append(high, low...) {
+		f.TxAdded(e)
+	}
+	f.BlockConnected(blockOf(high))
+	f.BlockConnected(&Block{})
+	f.BlockConnected(blockOf(low))
+
+	highRate := FeeRatePerKB(math.Ceil(feeBucketRates[bucketOf(10, 1000)]))
+	assert.LessOrEqual(t, int(highRate), 10)
+	for target, expected := range map[int]FeeRatePerKB{1: highRate, 2: highRate, 3: 1, FeeEstimatorMaxTarget: 1} {
+		rate, err := f.EstimateFee(target)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, rate, "target %d", target)
+	}
+
+	// low fee transactions waiting for longer than the target
+	waiting := newTestEntries(20, 2, 1)
+	for _, e := range waiting {
+		f.TxAdded(e)
+	}
+	for i := 0; i < 3; i++ {
+		f.BlockConnected(&Block{})
+	}
+	rate, err := f.EstimateFee(3)
+	assert.Nil(t, err)
+	assert.Equal(t, highRate, rate)
+
+	// a transaction leaving the mempool unconfirmed is not an observation
+	f.TxRemoved(waiting[0])
+	f.TxRemoved(waiting[1])
+	rate, err = f.EstimateFee(3)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRatePerKB(1), rate)
+}
+
+func TestFeeEstimatorSaveLoad(t *testing.T) {
+	f := NewFeeEstimator()
+	entries := newTestEntries(0, 2, 5)
+	for _, e := range entries {
+		f.TxAdded(e)
+	}
+	f.BlockConnected(blockOf(entries))
+	expected, err := f.EstimateFee(1)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, FeeEstimatesFile)
+	assert.Nil(t, f.Save(path))
+	assert.Nil(t, f.Save(path), "the saved estimates are replaced")
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "no temporary file is left behind")
+	loaded, err := LoadFeeEstimator(path)
+	assert.Nil(t, err)
+	rate, err := loaded.EstimateFee(1)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, rate)
+
+	loaded, err = LoadFeeEstimator(filepath.Join(dir, "missing.dat"))
+	assert.Nil(t, err)
+	_, err = loaded.EstimateFee(1)
+	assert.ErrorIs(t, err, ErrNoFeeEstimate)
+
+	invalid := filepath.Join(dir, "invalid.dat")
+	assert.Nil(t, os.WriteFile(invalid, []byte("no estimates"), 0600))
+	_, err = LoadFeeEstimator(invalid)
+	assert.ErrorIs(t, err, ErrInvalidFeeEstimatesFile)
+}
+
+func TestFeeEstimatorMempool(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	f := NewFeeEstimator()
+	mp.AddListener(f)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	assert.Equal(t, 2, len(f.tracked))
+
+	newCbTx, _ := NewCoinbaseTX(testAddressUser1, "estimate")
+	block, err := bc.MineBlock(append([]*Transaction{newCbTx}, mp.Select(MaxBlockSize)...))
+	assert.Nil(t, err)
+	mp.BlockConnected(block)
+	assert.Equal(t, 0, len(f.tracked))
+	rate, err := f.EstimateFee(1)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRatePerKB(math.Ceil(feeBucketRates[bucketOf(1, len(txA.Serialize()))])), rate)
+}
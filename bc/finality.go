@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// justificationMagic starts every saved list of justifications
+var justificationMagic = []byte("final\xff")
+
+var (
+	ErrNotValidator              = errors.New("not a finality validator")
+	ErrInvalidVote               = errors.New("invalid finality vote")
+	ErrConflictingVote           = errors.New("validator voted for two blocks at the same height")
+	ErrFinalizedBlock            = errors.New("block conflicts with a finalized block")
+	ErrInvalidJustificationFile  = errors.New("invalid justification file")
+	ErrInsufficientJustification = errors.New("justification is not signed by two thirds of the validators")
+	ErrNotFinalSource            = errors.New("vote does not extend the last final checkpoint")
+)
+
+// FinalityGadget finalizes blocks on top of the consensus engine, e.g. for
+// settlement: the validators sign votes on the checkpoint blocks, one every
+// interval blocks, and a checkpoint voted for by more than two thirds of
+// them is final. The blockchain then refuses to disconnect it.
+// A vote names the last final checkpoint it extends, its source, so that
+// each final checkpoint descends from the previous one.
+// A validator voting for two blocks at the same height, or skipping a final
+// checkpoint it voted for, is caught, the two votes being the evidence.
+type FinalityGadget struct {
+	validators map[string]bool // The validators by hex public key
+	interval   int             // The number of blocks between two checkpoints
+	key        *ecdsa.PrivateKey
+
+	votes         map[int]map[string]*Vote // The votes by height, by validator
+	finalized     []*Justification         // The final checkpoints, the last one last
+	equivocations []Equivocation
+}
+
+// Vote is the vote of a validator for the checkpoint block at a height
+type Vote struct {
+	Height     int
+	Hash       []byte // The hash of the checkpoint block
+	Source     int    // The height of the final checkpoint extended, 0 when none
+	SourceHash []byte // The hash of the final checkpoint extended, nil when none
+	Validator  []byte // The public key of the validator
+	Signature  []byte // The DER signature of the vote hash
+}
+
+// Justification proves that a checkpoint is final with the votes of more
+// than two thirds of the validators
+type Justification struct {
+	Height int
+	Hash   []byte
+	Votes  []*Vote
+}
+
+// Equivocation is the evidence of a validator voting for two blocks at the
+// same height, or for a checkpoint and for another skipping it
+type Equivocation struct {
+	First  *Vote
+	Second *Vote
+}
+
+// NewFinalityGadget creates a finality gadget with the validators, given as
+// compressed public keys, voting every interval blocks. It verifies votes
+// only until a key is set with Authorize.
+func NewFinalityGadget(validators [][]byte, interval int) *FinalityGadget {
+	g := &FinalityGadget{validators: make(map[string]bool), interval: interval, votes: make(map[int]map[string]*Vote)}
+	for _, v := range validators {
+		g.validators[hex.EncodeToString(v)] = true
+	}
+	return g
+}
+
+// Authorize sets the key the votes of this node are signed with
+func (g *FinalityGadget) Authorize(key *ecdsa.PrivateKey) {
+	g.key = key
+}
+
+// IsCheckpoint checks whether the validators vote on the block at height
+func (g *FinalityGadget) IsCheckpoint(height int) bool {
+	return height > 0 && height%g.interval == 0
+}
+
+// Finalized returns the justification of the last final checkpoint, nil if
+// none
+func (g *FinalityGadget) Finalized() *Justification {
+	if len(g.finalized) == 0 {
+		return nil
+	}
+	return g.finalized[len(g.finalized)-1]
+}
+
+// finalizedBelow returns the justification of the last final checkpoint
+// below height, nil if none
+func (g *FinalityGadget) finalizedBelow(height int) *Justification {
+	for i := len(g.finalized) - 1; i >= 0; i-- {
+		if g.finalized[i].Height < height {
+			return g.finalized[i]
+		}
+	}
+	return nil
+}
+
+// Equivocations returns the evidence of the conflicting votes received
+func (g *FinalityGadget) Equivocations() []Equivocation {
+	return g.equivocations
+}
+
+// SignVote signs a vote for the checkpoint block of the chain at height,
+// extending the last final checkpoint below it, and adds it. The chain must
+// hold that final checkpoint.
+func (g *FinalityGadget) SignVote(chain *Blockchain, height int) (*Vote, error) {
+	if g.key == nil {
+		return nil, ErrNotValidator
+	}
+	if height > chain.Height() || !g.IsCheckpoint(height) {
+		return nil, fmt.Errorf("%w: no checkpoint at height %d", ErrInvalidVote, height)
+	}
+	vote := &Vote{Height: height, Hash: chain.blocks[height].Hash, Validator: pubKeyToByte(g.key.PublicKey)}
+	if source := g.finalizedBelow(height); source != nil {
+		if !bytes.Equal(chain.blocks[source.Height].Hash, source.Hash) {
+			return nil, fmt.Errorf("%w at height %d", ErrFinalizedBlock, source.Height)
+		}
+		vote.Source, vote.SourceHash = source.Height, source.Hash
+	}
+	r, s := signRFC6979(g.key, vote.hash())
+	vote.Signature = encodeSignatureDER(r, normalizeS(g.key.Curve, s))
+	if err := g.AddVote(chain, vote); err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+// AddVote adds the vote of a validator, and finalizes its checkpoint when
+// more than two thirds of the validators voted for it. The checkpoint block
+// needs not be on the chain, e.g. when on another branch, but the vote must
+// extend the last final checkpoint. A checkpoint block on the chain must
+// descend from the source of the vote.
+// A vote conflicting with a previous vote of the validator, or skipping a
+// final checkpoint the validator voted for, is recorded as an equivocation,
+// and rejected.
+func (g *FinalityGadget) AddVote(chain *Blockchain, vote *Vote) error {
+	if err := g.verifyVote(vote); err != nil {
+		return err
+	}
+	validator := hex.EncodeToString(vote.Validator)
+	if last := g.Finalized(); last != nil && vote.Height <= last.Height {
+		// the checkpoint is settled, only a vote against it matters
+		for _, j := range g.finalized {
+			if j.Height != vote.Height {
+				continue
+			}
+			for _, v := range j.Votes {
+				if bytes.Equal(v.Validator, vote.Validator) && !bytes.Equal(v.Hash, vote.Hash) {
+					return g.equivocate(v, vote)
+				}
+			}
+		}
+		return nil
+	}
+	if err := g.checkSource(vote); err != nil {
+		return err
+	}
+	if err := checkAncestry(chain, vote); err != nil {
+		return err
+	}
+	if g.votes[vote.Height] == nil {
+		g.votes[vote.Height] = make(map[string]*Vote)
+	}
+	if previous, ok := g.votes[vote.Height][validator]; ok {
+		if !bytes.Equal(previous.Hash, vote.Hash) {
+			return g.equivocate(previous, vote)
+		}
+		if previous.Source == vote.Source {
+			return nil
+		}
+	}
+	// a vote for the same block replaces one extending an older checkpoint
+	g.votes[vote.Height][validator] = vote
+
+	var votes []*Vote
+	for _, v := range g.votes[vote.Height] {
+		if bytes.Equal(v.Hash, vote.Hash) && v.Source == vote.Source {
+			votes = append(votes, v)
+		}
+	}
+	if g.hasQuorum(len(votes)) {
+		g.finalize(&Justification{Height: vote.Height, Hash: vote.Hash, Votes: votes})
+	}
+	return nil
+}
+
+// equivocate records the conflicting votes of a validator
+func (g *FinalityGadget) equivocate(first, second *Vote) error {
+	g.equivocations = append(g.equivocations, Equivocation{First: first, Second: second})
+	return fmt.Errorf("%w: %x at height %d", ErrConflictingVote, second.Validator, second.Height)
+}
+
+// checkSource checks that a vote above the final checkpoints extends the
+// last one. A vote skipping a final checkpoint its validator voted for is
+// an equivocation.
+func (g *FinalityGadget) checkSource(vote *Vote) error {
+	last := g.Finalized()
+	if last == nil && vote.Source == 0 {
+		return nil
+	}
+	if last != nil && vote.Source == last.Height && bytes.Equal(vote.SourceHash, last.Hash) {
+		return nil
+	}
+	for _, j := range g.finalized {
+		if j.Height <= vote.Source {
+			continue
+		}
+		for _, v := range j.Votes {
+			if bytes.Equal(v.Validator, vote.Validator) {
+				return g.equivocate(v, vote)
+			}
+		}
+	}
+	return fmt.Errorf("%w: source at height %d", ErrNotFinalSource, vote.Source)
+}
+
+// checkAncestry checks that a checkpoint block on the chain descends from
+// the source of the vote. A block not on the chain cannot be checked: the
+// blockchain then relies on checkBlock and checkFork, which keep it from
+// connecting a checkpoint block other than the final one.
+func checkAncestry(chain *Blockchain, vote *Vote) error {
+	height := chain.heightOf(vote.Hash)
+	if height < 0 {
+		return nil
+	}
+	if height != vote.Height {
+		return fmt.Errorf("%w: block %x is at height %d", ErrInvalidVote, vote.Hash, height)
+	}
+	if vote.SourceHash != nil && !bytes.Equal(chain.blocks[vote.Source].Hash, vote.SourceHash) {
+		return fmt.Errorf("%w: block %x does not descend from the source at height %d", ErrInvalidVote, vote.Hash, vote.Source)
+	}
+	return nil
+}
+
+// verifyVote checks that the vote is a checkpoint vote signed by a validator
+func (g *FinalityGadget) verifyVote(vote *Vote) error {
+	if !g.validators[hex.EncodeToString(vote.Validator)] {
+		return fmt.Errorf("%w: %x", ErrNotValidator, vote.Validator)
+	}
+	if !g.IsCheckpoint(vote.Height) || len(vote.Hash) != 32 {
+		return ErrInvalidVote
+	}
+	validSource := vote.Source == 0 && vote.SourceHash == nil ||
+		g.IsCheckpoint(vote.Source) && len(vote.SourceHash) == 32
+	if !validSource || vote.Source >= vote.Height {
+		return ErrInvalidVote
+	}
+	curve := ActiveChainParams.KeyType.Curve()
+	pubKey, err := parsePubKey(curve, vote.Validator)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVote, err)
+	}
+	r, s, err := parseSignatureDER(curve, vote.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVote, err)
+	}
+	if !ecdsa.Verify(pubKey, vote.hash(), r, s) {
+		return ErrInvalidVote
+	}
+	return nil
+}
+
+// hasQuorum checks whether count validators are more than two thirds
+func (g *FinalityGadget) hasQuorum(count int) bool {
+	return 3*count > 2*len(g.validators)
+}
+
+// finalize makes the checkpoint of the justification final, the votes at
+// lower heights are settled
+func (g *FinalityGadget) finalize(j *Justification) {
+	g.finalized = append(g.finalized, j)
+	for height := range g.votes {
+		if height <= j.Height {
+			delete(g.votes, height)
+		}
+	}
+}
+
+// hash returns the message signed by the validator
+func (vote *Vote) hash() []byte {
+	data := binary.BigEndian.AppendUint64([]byte("finality"), uint64(vote.Height))
+	data = append(data, vote.Hash...)
+	data = binary.BigEndian.AppendUint64(data, uint64(vote.Source))
+	hash := sha256.Sum256(append(data, vote.SourceHash...))
+	return hash[:]
+}
+
+// checkFork checks that keeping the blocks of the chain up to height, and
+// disconnecting the others, leaves every final checkpoint of the chain in it
+func (g *FinalityGadget) checkFork(chain *Blockchain, height int) error {
+	for _, j := range g.finalized {
+		if j.Height <= height || j.Height > chain.Height() {
+			continue
+		}
+		if bytes.Equal(chain.blocks[j.Height].Hash, j.Hash) {
+			return fmt.Errorf("%w at height %d", ErrFinalizedBlock, j.Height)
+		}
+	}
+	return nil
+}
+
+// checkBlock checks that a block connected at height is the final
+// checkpoint when at its height
+func (g *FinalityGadget) checkBlock(height int, block *Block) error {
+	for _, j := range g.finalized {
+		if j.Height == height && !bytes.Equal(block.Hash, j.Hash) {
+			return fmt.Errorf("%w at height %d", ErrFinalizedBlock, j.Height)
+		}
+	}
+	return nil
+}
+
+// Save writes the justifications of every final checkpoint to a file
+func (g *FinalityGadget) Save(path string) error {
+	if len(g.finalized) == 0 {
+		return nil
+	}
+	return writeGobFile(path, justificationMagic, g.finalized)
+}
+
+// Load reads the justifications saved by Save, verifying their votes against
+// the validators. A missing file leaves no checkpoint final. The checkpoints
+// above the last final one are finalized in order, each extending the one
+// before it; the file is rejected as a whole otherwise.
+func (g *FinalityGadget) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, justificationMagic) {
+		return ErrInvalidJustificationFile
+	}
+	var saved []*Justification
+	dec := gob.NewDecoder(bytes.NewReader(data[len(justificationMagic):]))
+	if err := dec.Decode(&saved); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJustificationFile, err)
+	}
+	last := g.Finalized()
+	var loaded []*Justification
+	for _, j := range saved {
+		if err := g.VerifyJustification(j); err != nil {
+			return err
+		}
+		if err := g.checkBlock(j.Height, &Block{Hash: j.Hash}); err != nil {
+			return err
+		}
+		if last != nil && j.Height <= last.Height {
+			continue
+		}
+		source := j.Votes[0]
+		if last == nil && source.Source != 0 ||
+			last != nil && (source.Source != last.Height || !bytes.Equal(source.SourceHash, last.Hash)) {
+			return fmt.Errorf("%w: source at height %d", ErrNotFinalSource, source.Source)
+		}
+		loaded = append(loaded, j)
+		last = j
+	}
+	for _, j := range loaded {
+		g.finalize(j)
+	}
+	return nil
+}
+
+// VerifyJustification checks that more than two thirds of the validators
+// voted for the checkpoint, extending the same final checkpoint
+func (g *FinalityGadget) VerifyJustification(j *Justification) error {
+	voters := make(map[string]bool)
+	for _, vote := range j.Votes {
+		if vote.Height != j.Height || !bytes.Equal(vote.Hash, j.Hash) {
+			return ErrInvalidVote
+		}
+		if source := j.Votes[0]; vote.Source != source.Source || !bytes.Equal(vote.SourceHash, source.SourceHash) {
+			return ErrInvalidVote
+		}
+		if err := g.verifyVote(vote); err != nil {
+			return err
+		}
+		voters[hex.EncodeToString(vote.Validator)] = true
+	}
+	if !g.hasQuorum(len(voters)) {
+		return ErrInsufficientJustification
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFinalityChain creates a blockchain of 3 blocks after the genesis
+// block, with 4 validators voting every 2 blocks
+func newTestFinalityChain(t *testing.T) (*Blockchain, *FinalityGadget, []*ecdsa.PrivateKey) {
+	var keys []*ecdsa.PrivateKey
+	var validators [][]byte
+	for i := 0; i < 4; i++ {
+		key, pubKey := newKeyPair()
+		keys = append(keys, &key)
+		validators = append(validators, pubKey)
+	}
+	g := NewFinalityGadget(validators, 2)
+	useChainParams(t, &ChainParams{Name: "final", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: NewProofOfWorkEngine(1), Finality: g})
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	for _, b := range newTestBranch(t, bc, bc.GetGenesisBlock(), "final", 3) {
+		assert.Nil(t, bc.ConnectBlock(b))
+	}
+	return bc, g, keys
+}
+
+// finalizeTestCheckpoint makes 3 of the 4 validators vote for the block at
+// height
+func finalizeTestCheckpoint(t *testing.T, bc *Blockchain, g *FinalityGadget, keys []*ecdsa.PrivateKey, height int) {
+	for _, key := range keys[:3] {
+		g.Authorize(key)
+		_, err := g.SignVote(bc, height)
+		assert.Nil(t, err)
+	}
+}
+
+func TestFinalityVotes(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+
+	for _, key := range keys[:2] {
+		g.Authorize(key)
+		_, err := g.SignVote(bc, 2)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, g.Finalized(), "2 votes of 4 are not enough")
+	g.Authorize(keys[2])
+	vote, err := g.SignVote(bc, 2)
+	assert.Nil(t, err)
+	j := g.Finalized()
+	if j == nil {
+		t.Fatal("the checkpoint is not final")
+	}
+	assert.Equal(t, 2, j.Height)
+	assert.Equal(t, bc.blocks[2].Hash, j.Hash)
+	assert.Equal(t, 3, len(j.Votes))
+	assert.Nil(t, g.VerifyJustification(j))
+	assert.Nil(t, g.AddVote(bc, vote), "a vote is added once")
+
+	_, err = g.SignVote(bc, 3)
+	assert.ErrorIs(t, err, ErrInvalidVote, "3 is not a checkpoint")
+	_, err = g.SignVote(bc, 4)
+	assert.ErrorIs(t, err, ErrInvalidVote, "4 is not in the chain")
+
+	forged := *vote
+	forged.Height = 4
+	assert.ErrorIs(t, g.AddVote(bc, &forged), ErrInvalidVote)
+	outsider, outsiderPubKey := newKeyPair()
+	other := NewFinalityGadget([][]byte{outsiderPubKey}, 2)
+	other.Authorize(&outsider)
+	outsiderVote, err := other.SignVote(bc, 2)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, g.AddVote(bc, outsiderVote), ErrNotValidator)
+	g.Authorize(nil)
+	_, err = g.SignVote(bc, 2)
+	assert.ErrorIs(t, err, ErrNotValidator)
+}
+
+func TestFinalityConflictingVotes(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+	finalizeTestCheckpoint(t, bc, g, keys, 2)
+	fork := &Blockchain{blocks: []*Block{bc.blocks[0], bc.blocks[1], {Hash: make([]byte, 32)}}}
+
+	// against the final checkpoint
+	g.Authorize(keys[0])
+	_, err := g.SignVote(fork, 2)
+	assert.ErrorIs(t, err, ErrConflictingVote)
+	// the vote of a validator not in the justification cannot conflict with it
+	g.Authorize(keys[3])
+	_, err = g.SignVote(fork, 2)
+	assert.Nil(t, err)
+
+	evidence := g.Equivocations()
+	assert.Equal(t, 1, len(evidence))
+	assert.Equal(t, bc.blocks[2].Hash, evidence[0].First.Hash)
+	assert.Equal(t, fork.blocks[2].Hash, evidence[0].Second.Hash)
+	assert.Equal(t, evidence[0].First.Validator, evidence[0].Second.Validator)
+}
+
+func TestFinalityConflictingPendingVotes(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+	for _, b := range newTestBranch(t, bc, bc.CurrentBlock(), "next", 1) {
+		assert.Nil(t, bc.ConnectBlock(b))
+	}
+	fork := &Blockchain{blocks: append(bc.blocks[:4:4], &Block{Hash: make([]byte, 32)})}
+
+	g.Authorize(keys[0])
+	_, err := g.SignVote(bc, 4)
+	assert.Nil(t, err)
+	_, err = g.SignVote(fork, 4)
+	assert.ErrorIs(t, err, ErrConflictingVote)
+	assert.Equal(t, 1, len(g.Equivocations()))
+
+	// the conflicting vote is not counted
+	for _, key := range keys[1:3] {
+		g.Authorize(key)
+		_, err = g.SignVote(fork, 4)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, g.Finalized())
+}
+
+func TestFinalityRefusesReorg(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+	finalizeTestCheckpoint(t, bc, g, keys, 2)
+
+	// a branch with more work cannot disconnect the final block
+	_, err := bc.Reorganize(newTestBranch(t, bc, bc.blocks[1], "longer", 4))
+	assert.ErrorIs(t, err, ErrFinalizedBlock)
+	assert.Equal(t, 3, bc.Height())
+
+	// after it, it can
+	branch := newTestBranch(t, bc, bc.blocks[2], "after", 2)
+	_, err = bc.Reorganize(branch)
+	assert.Nil(t, err)
+	assert.Equal(t, branch[1], bc.CurrentBlock())
+
+	_, err = bc.DisconnectTip()
+	assert.Nil(t, err)
+	_, err = bc.DisconnectTip()
+	assert.Nil(t, err)
+	_, err = bc.DisconnectTip()
+	assert.ErrorIs(t, err, ErrFinalizedBlock)
+	assert.Equal(t, 2, bc.Height())
+
+	// a chain behind the final checkpoint only connects it
+	behind := &Blockchain{blocks: bc.blocks[:2:2], engine: bc.engine, finality: g}
+	other := newTestBranch(t, behind, behind.CurrentBlock(), "other", 1)
+	assert.ErrorIs(t, behind.ConnectBlock(other[0]), ErrFinalizedBlock)
+	assert.Nil(t, behind.ConnectBlock(bc.blocks[2]))
+}
+
+// writeTestJustifications saves the justifications as Save does
+func writeTestJustifications(t *testing.T, path string, justifications ...*Justification) {
+	var buff bytes.Buffer
+	buff.Write(justificationMagic)
+	assert.Nil(t, gob.NewEncoder(&buff).Encode(justifications))
+	assert.Nil(t, os.WriteFile(path, buff.Bytes(), 0600))
+}
+
+func TestFinalityPersist(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+	for _, b := range newTestBranch(t, bc, bc.CurrentBlock(), "next", 1) {
+		assert.Nil(t, bc.ConnectBlock(b))
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "justification.dat")
+	assert.Nil(t, g.Save(path))
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "nothing is final")
+
+	// every final checkpoint is saved
+	finalizeTestCheckpoint(t, bc, g, keys, 2)
+	finalizeTestCheckpoint(t, bc, g, keys, 4)
+	assert.Nil(t, g.Save(path))
+	assert.Nil(t, g.Save(path), "the saved justifications are replaced")
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "no temporary file is left behind")
+	var validators [][]byte
+	for _, key := range keys {
+		validators = append(validators, pubKeyToByte(key.PublicKey))
+	}
+	loaded := NewFinalityGadget(validators, 2)
+	assert.Nil(t, loaded.Load(path))
+	assert.Equal(t, g.finalized, loaded.finalized)
+	assert.Nil(t, loaded.Load(path), "the checkpoints already final are kept")
+	assert.Equal(t, g.finalized, loaded.finalized)
+
+	// each checkpoint extends the one before it
+	writeTestJustifications(t, path, g.finalized[1])
+	assert.ErrorIs(t, NewFinalityGadget(validators, 2).Load(path), ErrNotFinalSource)
+	partial := NewFinalityGadget(validators, 2)
+	writeTestJustifications(t, path, g.finalized[0])
+	assert.Nil(t, partial.Load(path))
+	writeTestJustifications(t, path, g.finalized...)
+	assert.Nil(t, partial.Load(path))
+	assert.Equal(t, g.finalized, partial.finalized)
+
+	// the votes are verified
+	writeTestJustifications(t, path, g.finalized...)
+	assert.ErrorIs(t, NewFinalityGadget(validators[1:], 2).Load(path), ErrNotValidator)
+	j := *g.finalized[1]
+	j.Votes = j.Votes[:2]
+	writeTestJustifications(t, path, g.finalized[0], &j)
+	fresh := NewFinalityGadget(validators, 2)
+	assert.ErrorIs(t, fresh.Load(path), ErrInsufficientJustification)
+	assert.Nil(t, fresh.Finalized(), "nothing is loaded from an invalid file")
+
+	assert.Nil(t, os.WriteFile(path, []byte("justification"), 0600))
+	assert.ErrorIs(t, loaded.Load(path), ErrInvalidJustificationFile)
+	assert.Nil(t, NewFinalityGadget(validators, 2).Load(filepath.Join(t.TempDir(), "missing.dat")))
+}
+
+func TestFinalityExtendsFinalCheckpoint(t *testing.T) {
+	bc, g, keys := newTestFinalityChain(t)
+	for _, b := range newTestBranch(t, bc, bc.CurrentBlock(), "next", 1) {
+		assert.Nil(t, bc.ConnectBlock(b))
+	}
+	finalizeTestCheckpoint(t, bc, g, keys, 2)
+	var validators [][]byte
+	for _, key := range keys {
+		validators = append(validators, pubKeyToByte(key.PublicKey))
+	}
+
+	// a vote skipping the final checkpoint its validator voted for is an
+	// equivocation
+	unaware := NewFinalityGadget(validators, 2)
+	unaware.Authorize(keys[0])
+	skipping, err := unaware.SignVote(bc, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, skipping.Source)
+	assert.ErrorIs(t, g.AddVote(bc, skipping), ErrConflictingVote)
+	evidence := g.Equivocations()
+	assert.Equal(t, 1, len(evidence))
+	assert.Equal(t, 2, evidence[0].First.Height)
+	assert.Equal(t, skipping, evidence[0].Second)
+	// from another validator, it is only rejected
+	unaware.Authorize(keys[3])
+	skipping, err = unaware.SignVote(bc, 4)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, g.AddVote(bc, skipping), ErrNotFinalSource)
+	assert.Equal(t, 1, len(g.Equivocations()))
+
+	// a checkpoint not descending from the final one is not voted for
+	fork := &Blockchain{blocks: []*Block{bc.blocks[0], bc.blocks[1], {Hash: make([]byte, 32)}, bc.blocks[3], bc.blocks[4]}}
+	g.Authorize(keys[1])
+	_, err = g.SignVote(fork, 4)
+	assert.ErrorIs(t, err, ErrFinalizedBlock)
+	// nor is a vote for it added when the chain holds another source
+	vote := &Vote{Height: 4, Hash: bc.blocks[4].Hash, Source: 2, SourceHash: bc.blocks[2].Hash, Validator: pubKeyToByte(keys[1].PublicKey)}
+	r, s := signRFC6979(keys[1], vote.hash())
+	vote.Signature = encodeSignatureDER(r, normalizeS(keys[1].Curve, s))
+	assert.ErrorIs(t, g.AddVote(fork, vote), ErrInvalidVote)
+	assert.Nil(t, g.AddVote(bc, vote))
+
+	finalizeTestCheckpoint(t, bc, g, keys, 4)
+	j := g.Finalized()
+	assert.Equal(t, 4, j.Height)
+	for _, vote := range j.Votes {
+		assert.Equal(t, 2, vote.Source)
+		assert.Equal(t, bc.blocks[2].Hash, vote.SourceHash)
+	}
+	assert.Nil(t, g.VerifyJustification(j))
+
+	// every final checkpoint is kept, even when the last one is beyond the
+	// tip
+	behind := &Blockchain{blocks: bc.blocks[:4:4], engine: bc.engine, finality: g}
+	_, err = behind.Reorganize(newTestBranch(t, behind, behind.blocks[1], "longer", 4))
+	assert.ErrorIs(t, err, ErrFinalizedBlock)
+	assert.Equal(t, 3, behind.Height())
+}
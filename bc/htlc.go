@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// HTLCSecretSize is the size in bytes of the secrets generated by NewHTLCSecret
+const HTLCSecretSize = 32
+
+var (
+	ErrNotHTLC           = errors.New("output is not a hash time-locked contract")
+	ErrInvalidPreimage   = errors.New("preimage does not match the secret hash")
+	ErrInvalidSecretHash = errors.New("secret hash is not a sha256 hash")
+	ErrInvalidHTLCOwner  = errors.New("hash time-locked contract cannot be spent with this key")
+	ErrPreimageNotFound  = errors.New("preimage not found")
+)
+
+// HTLC represents the conditions of a hash time-locked contract output.
+// The receiver can claim the output by revealing the preimage of the SecretHash,
+// or the sender can take it back once the chain reaches the LockHeight.
+type HTLC struct {
+	SecretHash         []byte // sha256 hash of the secret that unlocks the claim path
+	ReceiverPubKeyHash []byte // The owner of the claim path
+	SenderPubKeyHash   []byte // The owner of the refund path
+	LockHeight         int    // The block height from which the refund path can be used
+}
+
+// NewHTLCSecret generates a random secret and returns it together with its hash
+func NewHTLCSecret() ([]byte, []byte, error) {
+	secret := make([]byte, HTLCSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	secretHash := sha256.Sum256(secret)
+	return secret, secretHash[:], nil
+}
+
+// CanClaim checks if the owner of the pubKey can claim the output with the given preimage
+func (h *HTLC) CanClaim(pubKey, preimage []byte) bool {
+	secretHash := sha256.Sum256(preimage)
+	return bytes.Equal(secretHash[:], h.SecretHash) && bytes.Equal(HashPubKey(pubKey), h.ReceiverPubKeyHash)
+}
+
+// CanRefund checks if the owner of the pubKey can take the output back
+// in a transaction with the given lock time
+func (h *HTLC) CanRefund(pubKey []byte, lockTime int) bool {
+	return lockTime >= h.LockHeight && bytes.Equal(HashPubKey(pubKey), h.SenderPubKeyHash)
+}
+
+// CanSpend checks if the input satisfies either the claim or the refund path
+// An input revealing a preimage always takes the claim path
+func (h *HTLC) CanSpend(in TXInput, lockTime int) bool {
+	if in.Preimage != nil {
+		return h.CanClaim(in.PubKey, in.Preimage)
+	}
+	return h.CanRefund(in.PubKey, lockTime)
+}
+
+func (h HTLC) String() string {
+	return fmt.Sprintf("{secret hash: %x, receiver: %x, sender: %x, lock height: %d}",
+		h.SecretHash, h.ReceiverPubKeyHash, h.SenderPubKeyHash, h.LockHeight)
+}
+
+// NewHTLCTransaction creates a transaction locking amount coins in a contract
+// that the address "to" can claim with the secret of secretHash, or that the
+// sender can refund from lockHeight on.
+// NOTE: The returned tx is NOT signed!
+func NewHTLCTransaction(pubKey []byte, to string, amount int, secretHash []byte, lockHeight int, utxos UTXOSet) (*Transaction, error) {
+	if len(secretHash) != sha256.Size {
+		return nil, ErrInvalidSecretHash
+	}
+	txn, err := NewUTXOTransaction(pubKey, to, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	txn.Vout[0] = TXOutput{
+		Value: amount,
+		HTLC: &HTLC{
+			SecretHash:         secretHash,
+			ReceiverPubKeyHash: GetPubKeyHashFromAddress(to),
+			SenderPubKeyHash:   HashPubKey(pubKey),
+			LockHeight:         lockHeight,
+		},
+	}
+	txn.ID = txn.Hash()
+	return txn, nil
+}
+
+// NewHTLCClaimTransaction creates a transaction that pays the contract output
+// identified by txID and outIdx to the receiver, revealing the preimage.
+// NOTE: The returned tx is NOT signed!
+func NewHTLCClaimTransaction(pubKey []byte, txID []byte, outIdx int, preimage []byte, utxos UTXOSet) (*Transaction, error) {
+	out, err := findHTLCOutput(utxos, txID, outIdx)
+	if err != nil {
+		return nil, err
+	}
+	secretHash := sha256.Sum256(preimage)
+	if !bytes.Equal(secretHash[:], out.HTLC.SecretHash) {
+		return nil, ErrInvalidPreimage
+	}
+	if !out.HTLC.CanClaim(pubKey, preimage) {
+		return nil, ErrInvalidHTLCOwner
+	}
+	txin := TXInput{Txid: txID, OutIdx: outIdx, PubKey: pubKey, Preimage: preimage}
+	txout := TXOutput{Value: out.Value, PubKeyHash: HashPubKey(pubKey)}
+	txn := &Transaction{Vin: []TXInput{txin}, Vout: []TXOutput{txout}}
+	txn.ID = txn.Hash()
+	return txn, nil
+}
+
+// NewHTLCRefundTransaction creates a transaction that pays the contract output
+// identified by txID and outIdx back to the sender. The transaction is only
+// valid in blocks from the contract lock height on.
+// NOTE: The returned tx is NOT signed!
+func NewHTLCRefundTransaction(pubKey []byte, txID []byte, outIdx int, utxos UTXOSet) (*Transaction, error) {
+	out, err := findHTLCOutput(utxos, txID, outIdx)
+	if err != nil {
+		return nil, err
+	}
+	if !out.HTLC.CanRefund(pubKey, out.HTLC.LockHeight) {
+		return nil, ErrInvalidHTLCOwner
+	}
+	txin := TXInput{Txid: txID, OutIdx: outIdx, PubKey: pubKey}
+	txout := TXOutput{Value: out.Value, PubKeyHash: HashPubKey(pubKey)}
+	txn := &Transaction{Vin: []TXInput{txin}, Vout: []TXOutput{txout}, LockTime: out.HTLC.LockHeight}
+	txn.ID = txn.Hash()
+	return txn, nil
+}
+
+// FindHTLCPreimage searches the blockchain for a claim that revealed the
+// preimage of secretHash. In an atomic swap, the party that did not
+// generate the secret uses it to claim the counterpart contract.
+func (bc Blockchain) FindHTLCPreimage(secretHash []byte) ([]byte, error) {
+	for _, b := range bc.blocks {
+		for _, t := range b.Transactions {
+			for _, in := range t.Vin {
+				if in.Preimage == nil {
+					continue
+				}
+				h := sha256.Sum256(in.Preimage)
+				if bytes.Equal(h[:], secretHash) {
+					return in.Preimage, nil
+				}
+			}
+		}
+	}
+	return nil, ErrPreimageNotFound
+}
+
+func findHTLCOutput(utxos UTXOSet, txID []byte, outIdx int) (TXOutput, error) {
+	out, ok := utxos[fmt.Sprintf("%x", txID)][outIdx]
+	if !ok {
+		return TXOutput{}, ErrTxInputNotFound
+	}
+	if !out.IsHTLC() {
+		return TXOutput{}, ErrNotHTLC
+	}
+	return out, nil
+}
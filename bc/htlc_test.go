@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAddressUser1 = "13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug"
+	testAddressUser2 = "1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs"
+)
+
+// newTestHTLC creates a blockchain where user1 locked 6 coins in a contract
+// for user2 that can be refunded from lockHeight on
+func newTestHTLC(t *testing.T, secretHash []byte, lockHeight int) (*Blockchain, *Transaction) {
+	bc, err := NewBlockchain(testAddressUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	htlcTx, err := NewHTLCTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 6, secretHash, lockHeight, bc.FindUTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, bc.SignTransaction(htlcTx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "htlc")
+	_, err = bc.MineBlock([]*Transaction{cbTx, htlcTx})
+	assert.Nil(t, err)
+	return bc, htlcTx
+}
+
+func TestNewHTLCSecret(t *testing.T) {
+	secret, secretHash, err := NewHTLCSecret()
+	assert.Nil(t, err)
+	assert.Equal(t, HTLCSecretSize, len(secret))
+	expectedHash := sha256.Sum256(secret)
+	assert.Equal(t, expectedHash[:], secretHash)
+}
+
+func TestNewHTLCTransaction(t *testing.T) {
+	secret, secretHash, _ := NewHTLCSecret()
+	_, htlcTx := newTestHTLC(t, secretHash, 10)
+
+	out := htlcTx.Vout[0]
+	if !out.IsHTLC() {
+		t.Fatal("expected the first output to be a hash time-locked contract")
+	}
+	assert.Equal(t, 6, out.Value)
+	assert.Nil(t, out.PubKeyHash)
+	assert.Equal(t, GetPubKeyHashFromAddress(testAddressUser2), out.HTLC.ReceiverPubKeyHash)
+	assert.Equal(t, GetPubKeyHashFromAddress(testAddressUser1), out.HTLC.SenderPubKeyHash)
+	assert.Equal(t, 10, out.HTLC.LockHeight)
+	assert.True(t, out.HTLC.CanClaim(Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882"), secret))
+
+	// the change goes back to the sender
+	assert.Equal(t, BlockReward-6, htlcTx.Vout[1].Value)
+
+	// the secret hash must be a sha256 hash
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	_, err := NewHTLCTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 6, secretHash[:16], 10, UTXOSet{})
+	assert.ErrorIs(t, err, ErrInvalidSecretHash)
+}
+
+func TestHTLCClaim(t *testing.T) {
+	secret, secretHash, _ := NewHTLCSecret()
+	bc, htlcTx := newTestHTLC(t, secretHash, 10)
+	utxos := bc.FindUTXOSet()
+	privKey2, pubKey2 := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+
+	// Reject a wrong preimage
+	_, err := NewHTLCClaimTransaction(pubKeyToByte(*pubKey2), htlcTx.ID, 0, []byte("wrong secret"), utxos)
+	assert.ErrorIs(t, err, ErrInvalidPreimage)
+
+	// Reject a claim from someone other than the receiver
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	_, err = NewHTLCClaimTransaction(pubKeyToByte(*pubKey1), htlcTx.ID, 0, secret, utxos)
+	assert.ErrorIs(t, err, ErrInvalidHTLCOwner)
+
+	// Reject outputs that are not contracts
+	_, err = NewHTLCClaimTransaction(pubKeyToByte(*pubKey2), htlcTx.ID, 1, secret, utxos)
+	assert.ErrorIs(t, err, ErrNotHTLC)
+
+	claimTx, err := NewHTLCClaimTransaction(pubKeyToByte(*pubKey2), htlcTx.ID, 0, secret, utxos)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(claimTx, *privKey2))
+	assert.Equal(t, secret, claimTx.Vin[0].Preimage)
+
+	prevTXs, _ := bc.GetInputTXsOf(claimTx)
+	assert.Nil(t, claimTx.Verify(prevTXs))
+
+	// A claim with a tampered preimage must not verify
+	claimTx.Vin[0].Preimage = []byte("wrong secret")
+	assert.ErrorIs(t, claimTx.Verify(prevTXs), ErrBadSignature)
+	claimTx.Vin[0].Preimage = secret
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "claim")
+	_, err = bc.MineBlock([]*Transaction{cbTx, claimTx})
+	assert.Nil(t, err)
+
+	// The sender learns the secret from the chain
+	preimage, err := bc.FindHTLCPreimage(secretHash)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, preimage)
+}
+
+func TestHTLCRefund(t *testing.T) {
+	_, secretHash, _ := NewHTLCSecret()
+	bc, htlcTx := newTestHTLC(t, secretHash, 3)
+	utxos := bc.FindUTXOSet()
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+
+	// Only the sender can refund
+	_, pubKey2 := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	_, err := NewHTLCRefundTransaction(pubKeyToByte(*pubKey2), htlcTx.ID, 0, utxos)
+	assert.ErrorIs(t, err, ErrInvalidHTLCOwner)
+
+	refundTx, err := NewHTLCRefundTransaction(pubKeyToByte(*pubKey1), htlcTx.ID, 0, utxos)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, refundTx.LockTime)
+	assert.Nil(t, bc.SignTransaction(refundTx, *privKey1))
+
+	prevTXs, _ := bc.GetInputTXsOf(refundTx)
+	assert.Nil(t, refundTx.Verify(prevTXs))
+
+	// The refund is not final before the lock height
+	assert.Equal(t, 1, bc.Height())
+	assert.ErrorIs(t, bc.VerifyTransaction(refundTx), ErrNonFinal)
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "wait")
+	_, err = bc.MineBlock([]*Transaction{cbTx})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.VerifyTransaction(refundTx))
+
+	// Lowering the lock time invalidates the refund path
+	refundTx.LockTime = 2
+	refundTx.ID = refundTx.Hash()
+	assert.ErrorIs(t, refundTx.Verify(prevTXs), ErrBadSignature)
+}
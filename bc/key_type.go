@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// KeyType identifies the elliptic curve of the keys used to sign transactions
+type KeyType int
+
+const (
+	// KeyTypeP256 uses the NIST P-256 curve
+	KeyTypeP256 KeyType = iota
+	// KeyTypeSecp256k1 uses the secp256k1 curve, as Bitcoin does
+	KeyTypeSecp256k1
+)
+
+var (
+	ErrUnknownKeyType  = errors.New("unknown key type")
+	ErrKeyTypeMismatch = errors.New("key type does not match the chain parameters")
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveS256 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+const (
+	ecPrivKeyVersion   = 1
+	secp256k1ScalarLen = 32
+)
+
+// Curve returns the elliptic curve of the key type
+func (k KeyType) Curve() elliptic.Curve {
+	switch k {
+	case KeyTypeSecp256k1:
+		return S256()
+	default:
+		return elliptic.P256()
+	}
+}
+
+func (k KeyType) String() string {
+	switch k {
+	case KeyTypeP256:
+		return "P-256"
+	case KeyTypeSecp256k1:
+		return "secp256k1"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseKeyType returns the key type with the given name
+func ParseKeyType(name string) (KeyType, error) {
+	for _, k := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		if k.String() == name {
+			return k, nil
+		}
+	}
+	return 0, ErrUnknownKeyType
+}
+
+// crypto/x509 only knows the NIST curves, so secp256k1 keys are encoded with
+// the same SEC1 and PKIX structures by hand.
+
+// ecPrivateKey is the SEC1 (RFC 5915) private key structure
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkixPublicKey is the SubjectPublicKeyInfo (RFC 5280) structure
+type pkixPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func marshalS256PrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	return asn1.Marshal(ecPrivateKey{
+		Version:       ecPrivKeyVersion,
+		PrivateKey:    key.D.FillBytes(make([]byte, secp256k1ScalarLen)),
+		NamedCurveOID: oidNamedCurveS256,
+		PublicKey:     asn1.BitString{Bytes: elliptic.Marshal(key.Curve, key.X, key.Y)},
+	})
+}
+
+// parseS256PrivateKey parses a SEC1 private key, returning nil if the key is
+// not on secp256k1
+func parseS256PrivateKey(der []byte) *ecdsa.PrivateKey {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil || !key.NamedCurveOID.Equal(oidNamedCurveS256) {
+		return nil
+	}
+	curve := S256()
+	d := new(big.Int).SetBytes(key.PrivateKey)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil
+	}
+	privKey := &ecdsa.PrivateKey{D: d}
+	privKey.Curve = curve
+	privKey.X, privKey.Y = curve.ScalarBaseMult(key.PrivateKey)
+	return privKey
+}
+
+func marshalS256PublicKey(key *ecdsa.PublicKey) ([]byte, error) {
+	params, err := asn1.Marshal(oidNamedCurveS256)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkixPublicKey{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: elliptic.Marshal(key.Curve, key.X, key.Y)},
+	})
+}
+
+// parseS256PublicKey parses a PKIX public key, returning nil if the key is
+// not on secp256k1
+func parseS256PublicKey(der []byte) *ecdsa.PublicKey {
+	var key pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil || !key.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil
+	}
+	var namedCurve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(key.Algorithm.Parameters.FullBytes, &namedCurve); err != nil || !namedCurve.Equal(oidNamedCurveS256) {
+		return nil
+	}
+	curve := S256()
+	X, Y := elliptic.Unmarshal(curve, key.PublicKey.Bytes)
+	if X == nil {
+		return nil
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: X, Y: Y}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useChainParams activates params until the test ends
+func useChainParams(t *testing.T, params *ChainParams) {
+	previous := ActiveChainParams
+	ActiveChainParams = params
+	t.Cleanup(func() { ActiveChainParams = previous })
+}
+
+func TestParseKeyType(t *testing.T) {
+	for _, k := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		parsed, err := ParseKeyType(k.String())
+		assert.Nil(t, err)
+		assert.Equal(t, k, parsed)
+	}
+	_, err := ParseKeyType("ed25519")
+	assert.ErrorIs(t, err, ErrUnknownKeyType)
+}
+
+func TestEncodeKeyPairOfType(t *testing.T) {
+	for _, k := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		t.Run(k.String(), func(t *testing.T) {
+			privKey, pubKey := newKeyPairOfType(k)
+			assert.True(t, privKey.Curve == k.Curve())
+
+			encPriv, encPub := encodeKeyPair(&privKey, &privKey.PublicKey)
+			decPriv, decPub := decodeKeyPair(encPriv, encPub)
+			assert.True(t, privKey.Equal(decPriv))
+			assert.True(t, privKey.PublicKey.Equal(decPub))
+			assert.Equal(t, pubKey, pubKeyToByte(*decPub))
+		})
+	}
+}
+
+func TestSecp256k1Transaction(t *testing.T) {
+	useChainParams(t, &Secp256k1ChainParams)
+	privKey := *newS256PrivateKey(new(big.Int).SetBytes(Hex2Bytes("b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef")))
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	address := string(GetAddress(pubKey))
+
+	bc, err := NewBlockchain(address)
+	assert.Nil(t, err)
+	tx, err := NewUTXOTransaction(pubKey, testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(tx, privKey))
+	prevTXs, _ := bc.GetInputTXsOf(tx)
+	assert.Nil(t, tx.Verify(prevTXs))
+
+	// P-256 keys cannot sign for a secp256k1 chain
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	assert.ErrorIs(t, bc.SignTransaction(tx, *privKey1), ErrKeyTypeMismatch)
+
+	// the signature is only valid on the curve of the chain
+	ActiveChainParams = &P256ChainParams
+	assert.ErrorIs(t, tx.Verify(prevTXs), ErrBadSignature)
+}
@@ -1,40 +1,88 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 )
 
 var (
-	bc    *Blockchain
-	txns  []*Transaction
-	utxos UTXOSet
+	bc           *Blockchain
+	mempool      *Mempool
+	assembler    *BlockAssembler
+	feeEstimator *FeeEstimator
+	utxos        UTXOSet
+
+	// interrupt receives the interrupt signal, input the lines read from the
+	// standard input
+	interrupt = make(chan os.Signal, 1)
+	input     <-chan string
 )
 
 func main() {
+	chain := flag.String("chain", P256ChainParams.Name, "the chain parameters: p256, secp256k1, scrypt, poa or pos")
+	pow := flag.String("pow", "", "the proof-of-work algorithm replacing the one of the chain parameters: sha256d or scrypt")
+	finality := flag.Int("finality", 0, "the number of blocks between two finality checkpoints, 0 when blocks are never final")
+	flag.Parse()
+	params, err := ParseChainParams(*chain)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if *pow != "" {
+		algorithm, err := ParsePowAlgorithm(*pow)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		custom := *params
+		custom.PowAlgorithm = algorithm
+		params = &custom
+	}
+	ActiveChainParams = params
+
 	utxos = make(UTXOSet)
 	a := CreateIdentities()
 	b := CreateIdentities()
 	c := CreateIdentities()
-	nonce := 0
-	cbReward, err := NewCoinbaseTX(a.address, "COIN Reward"+strconv.Itoa(nonce))
+	// a seals the blocks of a proof-of-authority chain alone
+	if poa, ok := ActiveChainParams.Consensus.(*ProofOfAuthorityEngine); ok {
+		poa.SetSigners([][]byte{a.pubkey})
+		poa.Authorize(&a.pk)
+	}
+	// a stakes the blocks of a proof-of-stake chain
+	if pos, ok := ActiveChainParams.Consensus.(*ProofOfStakeEngine); ok {
+		pos.Authorize(&a.pk)
+	}
+	// a validates the finality checkpoints alone
+	if *finality > 0 {
+		custom := *ActiveChainParams
+		custom.Finality = NewFinalityGadget([][]byte{a.pubkey}, *finality)
+		custom.Finality.Authorize(&a.pk)
+		if err := custom.Finality.Load(JustificationsFile); err != nil {
+			fmt.Println("Could not load the final checkpoints:", err)
+		}
+		ActiveChainParams = &custom
+	}
+	feeEstimator, err = LoadFeeEstimator(FeeEstimatesFile)
 	if err != nil {
-		panic(err)
+		fmt.Println("Could not load the fee estimates:", err)
+		feeEstimator = NewFeeEstimator()
 	}
-	txns = []*Transaction{cbReward}
+	// the interrupt is handled by the main loop, the only one touching the
+	// mempool and the fee estimates
+	signal.Notify(interrupt, os.Interrupt)
+	input = readLines(os.Stdin)
 
 	for {
-		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Please choose the corresponding request number\n")
 		fmt.Print(QUERY)
-		text, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("Plase make sure a blockchain is created and try again!")
-		}
-		text = strings.Trim(text, "\n")
+		text := nextLine()
 		switch text {
 		case "1":
 			if bc != nil {
@@ -45,32 +93,58 @@ func main() {
 			if err != nil {
 				fmt.Println("Could not generate the chain!")
 			}
+			mempool = NewMempool(bc)
+			mempool.AddListener(feeEstimator)
+			assembler = NewBlockAssembler(bc, mempool, string(a.address))
+			if loaded, err := mempool.Load(MempoolFile); err != nil {
+				fmt.Println("Could not load the saved mempool:", err)
+			} else {
+				printLoadResult(loaded)
+			}
 			fmt.Println("New block created, and miner got his reward!")
 			fmt.Println()
 			utxos.Update(bc.GetGenesisBlock().Transactions)
 		case "2":
 			fmt.Println()
-			fmt.Println("We trasnfer the miner's reward from a to b.")
-			txn, err := NewUTXOTransaction(a.pubkey, b.address, BlockReward, utxos)
+			fmt.Println("We trasnfer the miner's reward from a to b, less the relay fee.")
+			txn, err := newPayment(a, b.address, BlockReward-1)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
 			bc.SignTransaction(txn, a.pk)
-			txns = append(txns, txn)
-			fmt.Println("Transfered!")
+			addToMempool(txn, "Transfered!")
 		case "3":
-			_, err = bc.MineBlock(txns)
-			if err != nil {
+			if bc == nil {
 				fmt.Println("Plase make sure a blockchain is created and try again!")
 				continue
 			}
-			utxos.Update(txns)
-			cbReward, err := NewCoinbaseTX(a.address, "COIN Reward"+strconv.Itoa(nonce+1))
+			tmpl, err := assembler.Template()
 			if err != nil {
-				panic(err)
+				fmt.Println(err)
+				continue
+			}
+			block := tmpl.Block()
+			if err = bc.Engine().Seal(context.Background(), bc, block); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if pow, ok := bc.Engine().(*ProofOfWorkEngine); ok {
+				fmt.Printf("Block solved at %.0f hashes per second\n", pow.Miner().Hashrate())
+			}
+			if err = assembler.SubmitBlock(block); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			utxos.Update(block.Transactions)
+			fmt.Printf("Block %x mined with %d transaction(s), the miner got %d!\n", block.Hash, len(tmpl.Transactions), tmpl.CoinbaseValue)
+			if g := ActiveChainParams.Finality; g != nil && g.IsCheckpoint(bc.Height()) {
+				if _, err := g.SignVote(bc, bc.Height()); err != nil {
+					fmt.Println("Could not vote for the checkpoint:", err)
+				} else if j := g.Finalized(); j != nil && j.Height == bc.Height() {
+					fmt.Printf("Checkpoint at height %d is final!\n", j.Height)
+				}
 			}
-			txns = []*Transaction{cbReward}
 		case "4":
 			for i, b := range bc.blocks {
 				fmt.Printf("%d: %s\n", i+1, b.String())
@@ -82,12 +156,7 @@ func main() {
 				fmt.Printf("#%d: Hash: %x\n", i+1, b.Hash)
 			}
 			fmt.Println()
-			userIdx, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("Plase make sure a blockchain is created and try again!")
-				continue
-			}
-			userIdx = strings.Trim(userIdx, "\n")
+			userIdx := nextLine()
 			idxToInt, err := strconv.Atoi(userIdx)
 			if err != nil {
 				fmt.Println("Could not process your request, please try again!")
@@ -105,20 +174,8 @@ func main() {
 				}
 			}
 			fmt.Println()
-			fmt.Println("Your chosen #Block:")
-			bNr, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("Plase make sure a blockchain is created and try again!")
-				continue
-			}
-			fmt.Println("Your chosen #Txn:")
-			txnNr, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("Plase make sure a blockchain is created and try again!")
-				continue
-			}
-			bNr = strings.Trim(bNr, "\n")
-			txnNr = strings.Trim(txnNr, "\n")
+			bNr := readLine("Your chosen #Block:")
+			txnNr := readLine("Your chosen #Txn:")
 			bNrToInt, err := strconv.Atoi(bNr)
 			if err != nil {
 				fmt.Println("Could not process your request, please try again!")
@@ -139,17 +196,15 @@ func main() {
 			fmt.Println()
 		case "7":
 			fmt.Println("We attempt to transfer some coins from c to either b or a.")
-			txn, err := NewUTXOTransaction(c.pubkey, b.address, 2, utxos)
+			txn, err := newPayment(c, b.address, 2)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
-			txns = append(txns, txn)
-			utxos.Update(txns)
-			fmt.Println("Transfered!")
+			addToMempool(txn, "Transfered!")
 		case "8":
 			fmt.Println("We attempt to transfer 5 coins from b to c")
-			txn, err := NewUTXOTransaction(b.pubkey, c.address, 5, utxos)
+			txn, err := newPayment(b, c.address, 5)
 			if err != nil {
 				fmt.Println(err)
 				continue
@@ -159,8 +214,7 @@ func main() {
 				fmt.Println(err)
 				continue
 			}
-			txns = append(txns, txn)
-			fmt.Println("Transfered!")
+			addToMempool(txn, "Transfered!")
 		case "9":
 			a := getBalance(a.address, utxos)
 			b := getBalance(b.address, utxos)
@@ -170,6 +224,171 @@ func main() {
 			fmt.Printf("Balance of address: %s, is: %d\n", c.Address, c.Funds)
 		case "10":
 			fmt.Println(utxos.String())
+		case "11":
+			fmt.Printf("Please enter the data to anchor as hex (at most %d bytes):\n", MaxDataCarrierSize)
+			data, err := hex.DecodeString(nextLine())
+			if err != nil {
+				fmt.Println("The data must be hex encoded, please try again!")
+				continue
+			}
+			txn, err := NewDataCarrierTransaction(a.pubkey, data, utxos)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = bc.SignTransaction(txn, a.pk)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			addToMempool(txn, "Data anchored, it will be on chain with the next block!")
+		case "12":
+			fmt.Println("We create a partially signed transaction from a to b, to be signed offline.")
+			amount, err := strconv.Atoi(readLine("Amount to transfer:"))
+			if err != nil {
+				fmt.Println("Could not process your request, please try again!")
+				continue
+			}
+			path := readLine("File to write the partially signed transaction to:")
+			txn, err := newPayment(a, b.address, amount)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			prevTXs, err := bc.GetInputTXsOf(txn)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			psbt, err := NewPSBT(txn, prevTXs)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if err = psbt.WriteFile(path); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("Partially signed transaction written to %s\n", path)
+		case "13":
+			path := readLine("Partially signed transaction file to sign:")
+			signer, ok := map[string]*Indetity{"a": a, "b": b, "c": c}[readLine("Sign as (a, b or c):")]
+			if !ok {
+				fmt.Println("Unknown identity, please try again!")
+				continue
+			}
+			psbt, err := ReadPSBTFile(path)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			signed, err := psbt.Sign(&signer.pk)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if err = psbt.WriteFile(path); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("Signed %d input(s)!\n", signed)
+		case "14":
+			paths := strings.Fields(readLine("Partially signed transaction files to combine, separated by spaces:"))
+			out := readLine("File to write the combined transaction to:")
+			var psbts []*PSBT
+			for _, path := range paths {
+				psbt, err := ReadPSBTFile(path)
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+				psbts = append(psbts, psbt)
+			}
+			if len(psbts) != len(paths) {
+				continue
+			}
+			combined, err := CombinePSBT(psbts...)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if err = combined.WriteFile(out); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("Combined transaction written to %s\n", out)
+		case "15":
+			psbt, err := ReadPSBTFile(readLine("Partially signed transaction file to finalize:"))
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if err = psbt.Finalize(); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			txn, err := psbt.Extract()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			addToMempool(txn, "Transaction finalized, it will be on chain with the next block!")
+		case "16":
+			if bc == nil {
+				fmt.Println("Plase make sure a blockchain is created and try again!")
+				continue
+			}
+			fmt.Println(mempool.String())
+		case "17":
+			if bc == nil {
+				fmt.Println("Plase make sure a blockchain is created and try again!")
+				continue
+			}
+			block, err := bc.DisconnectTip()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			mempool.BlockDisconnected(block)
+			utxos = bc.FindUTXOSet()
+			fmt.Printf("Block %x disconnected, its transactions are back in the mempool!\n", block.Hash)
+		case "18":
+			if bc == nil {
+				fmt.Println("Plase make sure a blockchain is created and try again!")
+				continue
+			}
+			fmt.Println(mempool.String())
+			txID := Hex2Bytes(readLine("ID of the pending transaction of a to bump:"))
+			changeIdx, err := strconv.Atoi(readLine("Index of the change output (-1 for none):"))
+			if err != nil {
+				fmt.Println("Could not process your request, please try again!")
+				continue
+			}
+			fee, err := strconv.Atoi(readLine("New fee:"))
+			if err != nil {
+				fmt.Println("Could not process your request, please try again!")
+				continue
+			}
+			txn, err := mempool.BumpFee(txID, a.pk, changeIdx, fee)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			addToMempool(txn, "Fee bumped, the new transaction replaces the original!")
+		case "19":
+			shutdown()
+		case "20":
+			target, err := strconv.Atoi(readLine(fmt.Sprintf("Number of blocks to confirm within (1 to %d):", FeeEstimatorMaxTarget)))
+			if err != nil {
+				fmt.Println("Could not process your request, please try again!")
+				continue
+			}
+			rate, err := feeEstimator.EstimateFee(target)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("Estimated fee rate: %d per 1000 bytes\n", rate)
 		default:
 			continue
 		}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTxInMempool     = errors.New("transaction is already in the mempool")
+	ErrMempoolCoinbase = errors.New("a coinbase transaction cannot enter the mempool")
+)
+
+// MempoolEntry is an unconfirmed transaction waiting to be mined
+type MempoolEntry struct {
+	Tx   *Transaction
+	Fee  int       // The value of the inputs not paid to the outputs
+	Size int       // The size in bytes of the serialized transaction
+	Time time.Time // The arrival time
+	seq  int       // The arrival order
+}
+
+// compareFeeRate returns 1 when the entry pays more per byte than other,
+// -1 when it pays less, and 0 otherwise
+func (e *MempoolEntry) compareFeeRate(other *MempoolEntry) int {
+	return compareFeeRates(e.Fee, e.Size, other.Fee, other.Size)
+}
+
+// compareFeeRates compares the fee rates feeA/sizeA and feeB/sizeB
+func compareFeeRates(feeA, sizeA, feeB, sizeB int) int {
+	a, b := feeA*sizeB, feeB*sizeA
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
+
+// MempoolListener is notified of the changes of the mempool, e.g. to
+// estimate fees from the time transactions take to confirm
+type MempoolListener interface {
+	// TxAdded is called when a transaction enters the mempool
+	TxAdded(e *MempoolEntry)
+	// TxRemoved is called when a transaction leaves the mempool, confirmed
+	// or not
+	TxRemoved(e *MempoolEntry)
+	// BlockConnected is called with a new tip, before its transactions
+	// are removed
+	BlockConnected(block *Block)
+	// BlockDisconnected is called with the disconnected tip
+	BlockDisconnected(block *Block)
+}
+
+// Mempool keeps the valid transactions waiting to be included in a block.
+// A transaction may spend the outputs of the chain tip or of other
+// transactions of the mempool, but an output is spent at most once.
+type Mempool struct {
+	bc        *Blockchain
+	entries   map[string]*MempoolEntry // Entries by transaction ID
+	spent     map[string]string        // ID of the transaction spending each outpoint
+	utxos     UTXOSet                  // The outputs of the tip and of the entries left to spend
+	expiry    time.Duration            // The age after which an entry is removed
+	policy    MempoolPolicy
+	listeners []MempoolListener
+	journal   []mempoolChange // The changes not notified to the listeners yet
+	nextSeq   int
+}
+
+// mempoolChange records an entry added to or removed from the mempool, to
+// undo it when a change fails, or to notify the listeners once it succeeds
+type mempoolChange struct {
+	entry *MempoolEntry
+	added bool
+}
+
+// NewMempool creates an empty mempool on top of the blockchain tip
+func NewMempool(bc *Blockchain) *Mempool {
+	mp := &Mempool{bc: bc, expiry: DefaultMempoolExpiry, policy: DefaultMempoolPolicy}
+	mp.reset()
+	return mp
+}
+
+// AddListener registers a listener notified of the mempool changes
+func (mp *Mempool) AddListener(l MempoolListener) {
+	mp.listeners = append(mp.listeners, l)
+}
+
+// SetPolicy sets the rules transactions must follow to enter the mempool.
+// The current entries are kept.
+func (mp *Mempool) SetPolicy(policy MempoolPolicy) {
+	mp.policy = policy
+}
+
+// SetExpiry sets the age after which the entries are removed
+func (mp *Mempool) SetExpiry(expiry time.Duration) {
+	mp.expiry = expiry
+}
+
+func (mp *Mempool) reset() {
+	mp.entries = make(map[string]*MempoolEntry)
+	mp.spent = make(map[string]string)
+	mp.utxos = mp.bc.FindUTXOSet()
+}
+
+// Add validates the transaction against the tip, the mempool and the
+// policy, and adds it. A transaction spending the same outputs as mempool
+// entries replaces them when it pays more. The transactions paying the
+// lowest fee rate are evicted when the mempool is full.
+// The returned error explains why the transaction is rejected.
+func (mp *Mempool) Add(tx *Transaction) error {
+	defer mp.commit()
+	return mp.tryAdd(tx)
+}
+
+// tryAdd adds the transaction as Add does, leaving the listeners to be
+// notified by the caller
+func (mp *Mempool) tryAdd(tx *Transaction) error {
+	mark := len(mp.journal)
+	if err := mp.add(tx, true); err != nil {
+		return err
+	}
+	if err := mp.trim([]*Transaction{tx}); err != nil {
+		mp.rollback(mark)
+		return err
+	}
+	return nil
+}
+
+// add adds the transaction as Add does, without making room for it.
+// The fee rate is checked by the caller when checkFeeRate is false.
+func (mp *Mempool) add(tx *Transaction, checkFeeRate bool) error {
+	if tx.IsCoinbase() {
+		return ErrMempoolCoinbase
+	}
+	if mp.Has(tx.ID) {
+		return ErrTxInMempool
+	}
+	if conflicts := mp.conflicts(tx); len(conflicts) > 0 {
+		return mp.replace(tx, conflicts, checkFeeRate)
+	}
+	return mp.accept(tx, checkFeeRate)
+}
+
+// addAt adds the transaction as tryAdd does, keeping an earlier arrival time
+func (mp *Mempool) addAt(tx *Transaction, arrival time.Time) error {
+	if err := mp.tryAdd(tx); err != nil {
+		return err
+	}
+	mp.entries[fmt.Sprintf("%x", tx.ID)].Time = arrival
+	return nil
+}
+
+// accept validates the transaction against the tip, the mempool and the
+// policy, and adds it
+func (mp *Mempool) accept(tx *Transaction, checkFeeRate bool) error {
+	if err := mp.bc.verifyTransaction(tx, mp.utxos, mp.pending()); err != nil {
+		return err
+	}
+	size := len(tx.Serialize())
+	if err := mp.policy.checkStandard(tx, size); err != nil {
+		return err
+	}
+	if err := mp.checkChainLimits(tx, size); err != nil {
+		return err
+	}
+	fee := 0
+	for _, in := range tx.Vin {
+		fee += mp.utxos[fmt.Sprintf("%x", in.Txid)][in.OutIdx].Value
+	}
+	for _, out := range tx.Vout {
+		fee -= out.Value
+	}
+	if checkFeeRate {
+		if err := mp.policy.checkFeeRate(fee, size); err != nil {
+			return err
+		}
+	}
+
+	mp.insertEntry(&MempoolEntry{Tx: tx, Fee: fee, Size: size, Time: time.Now(), seq: mp.nextSeq})
+	mp.nextSeq++
+	mp.utxos.Update([]*Transaction{tx})
+	return nil
+}
+
+// rollback undoes the changes made since the journal held mark changes,
+// e.g. the evictions made for a transaction finally rejected
+func (mp *Mempool) rollback(mark int) {
+	if len(mp.journal) == mark {
+		return
+	}
+	for i := len(mp.journal) - 1; i >= mark; i-- {
+		if c := mp.journal[i]; c.added {
+			mp.deleteEntry(c.entry)
+		} else {
+			mp.setEntry(c.entry)
+		}
+	}
+	mp.journal = mp.journal[:mark]
+	mp.rebuildUTXOs()
+}
+
+// commit notifies the listeners of the changes in the journal. An entry
+// removed and added back, e.g. by a reorganization, is not notified, so
+// that the listeners keep the height it entered at.
+func (mp *Mempool) commit() {
+	first := make(map[string]bool)
+	last := make(map[string]int)
+	for i, c := range mp.journal {
+		txID := fmt.Sprintf("%x", c.entry.Tx.ID)
+		if _, ok := first[txID]; !ok {
+			first[txID] = c.added
+		}
+		last[txID] = i
+	}
+	journal := mp.journal
+	mp.journal = nil
+	for i, c := range journal {
+		txID := fmt.Sprintf("%x", c.entry.Tx.ID)
+		if last[txID] != i || first[txID] != c.added {
+			continue
+		}
+		for _, l := range mp.listeners {
+			if c.added {
+				l.TxAdded(c.entry)
+			} else {
+				l.TxRemoved(c.entry)
+			}
+		}
+	}
+}
+
+// pending returns the transactions of the mempool by ID
+func (mp *Mempool) pending() map[string]*Transaction {
+	txs := make(map[string]*Transaction, len(mp.entries))
+	for txID, e := range mp.entries {
+		txs[txID] = e.Tx
+	}
+	return txs
+}
+
+// Has checks whether the transaction is in the mempool
+func (mp *Mempool) Has(txID []byte) bool {
+	_, ok := mp.entries[fmt.Sprintf("%x", txID)]
+	return ok
+}
+
+// Get returns the mempool entry of a transaction
+func (mp *Mempool) Get(txID []byte) (*MempoolEntry, error) {
+	e, ok := mp.entries[fmt.Sprintf("%x", txID)]
+	if !ok {
+		return nil, ErrTxNotFound
+	}
+	return e, nil
+}
+
+// Len returns the number of transactions in the mempool
+func (mp *Mempool) Len() int {
+	return len(mp.entries)
+}
+
+// Size returns the total size in bytes of the transactions in the mempool
+func (mp *Mempool) Size() int {
+	return entriesSize(mp.entries)
+}
+
+// Remove removes a transaction and the transactions spending its outputs
+func (mp *Mempool) Remove(txID []byte) {
+	defer mp.commit()
+	mp.removeWithDescendants(fmt.Sprintf("%x", txID))
+	mp.rebuildUTXOs()
+}
+
+func (mp *Mempool) removeWithDescendants(txID string) {
+	e, ok := mp.entries[txID]
+	if !ok {
+		return
+	}
+	for _, d := range mp.withDescendants([]*MempoolEntry{e}) {
+		mp.removeEntry(d)
+	}
+}
+
+// withDescendants returns the entries and the entries spending their
+// outputs, directly or not, by transaction ID
+func (mp *Mempool) withDescendants(entries []*MempoolEntry) map[string]*MempoolEntry {
+	all := make(map[string]*MempoolEntry)
+	var visit func(e *MempoolEntry)
+	visit = func(e *MempoolEntry) {
+		txID := fmt.Sprintf("%x", e.Tx.ID)
+		if _, ok := all[txID]; ok {
+			return
+		}
+		all[txID] = e
+		for idx := range e.Tx.Vout {
+			if spender, ok := mp.spent[fmt.Sprintf("%s:%d", txID, idx)]; ok {
+				visit(mp.entries[spender])
+			}
+		}
+	}
+	for _, e := range entries {
+		visit(e)
+	}
+	return all
+}
+
+func (mp *Mempool) insertEntry(e *MempoolEntry) {
+	mp.setEntry(e)
+	mp.journal = append(mp.journal, mempoolChange{entry: e, added: true})
+}
+
+func (mp *Mempool) removeEntry(e *MempoolEntry) {
+	mp.deleteEntry(e)
+	mp.journal = append(mp.journal, mempoolChange{entry: e, added: false})
+}
+
+func (mp *Mempool) setEntry(e *MempoolEntry) {
+	txID := fmt.Sprintf("%x", e.Tx.ID)
+	mp.entries[txID] = e
+	for _, in := range e.Tx.Vin {
+		mp.spent[in.outpoint()] = txID
+	}
+}
+
+func (mp *Mempool) deleteEntry(e *MempoolEntry) {
+	delete(mp.entries, fmt.Sprintf("%x", e.Tx.ID))
+	for _, in := range e.Tx.Vin {
+		delete(mp.spent, in.outpoint())
+	}
+}
+
+// rebuildUTXOs applies the entries to the UTXO set of the tip
+func (mp *Mempool) rebuildUTXOs() {
+	mp.utxos = mp.utxosWithout(nil)
+}
+
+// utxosWithout returns the UTXO set of the tip updated with the entries,
+// except the excluded ones
+func (mp *Mempool) utxosWithout(excluded map[string]*MempoolEntry) UTXOSet {
+	utxos := mp.bc.FindUTXOSet()
+	for _, e := range mp.byArrival() {
+		if _, ok := excluded[fmt.Sprintf("%x", e.Tx.ID)]; !ok {
+			utxos.Update([]*Transaction{e.Tx})
+		}
+	}
+	return utxos
+}
+
+// byArrival returns the entries in arrival order, a transaction always
+// comes after the transactions it spends from
+func (mp *Mempool) byArrival() []*MempoolEntry {
+	entries := make([]*MempoolEntry, 0, len(mp.entries))
+	for _, e := range mp.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// BlockConnected removes the transactions confirmed by a new tip, the
+// transactions spending the same outputs as the block with their descendants,
+// and the expired entries
+func (mp *Mempool) BlockConnected(block *Block) {
+	defer mp.commit()
+	for _, l := range mp.listeners {
+		l.BlockConnected(block)
+	}
+	for _, tx := range block.Transactions {
+		if e, ok := mp.entries[fmt.Sprintf("%x", tx.ID)]; ok {
+			mp.removeEntry(e)
+		}
+	}
+	for _, tx := range block.Transactions {
+		for _, in := range tx.Vin {
+			if spender, ok := mp.spent[in.outpoint()]; ok {
+				mp.removeWithDescendants(spender)
+			}
+		}
+	}
+	mp.rebuildUTXOs()
+	mp.expire(time.Now())
+}
+
+// Expire removes the entries older than the expiry age at the given time,
+// with their descendants. It returns the number of removed transactions.
+func (mp *Mempool) Expire(now time.Time) int {
+	defer mp.commit()
+	return mp.expire(now)
+}
+
+func (mp *Mempool) expire(now time.Time) int {
+	var expired []*MempoolEntry
+	for _, e := range mp.entries {
+		if now.Sub(e.Time) > mp.expiry {
+			expired = append(expired, e)
+		}
+	}
+	if len(expired) == 0 {
+		return 0
+	}
+	removed := mp.withDescendants(expired)
+	for _, e := range removed {
+		mp.removeEntry(e)
+	}
+	mp.rebuildUTXOs()
+	return len(removed)
+}
+
+// BlockDisconnected adds back the transactions of a disconnected tip.
+// The entries no longer valid on the new tip are removed, the others keep
+// their arrival time.
+func (mp *Mempool) BlockDisconnected(block *Block) {
+	defer mp.commit()
+	for _, l := range mp.listeners {
+		l.BlockDisconnected(block)
+	}
+	entries := mp.byArrival()
+	for _, e := range entries {
+		mp.removeEntry(e)
+	}
+	mp.reset()
+	for _, tx := range block.Transactions {
+		mp.tryAdd(tx)
+	}
+	for _, e := range entries {
+		mp.addAt(e.Tx, e.Time)
+	}
+}
+
+// String returns a human-readable representation of the mempool
+func (mp *Mempool) String() string {
+	lines := []string{fmt.Sprintf("--- Mempool: %d transaction(s)", mp.Len())}
+	for _, e := range mp.byArrival() {
+		lines = append(lines, fmt.Sprintf("     %x: fee %d, size %d", e.Tx.ID, e.Fee, e.Size))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Unconfirmed transactions form packages: a transaction and the mempool
+// transactions it spends from, its ancestors. A child paying a high fee
+// gets its low-fee parents mined with it (child-pays-for-parent), so the
+// package is ranked by the fee rate of the whole.
+
+const (
+	// MaxAncestorCount is the maximum number of transactions of a package,
+	// the transaction included
+	MaxAncestorCount = 25
+	// MaxAncestorSize is the maximum size in bytes of a package
+	MaxAncestorSize = 101000
+	// MaxDescendantCount is the maximum number of mempool transactions
+	// depending on a transaction, the transaction included
+	MaxDescendantCount = 25
+	// MaxDescendantSize is the maximum size in bytes of a transaction and its
+	// mempool descendants
+	MaxDescendantSize = 101000
+)
+
+var (
+	ErrAncestorLimit   = errors.New("too many unconfirmed ancestors")
+	ErrDescendantLimit = errors.New("too many unconfirmed descendants")
+	ErrInvalidPackage  = errors.New("invalid transaction package")
+)
+
+// ancestors returns the entries tx spends from, directly or not, by
+// transaction ID
+func (mp *Mempool) ancestors(tx *Transaction) map[string]*MempoolEntry {
+	all := make(map[string]*MempoolEntry)
+	var visit func(tx *Transaction)
+	visit = func(tx *Transaction) {
+		for _, in := range tx.Vin {
+			txID := fmt.Sprintf("%x", in.Txid)
+			if e, ok := mp.entries[txID]; ok && all[txID] == nil {
+				all[txID] = e
+				visit(e.Tx)
+			}
+		}
+	}
+	visit(tx)
+	return all
+}
+
+// checkChainLimits checks that adding tx of the given size keeps its
+// package and the descendants of its ancestors within the limits
+func (mp *Mempool) checkChainLimits(tx *Transaction, size int) error {
+	ancestors := mp.ancestors(tx)
+	if len(ancestors)+1 > MaxAncestorCount {
+		return fmt.Errorf("%w: more than %d transactions", ErrAncestorLimit, MaxAncestorCount)
+	}
+	if packageSize := size + entriesSize(ancestors); packageSize > MaxAncestorSize {
+		return fmt.Errorf("%w: %d bytes", ErrAncestorLimit, packageSize)
+	}
+	for _, a := range ancestors {
+		descendants := mp.withDescendants([]*MempoolEntry{a})
+		if len(descendants)+1 > MaxDescendantCount {
+			return fmt.Errorf("%w: more than %d transactions", ErrDescendantLimit, MaxDescendantCount)
+		}
+		if descendantsSize := size + entriesSize(descendants); descendantsSize > MaxDescendantSize {
+			return fmt.Errorf("%w: %d bytes", ErrDescendantLimit, descendantsSize)
+		}
+	}
+	return nil
+}
+
+func entriesSize(entries map[string]*MempoolEntry) int {
+	size := 0
+	for _, e := range entries {
+		size += e.Size
+	}
+	return size
+}
+
+// packageEntry is an entry with the fee and size of its package, less the
+// ancestors already selected. They are updated as ancestors get selected,
+// as Bitcoin does with its modified-fee set, so no package is recomputed.
+// When evicting, the package is the entry and its descendants instead.
+type packageEntry struct {
+	*MempoolEntry
+	txID      string
+	ancestors []*MempoolEntry
+	fee, size int
+}
+
+// packageRank is a package queued with the fee and size it had when queued.
+// It is stale once they differ from the ones of its entry.
+type packageRank struct {
+	entry     *packageEntry
+	fee, size int
+}
+
+// packageQueue orders packages by fee rate, the highest first or the lowest
+// first, then by arrival
+type packageQueue struct {
+	ranks       []packageRank
+	lowestFirst bool
+}
+
+func (q *packageQueue) Len() int { return len(q.ranks) }
+
+func (q *packageQueue) Less(i, j int) bool {
+	c := compareFeeRates(q.ranks[i].fee, q.ranks[i].size, q.ranks[j].fee, q.ranks[j].size)
+	if q.lowestFirst {
+		c = -c
+	}
+	if c != 0 {
+		return c > 0
+	}
+	return q.ranks[i].entry.seq < q.ranks[j].entry.seq
+}
+
+func (q *packageQueue) Swap(i, j int) { q.ranks[i], q.ranks[j] = q.ranks[j], q.ranks[i] }
+
+func (q *packageQueue) Push(x any) { q.ranks = append(q.ranks, x.(packageRank)) }
+
+func (q *packageQueue) Pop() any {
+	r := q.ranks[len(q.ranks)-1]
+	q.ranks = q.ranks[:len(q.ranks)-1]
+	return r
+}
+
+// Select returns the transactions to mine, fitting in maxSize bytes.
+// The transactions are taken by package, the package paying the highest
+// fee rate first, so a child paying a high fee brings its parents along.
+// A transaction always comes after the transactions it spends from.
+func (mp *Mempool) Select(maxSize int) []*Transaction {
+	queue := &packageQueue{}
+	descendants := make(map[string][]*packageEntry)
+	for _, e := range mp.byArrival() {
+		p := &packageEntry{MempoolEntry: e, txID: fmt.Sprintf("%x", e.Tx.ID), fee: e.Fee, size: e.Size}
+		for txID, a := range mp.ancestors(e.Tx) {
+			p.ancestors = append(p.ancestors, a)
+			p.fee += a.Fee
+			p.size += a.Size
+			descendants[txID] = append(descendants[txID], p)
+		}
+		heap.Push(queue, packageRank{p, p.fee, p.size})
+	}
+
+	var txs []*Transaction
+	included := make(map[string]bool)
+	failed := make(map[string]bool)
+	size := 0
+	for queue.Len() > 0 {
+		r := heap.Pop(queue).(packageRank)
+		best := r.entry
+		if included[best.txID] || failed[best.txID] || r.fee != best.fee || r.size != best.size {
+			continue
+		}
+		if size+best.size > maxSize {
+			// its descendants, with a larger package, are left out as well
+			failed[best.txID] = true
+			continue
+		}
+		size += best.size
+		pkg := []*MempoolEntry{best.MempoolEntry}
+		for _, a := range best.ancestors {
+			if !included[fmt.Sprintf("%x", a.Tx.ID)] {
+				pkg = append(pkg, a)
+			}
+		}
+		sort.Slice(pkg, func(i, j int) bool {
+			return pkg[i].seq < pkg[j].seq
+		})
+		for _, e := range pkg {
+			txID := fmt.Sprintf("%x", e.Tx.ID)
+			included[txID] = true
+			txs = append(txs, e.Tx)
+			// the packages of its descendants no longer pay for it
+			for _, d := range descendants[txID] {
+				if !included[d.txID] {
+					d.fee -= e.Fee
+					d.size -= e.Size
+					heap.Push(queue, packageRank{d, d.fee, d.size})
+				}
+			}
+		}
+	}
+	return txs
+}
+
+// AddPackage adds a child and its unconfirmed parents together. The
+// transactions may be given in any order, and are either all added or none.
+// The minimum relay fee rate applies to the package as a whole, so the child
+// can pay for parents below it; as every other transaction is a parent of
+// the child, no unrelated transaction rides along for free.
+func (mp *Mempool) AddPackage(txs []*Transaction) error {
+	if len(txs) == 0 || len(txs) > MaxAncestorCount {
+		return fmt.Errorf("%w: %d transactions", ErrInvalidPackage, len(txs))
+	}
+	sorted, err := sortPackage(txs)
+	if err != nil {
+		return err
+	}
+	if err := checkChildWithParents(sorted); err != nil {
+		return err
+	}
+	defer mp.commit()
+	mark := len(mp.journal)
+	fee, size := 0, 0
+	for _, tx := range sorted {
+		if err := mp.add(tx, false); err != nil {
+			mp.rollback(mark)
+			return fmt.Errorf("package transaction %x: %w", tx.ID, err)
+		}
+		e := mp.entries[fmt.Sprintf("%x", tx.ID)]
+		fee += e.Fee
+		size += e.Size
+	}
+	if err := mp.policy.checkFeeRate(fee, size); err != nil {
+		mp.rollback(mark)
+		return fmt.Errorf("package: %w", err)
+	}
+	if err := mp.trim(sorted); err != nil {
+		mp.rollback(mark)
+		return err
+	}
+	return nil
+}
+
+// checkChildWithParents checks that the last transaction of a sorted
+// package spends from every other transaction of the package
+func checkChildWithParents(sorted []*Transaction) error {
+	child := sorted[len(sorted)-1]
+	parents := make(map[string]bool)
+	for _, in := range child.Vin {
+		parents[fmt.Sprintf("%x", in.Txid)] = true
+	}
+	for _, tx := range sorted[:len(sorted)-1] {
+		if !parents[fmt.Sprintf("%x", tx.ID)] {
+			return fmt.Errorf("%w: transaction %x is not a parent of the child %x", ErrInvalidPackage, tx.ID, child.ID)
+		}
+	}
+	return nil
+}
+
+// sortPackage orders the package so that a transaction comes after the
+// transactions of the package it spends from
+func sortPackage(txs []*Transaction) ([]*Transaction, error) {
+	pending := make(map[string]*Transaction)
+	for _, tx := range txs {
+		txID := fmt.Sprintf("%x", tx.ID)
+		if _, ok := pending[txID]; ok {
+			return nil, fmt.Errorf("%w: duplicate transaction %s", ErrInvalidPackage, txID)
+		}
+		pending[txID] = tx
+	}
+	var sorted []*Transaction
+	for len(sorted) < len(txs) {
+		progress := false
+		for _, tx := range txs {
+			txID := fmt.Sprintf("%x", tx.ID)
+			if _, ok := pending[txID]; !ok {
+				continue
+			}
+			ready := true
+			for _, in := range tx.Vin {
+				if _, ok := pending[fmt.Sprintf("%x", in.Txid)]; ok {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				delete(pending, txID)
+				sorted = append(sorted, tx)
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("%w: circular dependency", ErrInvalidPackage)
+		}
+	}
+	return sorted, nil
+}
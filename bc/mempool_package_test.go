@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolSelectPackage(t *testing.T) {
+	_, mp, genesisTx, cbTx := newTestMempool(t)
+	parent := spendTestCoin(t, mp.utxos, genesisTx, 0, 2, 1)
+	other := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(parent))
+	assert.Nil(t, mp.Add(other))
+	assert.Equal(t, []*Transaction{other, parent}, mp.Select(MaxBlockSize))
+
+	// the child pays for its parent
+	child := spendTestCoin(t, mp.utxos, parent, 1, 1, 6)
+	assert.Nil(t, mp.Add(child))
+	assert.Equal(t, []*Transaction{parent, child, other}, mp.Select(MaxBlockSize))
+	packageSize := len(parent.Serialize()) + len(child.Serialize())
+	assert.Equal(t, []*Transaction{parent, child}, mp.Select(packageSize))
+}
+
+func TestMempoolSelectUpdatesPackages(t *testing.T) {
+	_, mp, genesisTx, cbTx := newTestMempool(t)
+	parent := spendTestCoin(t, mp.utxos, genesisTx, 0, 1, 1)
+	assert.Nil(t, mp.Add(parent))
+	child := spendTestCoin(t, mp.utxos, parent, 1, 1, 5)
+	assert.Nil(t, mp.Add(child))
+	grandchild := spendTestCoin(t, mp.utxos, child, 1, 1, 1)
+	assert.Nil(t, mp.Add(grandchild))
+	other := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(other))
+
+	// once its ancestors are selected, the grandchild pays its own fee rate,
+	// below the one of other
+	assert.Equal(t, []*Transaction{parent, child, other, grandchild}, mp.Select(MaxBlockSize))
+}
+
+func TestMempoolAncestorLimit(t *testing.T) {
+	_, mp, genesisTx, _ := newTestMempool(t)
+	// the transactions are free, to chain more of them than the coin value
+	policy := DefaultMempoolPolicy
+	policy.MinRelayFeeRate = 0
+	mp.SetPolicy(policy)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	prevTX := genesisTx
+	for i := 0; i <= MaxAncestorCount; i++ {
+		builder := NewTxBuilder(pubKeyToByte(*pubKey1), mp.utxos)
+		builder.SetFeePolicy(FixedFee(0))
+		assert.Nil(t, builder.AddInput(prevTX.ID, 0))
+		assert.Nil(t, builder.AddOutput(testAddressUser1, 10))
+		tx, err := builder.Build()
+		assert.Nil(t, err)
+		assert.Nil(t, tx.Sign(*privKey1, map[string]*Transaction{fmt.Sprintf("%x", prevTX.ID): prevTX}))
+		if i < MaxAncestorCount {
+			assert.Nil(t, mp.Add(tx))
+		} else {
+			assert.ErrorIs(t, mp.Add(tx), ErrAncestorLimit)
+		}
+		prevTX = tx
+	}
+	assert.Equal(t, MaxAncestorCount, mp.Len())
+}
+
+func TestMempoolAddPackage(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	utxos := bc.FindUTXOSet()
+	parent := spendTestCoin(t, utxos, genesisTx, 0, 2, 0)
+	utxos.Update([]*Transaction{parent})
+	child := spendTestCoin(t, utxos, parent, 1, 1, 6)
+
+	assert.ErrorIs(t, mp.AddPackage(nil), ErrInvalidPackage)
+	assert.ErrorIs(t, mp.AddPackage([]*Transaction{parent, parent}), ErrInvalidPackage)
+
+	// a transaction of the package is invalid, none is added
+	unsigned := *child
+	unsigned.Vin = append([]TXInput{}, child.Vin...)
+	unsigned.Vin[0].Signature = nil
+	err := mp.AddPackage([]*Transaction{&unsigned, parent})
+	assert.ErrorIs(t, err, ErrBadSignature)
+	assert.Equal(t, 0, mp.Len())
+
+	// an unrelated transaction cannot ride along for free
+	unrelated := spendTestCoin(t, bc.FindUTXOSet(), cbTx, 0, 4, 0)
+	err = mp.AddPackage([]*Transaction{child, parent, unrelated})
+	assert.ErrorIs(t, err, ErrInvalidPackage)
+	assert.Equal(t, 0, mp.Len())
+
+	// the child comes first, it is added after its parent
+	assert.Nil(t, mp.AddPackage([]*Transaction{child, parent}))
+	assert.Equal(t, 2, mp.Len())
+	assert.Equal(t, []*Transaction{parent, child}, mp.Select(MaxBlockSize))
+}
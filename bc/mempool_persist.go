@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// mempoolMagic starts every saved mempool
+var mempoolMagic = []byte("mempool\xff")
+
+var ErrInvalidMempoolFile = errors.New("invalid mempool file")
+
+// savedEntry is a mempool entry as saved to disk, the fee and size are
+// recomputed when it is loaded
+type savedEntry struct {
+	Tx   *Transaction
+	Time time.Time
+}
+
+// Save writes the mempool transactions to a file, in arrival order
+func (mp *Mempool) Save(path string) error {
+	var saved []savedEntry
+	for _, e := range mp.byArrival() {
+		saved = append(saved, savedEntry{Tx: e.Tx, Time: e.Time})
+	}
+	return writeGobFile(path, mempoolMagic, saved)
+}
+
+// MempoolLoadResult tells what became of the transactions saved by Save
+type MempoolLoadResult struct {
+	Added   int            // The transactions back in the mempool
+	Expired int            // The transactions saved for longer than the expiry
+	Invalid map[string]int // The transactions no longer valid, by reason
+}
+
+// Dropped returns the number of saved transactions not added back
+func (r *MempoolLoadResult) Dropped() int {
+	dropped := r.Expired
+	for _, n := range r.Invalid {
+		dropped += n
+	}
+	return dropped
+}
+
+// Load adds the transactions saved by Save, revalidating each against the
+// tip. The expired and no longer valid transactions are dropped, and counted
+// in the result. A missing file is an empty mempool.
+func (mp *Mempool) Load(path string) (*MempoolLoadResult, error) {
+	result := &MempoolLoadResult{Invalid: make(map[string]int)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, mempoolMagic) {
+		return nil, ErrInvalidMempoolFile
+	}
+	var saved []savedEntry
+	dec := gob.NewDecoder(bytes.NewReader(data[len(mempoolMagic):]))
+	if err := dec.Decode(&saved); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMempoolFile, err)
+	}
+
+	defer mp.commit()
+	now := time.Now()
+	for _, e := range saved {
+		if now.Sub(e.Time) > mp.expiry {
+			result.Expired++
+			continue
+		}
+		if err := mp.addAt(e.Tx, e.Time); err != nil {
+			// the offending input does not matter, the kind of error does
+			var txErr *TxValidationError
+			if errors.As(err, &txErr) {
+				err = txErr.Kind
+			}
+			result.Invalid[err.Error()]++
+			continue
+		}
+		result.Added++
+	}
+	return result, nil
+}
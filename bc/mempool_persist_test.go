@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolSaveLoad(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+	dir := t.TempDir()
+	path := filepath.Join(dir, MempoolFile)
+	assert.Nil(t, mp.Save(path))
+	assert.Nil(t, mp.Save(path), "the saved mempool is replaced")
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "no temporary file is left behind")
+
+	loaded := NewMempool(bc)
+	result, err := loaded.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Added)
+	assert.Equal(t, 0, result.Dropped())
+	assert.Equal(t, mp.Select(MaxBlockSize), loaded.Select(MaxBlockSize))
+	for _, tx := range []*Transaction{txA, txB, txC} {
+		entry, _ := mp.Get(tx.ID)
+		loadedEntry, err := loaded.Get(tx.ID)
+		if assert.Nil(t, err) {
+			assert.True(t, entry.Time.Equal(loadedEntry.Time), "the arrival time is kept")
+			assert.Equal(t, entry.Fee, loadedEntry.Fee)
+		}
+	}
+
+	// the transactions are revalidated against the new tip
+	conflict := spendTestCoin(t, bc.FindUTXOSet(), cbTx, 0, 3, 1)
+	newCbTx, _ := NewCoinbaseTX(testAddressUser1, "conflict")
+	_, err = bc.MineBlock([]*Transaction{newCbTx, conflict})
+	assert.Nil(t, err)
+	loaded = NewMempool(bc)
+	result, err = loaded.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Added)
+	assert.True(t, loaded.Has(txA.ID))
+	// txB spends a coin spent by the block, and txC a coin of txB
+	assert.Equal(t, map[string]int{ErrInputSpent.Error(): 1, ErrTxInputNotFound.Error(): 1}, result.Invalid)
+
+	// the expired transactions are dropped
+	loaded = NewMempool(bc)
+	loaded.SetExpiry(0)
+	result, err = loaded.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Added)
+	assert.Equal(t, 3, result.Expired)
+	assert.Equal(t, 3, result.Dropped())
+	assert.Equal(t, 0, loaded.Len())
+}
+
+func TestMempoolLoadErrors(t *testing.T) {
+	_, mp, _, _ := newTestMempool(t)
+	dir := t.TempDir()
+	result, err := mp.Load(filepath.Join(dir, MempoolFile))
+	assert.Nil(t, err, "a missing file is an empty mempool")
+	assert.Equal(t, 0, result.Added)
+
+	path := filepath.Join(dir, "invalid.dat")
+	assert.Nil(t, os.WriteFile(path, []byte("not a mempool"), 0600))
+	_, err = mp.Load(path)
+	assert.ErrorIs(t, err, ErrInvalidMempoolFile)
+	assert.Nil(t, os.WriteFile(path, append(mempoolMagic, 1, 2, 3), 0600))
+	_, err = mp.Load(path)
+	assert.ErrorIs(t, err, ErrInvalidMempoolFile)
+}
+
+func TestMempoolExpire(t *testing.T) {
+	_, mp, genesisTx, cbTx := newTestMempool(t)
+	mp.SetExpiry(time.Hour)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	assert.Nil(t, mp.Add(txA))
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txB))
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+
+	assert.Equal(t, 0, mp.Expire(time.Now()))
+	// txB expires with its child, which arrived later
+	entry, _ := mp.Get(txB.ID)
+	entry.Time = entry.Time.Add(-2 * time.Hour)
+	assert.Equal(t, 2, mp.Expire(time.Now()))
+	assert.Equal(t, 1, mp.Len())
+	assert.True(t, mp.Has(txA.ID))
+	assert.Equal(t, []*Transaction{txA}, mp.Select(MaxBlockSize))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// spendTestCoin returns a transaction of user1 spending the output outIdx of
+// prevTX, paying amount to user2 and fee to the miner, the rest as change
+func spendTestCoin(t *testing.T, utxos UTXOSet, prevTX *Transaction, outIdx, amount, fee int) *Transaction {
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), utxos)
+	assert.Nil(t, builder.AddInput(prevTX.ID, outIdx))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, amount))
+	builder.SetFeePolicy(FixedFee(fee))
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Sign(*privKey1, map[string]*Transaction{fmt.Sprintf("%x", prevTX.ID): prevTX}))
+	return tx
+}
+
+// newTestMempool creates a blockchain where user1 owns the genesis coin and
+// the coin of a second block, and an empty mempool on top of it
+func newTestMempool(t *testing.T) (*Blockchain, *Mempool, *Transaction, *Transaction) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "second coin")
+	_, err = bc.MineBlock([]*Transaction{cbTx})
+	assert.Nil(t, err)
+	return bc, NewMempool(bc), bc.GetGenesisBlock().Transactions[0], cbTx
+}
+
+func TestMempoolAdd(t *testing.T) {
+	_, mp, genesisTx, secondTx := newTestMempool(t)
+
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	assert.Nil(t, mp.Add(txA))
+	assert.True(t, mp.Has(txA.ID))
+	entry, err := mp.Get(txA.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, entry.Fee)
+	assert.Equal(t, len(txA.Serialize()), entry.Size)
+
+	assert.ErrorIs(t, mp.Add(txA), ErrTxInMempool)
+	doubleSpend := spendTestCoin(t, mp.bc.FindUTXOSet(), genesisTx, 0, 7, 1)
+	assert.ErrorIs(t, mp.Add(doubleSpend), ErrReplacementFee, "a double spend must pay more to replace txA")
+	assert.True(t, mp.Has(txA.ID))
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "")
+	assert.ErrorIs(t, mp.Add(cbTx), ErrMempoolCoinbase)
+
+	unsigned := *doubleSpend
+	unsigned.Vin = []TXInput{{Txid: genesisTx.ID, OutIdx: 0}}
+	unsigned.ID = unsigned.Hash()
+	mp.Remove(txA.ID)
+	assert.ErrorIs(t, mp.Add(&unsigned), ErrBadSignature)
+	assert.Equal(t, 0, mp.Len())
+	assert.Nil(t, mp.Add(doubleSpend), "the output is free again")
+	_, err = mp.Get(txA.ID)
+	assert.ErrorIs(t, err, ErrTxNotFound)
+
+	// the ID of an otherwise valid transaction must be its hash
+	txB := spendTestCoin(t, mp.utxos, secondTx, 0, 9, 1)
+	flipped := *txB
+	flipped.ID = append([]byte{}, txB.ID...)
+	flipped.ID[0] ^= 0xff
+	assert.ErrorIs(t, mp.Add(&flipped), ErrTxIDMismatch)
+	assert.False(t, mp.Has(flipped.ID))
+	assert.Nil(t, mp.Add(txB))
+}
+
+func TestMempoolSelect(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	// txC spends the change of txB before it is mined
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+
+	// txC pays the highest fee rate, but it comes after its parent
+	assert.Equal(t, []*Transaction{txB, txC, txA}, mp.Select(MaxBlockSize))
+	sizeB := len(txB.Serialize())
+	assert.Equal(t, []*Transaction{txB}, mp.Select(sizeB))
+	assert.Equal(t, []*Transaction{txA}, mp.Select(sizeB-1), "txC is left out with its parent")
+
+	// the mined transactions leave the mempool
+	cbTx, _ = NewCoinbaseTX(testAddressUser1, "select")
+	block, err := bc.MineBlock(append([]*Transaction{cbTx}, mp.Select(MaxBlockSize)...))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(block.Transactions))
+	mp.BlockConnected(block)
+	assert.Equal(t, 0, mp.Len())
+}
+
+func TestMempoolReorg(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+
+	// a block spending the coin of txA evicts it
+	conflict := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 8, 2)
+	newCbTx, _ := NewCoinbaseTX(testAddressUser1, "conflict")
+	block, err := bc.MineBlock([]*Transaction{newCbTx, conflict})
+	assert.Nil(t, err)
+	mp.BlockConnected(block)
+	assert.Equal(t, 2, mp.Len())
+	assert.False(t, mp.Has(txA.ID))
+	assert.ErrorIs(t, mp.Add(txA), ErrInputSpent)
+
+	// the disconnected transactions go back to the mempool
+	block, err = bc.DisconnectTip()
+	assert.Nil(t, err)
+	mp.BlockDisconnected(block)
+	assert.Equal(t, 3, mp.Len())
+	assert.True(t, mp.Has(conflict.ID))
+	assert.True(t, mp.Has(txC.ID))
+
+	// the coin spent by txB disappears with its block, and so does txC
+	block, err = bc.DisconnectTip()
+	assert.Nil(t, err)
+	mp.BlockDisconnected(block)
+	assert.Equal(t, 1, mp.Len())
+	assert.True(t, mp.Has(conflict.ID))
+
+	// the confirmed outputs are spent by the mempool entries only once
+	assert.Equal(t, []*Transaction{conflict}, mp.Select(MaxBlockSize))
+	assert.ErrorIs(t, mp.Add(txA), ErrReplacementFee)
+}
+
+// changeRecorder records the IDs of the transactions notified as added to
+// or removed from the mempool
+type changeRecorder struct {
+	added, removed []string
+}
+
+func (r *changeRecorder) TxAdded(e *MempoolEntry) {
+	r.added = append(r.added, fmt.Sprintf("%x", e.Tx.ID))
+}
+
+func (r *changeRecorder) TxRemoved(e *MempoolEntry) {
+	r.removed = append(r.removed, fmt.Sprintf("%x", e.Tx.ID))
+}
+
+func (r *changeRecorder) BlockConnected(block *Block) {}
+
+func (r *changeRecorder) BlockDisconnected(block *Block) {}
+
+func TestMempoolListenerChanges(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	r := &changeRecorder{}
+	f := NewFeeEstimator()
+	mp.AddListener(r)
+	mp.AddListener(f)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 2)
+	assert.Nil(t, mp.Add(txA))
+	txAID := fmt.Sprintf("%x", txA.ID)
+	assert.Equal(t, []string{txAID}, r.added)
+
+	// a rejected replacement leaves no trace
+	doubleSpend := spendTestCoin(t, mp.bc.FindUTXOSet(), genesisTx, 0, 5, 1)
+	assert.ErrorIs(t, mp.Add(doubleSpend), ErrReplacementFee)
+	assert.Equal(t, []string{txAID}, r.added)
+	assert.Empty(t, r.removed)
+
+	// an entry kept across a reorganization is not notified again, and its
+	// wait is still counted from the height it entered at
+	height := f.tracked[txAID].height
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	newCbTx, _ := NewCoinbaseTX(testAddressUser1, "reorg")
+	block, err := bc.MineBlock([]*Transaction{newCbTx, txB})
+	assert.Nil(t, err)
+	mp.BlockConnected(block)
+	block, err = bc.DisconnectTip()
+	assert.Nil(t, err)
+	mp.BlockDisconnected(block)
+	assert.True(t, mp.Has(txA.ID))
+	assert.True(t, mp.Has(txB.ID))
+	assert.Equal(t, []string{txAID, fmt.Sprintf("%x", txB.ID)}, r.added)
+	assert.Empty(t, r.removed)
+	assert.Equal(t, height, f.tracked[txAID].height)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashBatch is the number of hashes a worker computes between two checks
+// of the cancellation
+const hashBatch = 1024
+
+var errNonceSpaceExhausted = errors.New("no valid nonce")
+
+// Miner solves the proof-of-work of blocks with several workers, each
+// trying a share of the nonces. When no nonce is valid, an extra nonce in
+// the coinbase is rolled, changing the merkle root, and the search starts
+// over.
+type Miner struct {
+	workers    int
+	nonceSpace int // The highest nonce tried before rolling the extra nonce
+
+	hashes atomic.Int64 // The hashes computed by the current or last run
+	mu     sync.Mutex
+	start  time.Time
+	end    time.Time
+}
+
+// NewMiner creates a miner with the given number of workers, one per CPU
+// when workers is not positive
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{workers: workers, nonceSpace: maxNonce}
+}
+
+// Mine finds the nonce of the block, setting its hash. The coinbase, the
+// first transaction, is replaced when the extra nonce is rolled.
+// The lowest valid nonce is found, as a sequential search would.
+// It stops with the context error when ctx is canceled, e.g. when a new
+// tip makes the block stale.
+func (m *Miner) Mine(ctx context.Context, block *Block) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return ErrNoCoinbase
+	}
+	m.hashes.Store(0)
+	m.mu.Lock()
+	m.start, m.end = time.Now(), time.Time{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.end = time.Now()
+		m.mu.Unlock()
+	}()
+
+	if block.MerkleRoot == nil {
+		block.updateMerkleRoot()
+	}
+	if block.Difficulty == 0 {
+		block.Difficulty = ActiveChainParams.PowAlgorithm.TargetBits()
+	}
+	coinbaseData := block.Transactions[0].Vin[0].PubKey
+	for extraNonce := 0; ; extraNonce++ {
+		if extraNonce > 0 {
+			rollExtraNonce(block, coinbaseData, extraNonce)
+		}
+		pow := NewProofOfWork(block)
+		nonce, hash, err := m.search(ctx, newHeaderHasher(pow.setupHeader()), pow.target)
+		if errors.Is(err, errNonceSpaceExhausted) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		block.Nonce, block.Hash = nonce, hash
+		return nil
+	}
+}
+
+// search returns the lowest nonce of the header giving a hash below
+// target. Worker i tries the nonces i, i+workers, i+2*workers... and stops
+// past a valid nonce found by any worker, the lower nonces being checked by
+// the others.
+func (m *Miner) search(ctx context.Context, hasher *headerHasher, target *big.Int) (int, []byte, error) {
+	var best atomic.Int64
+	best.Store(math.MaxInt64)
+	var wg sync.WaitGroup
+	for w := 0; w < m.workers; w++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			hashed := 0
+			for nonce := first; nonce <= m.nonceSpace && int64(nonce) < best.Load(); nonce += m.workers {
+				hash := hasher.hash(nonce)
+				hashed++
+				if toBigInt(hash[:]).Cmp(target) == -1 {
+					for {
+						current := best.Load()
+						if int64(nonce) >= current || best.CompareAndSwap(current, int64(nonce)) {
+							break
+						}
+					}
+					break
+				}
+				if hashed%hashBatch == 0 {
+					m.hashes.Add(hashBatch)
+					if ctx.Err() != nil {
+						return
+					}
+				}
+				if nonce > m.nonceSpace-m.workers {
+					break
+				}
+			}
+			m.hashes.Add(int64(hashed % hashBatch))
+		}(w)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	nonce := best.Load()
+	if nonce == math.MaxInt64 {
+		return 0, nil, errNonceSpaceExhausted
+	}
+	hash := hasher.hash(int(nonce))
+	return int(nonce), hash[:], nil
+}
+
+// rollExtraNonce replaces the coinbase of the block by a copy carrying the
+// extra nonce after its data
+func rollExtraNonce(block *Block, coinbaseData []byte, extraNonce int) {
+	coinbase := *block.Transactions[0]
+	in := coinbase.Vin[0]
+	in.PubKey = append(append([]byte{}, coinbaseData...), IntToHex(int64(extraNonce))...)
+	coinbase.Vin = append([]TXInput{in}, coinbase.Vin[1:]...)
+	coinbase.ID = coinbase.Hash()
+	block.Transactions = append([]*Transaction{&coinbase}, block.Transactions[1:]...)
+	block.updateMerkleRoot()
+}
+
+// Hashrate returns the hashes per second of the current or last run
+func (m *Miner) Hashrate() float64 {
+	m.mu.Lock()
+	start, end := m.start, m.end
+	m.mu.Unlock()
+	if start.IsZero() {
+		return 0
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	seconds := end.Sub(start).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(m.hashes.Load()) / seconds
+}
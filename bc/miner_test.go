@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMinerBlock(data string) *Block {
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, data)
+	return NewBlock(TestBlockTime, []*Transaction{cbTx}, nil)
+}
+
+func TestMinerMine(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			block := newTestMinerBlock("miner")
+			m := NewMiner(workers)
+			assert.Nil(t, m.Mine(context.Background(), block))
+			assert.Greater(t, m.Hashrate(), 0.0)
+
+			// the nonce is the one found by a sequential search
+			expected := newTestMinerBlock("miner")
+			expected.Mine()
+			assert.Equal(t, expected.Nonce, block.Nonce)
+			assert.Equal(t, expected.Hash, block.Hash)
+			assert.True(t, NewProofOfWork(block).Validate())
+		})
+	}
+}
+
+func TestMinerExtraNonce(t *testing.T) {
+	block := newTestMinerBlock("extra nonce")
+	coinbaseData := block.Transactions[0].Vin[0].PubKey
+	m := NewMiner(2)
+	// only the nonce 0 is tried
+	m.nonceSpace = 0
+	assert.Nil(t, m.Mine(context.Background(), block))
+	assert.Equal(t, 0, block.Nonce)
+
+	coinbase := block.Transactions[0]
+	assert.Equal(t, len(coinbaseData)+8, len(coinbase.Vin[0].PubKey), "the extra nonce is rolled")
+	assert.True(t, bytes.HasPrefix(coinbase.Vin[0].PubKey, coinbaseData))
+	assert.Equal(t, coinbase.Hash(), coinbase.ID)
+	assert.True(t, NewProofOfWork(block).Validate())
+}
+
+func TestMinerErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, NewMiner(2).Mine(ctx, newTestMinerBlock("canceled")), context.Canceled)
+
+	assert.ErrorIs(t, NewMiner(2).Mine(context.Background(), &Block{}), ErrNoCoinbase)
+}
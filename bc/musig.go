@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+// MuSig2 key aggregation and multi-signatures, following BIP327:
+// https://github.com/bitcoin/bips/blob/master/bip-0327.mediawiki
+// Several signers aggregate their keys into one x-only key and jointly
+// produce a single BIP340 signature, so a multi-party spend is
+// indistinguishable from a single-key spend on chain.
+
+// MuSigPubNonceLen is the size of a public nonce, two compressed points
+const MuSigPubNonceLen = 2 * compressedPubKeyLen
+
+var (
+	ErrNoMuSigKeys        = errors.New("no keys to aggregate")
+	ErrInvalidMuSigNonce  = errors.New("invalid MuSig nonce")
+	ErrNotMuSigSigner     = errors.New("key is not part of the MuSig session")
+	ErrMuSigNonceReused   = errors.New("MuSig secret nonce was already used")
+	ErrInvalidPartialSig  = errors.New("invalid MuSig partial signature")
+	ErrMuSigMissingSigner = errors.New("missing MuSig partial signatures")
+)
+
+// MuSigKeyAgg is the aggregation of the compressed public keys of the signers
+type MuSigKeyAgg struct {
+	pubKeys   [][]byte
+	hashKeys  []byte // hash of the list of keys
+	secondKey []byte // first key different from the first one
+	Qx, Qy    *big.Int
+}
+
+// AggregatePubKeys aggregates the SEC1 compressed secp256k1 keys of the signers.
+// The order of the keys matters.
+func AggregatePubKeys(pubKeys [][]byte) (*MuSigKeyAgg, error) {
+	if len(pubKeys) == 0 {
+		return nil, ErrNoMuSigKeys
+	}
+	curve := S256()
+	agg := &MuSigKeyAgg{pubKeys: pubKeys, Qx: new(big.Int), Qy: new(big.Int)}
+	agg.hashKeys = taggedHash("KeyAgg list", pubKeys...)
+	for _, pk := range pubKeys[1:] {
+		if !bytes.Equal(pk, pubKeys[0]) {
+			agg.secondKey = pk
+			break
+		}
+	}
+	for _, pk := range pubKeys {
+		P, err := parsePubKey(curve, pk)
+		if err != nil {
+			return nil, err
+		}
+		aPx, aPy := curve.ScalarMult(P.X, P.Y, agg.coefficient(pk).Bytes())
+		agg.Qx, agg.Qy = curve.Add(agg.Qx, agg.Qy, aPx, aPy)
+	}
+	if agg.Qx.Sign() == 0 && agg.Qy.Sign() == 0 {
+		return nil, ErrInvalidPubKey
+	}
+	return agg, nil
+}
+
+// PubKey returns the aggregated x-only key, usable as a Schnorr output key
+func (agg *MuSigKeyAgg) PubKey() []byte {
+	return xOnlyBytes(agg.Qx)
+}
+
+// coefficient returns the factor of a signer key in the aggregated key.
+// The second distinct key gets 1 as an optimization.
+func (agg *MuSigKeyAgg) coefficient(pubKey []byte) *big.Int {
+	if agg.secondKey != nil && bytes.Equal(pubKey, agg.secondKey) {
+		return big.NewInt(1)
+	}
+	return hashToScalar(taggedHash("KeyAgg coefficient", agg.hashKeys, pubKey))
+}
+
+func (agg *MuSigKeyAgg) hasKey(pubKey []byte) bool {
+	for _, pk := range agg.pubKeys {
+		if bytes.Equal(pk, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// MuSigNonce is the secret nonce of a signer for one signing session.
+// It must never be used for two sessions.
+type MuSigNonce struct {
+	k1, k2 *big.Int
+	// PubNonce is shared with the other signers
+	PubNonce []byte
+}
+
+// NewMuSigNonce generates a fresh secret nonce and its public nonce
+func NewMuSigNonce() (*MuSigNonce, error) {
+	curve := S256()
+	k1, err := randScalar()
+	if err != nil {
+		return nil, err
+	}
+	k2, err := randScalar()
+	if err != nil {
+		return nil, err
+	}
+	R1x, R1y := curve.ScalarBaseMult(k1.Bytes())
+	R2x, R2y := curve.ScalarBaseMult(k2.Bytes())
+	pubNonce := append(elliptic.MarshalCompressed(curve, R1x, R1y), elliptic.MarshalCompressed(curve, R2x, R2y)...)
+	return &MuSigNonce{k1: k1, k2: k2, PubNonce: pubNonce}, nil
+}
+
+// MuSigSession holds the values shared by all signers of a message
+type MuSigSession struct {
+	keyAgg *MuSigKeyAgg
+	msg    []byte
+	b      *big.Int // nonce coefficient
+	e      *big.Int // challenge
+	Rx, Ry *big.Int // final nonce
+}
+
+// NewMuSigSession starts the signing of msg once all public nonces are known.
+// The public nonces must be in the same order as the keys.
+func NewMuSigSession(keyAgg *MuSigKeyAgg, pubNonces [][]byte, msg []byte) (*MuSigSession, error) {
+	if len(pubNonces) != len(keyAgg.pubKeys) {
+		return nil, ErrInvalidMuSigNonce
+	}
+	curve := S256()
+	R1x, R1y := new(big.Int), new(big.Int)
+	R2x, R2y := new(big.Int), new(big.Int)
+	for _, nonce := range pubNonces {
+		if len(nonce) != MuSigPubNonceLen {
+			return nil, ErrInvalidMuSigNonce
+		}
+		x1, y1 := elliptic.UnmarshalCompressed(curve, nonce[:compressedPubKeyLen])
+		x2, y2 := elliptic.UnmarshalCompressed(curve, nonce[compressedPubKeyLen:])
+		if x1 == nil || x2 == nil {
+			return nil, ErrInvalidMuSigNonce
+		}
+		R1x, R1y = curve.Add(R1x, R1y, x1, y1)
+		R2x, R2y = curve.Add(R2x, R2y, x2, y2)
+	}
+	aggNonce := append(marshalPointExt(R1x, R1y), marshalPointExt(R2x, R2y)...)
+
+	s := &MuSigSession{keyAgg: keyAgg, msg: msg}
+	s.b = hashToScalar(taggedHash("MuSig/noncecoef", aggNonce, keyAgg.PubKey(), msg))
+	bR2x, bR2y := curve.ScalarMult(R2x, R2y, s.b.Bytes())
+	s.Rx, s.Ry = curve.Add(R1x, R1y, bR2x, bR2y)
+	if s.Rx.Sign() == 0 && s.Ry.Sign() == 0 {
+		s.Rx, s.Ry = curve.Params().Gx, curve.Params().Gy
+	}
+	s.e = hashToScalar(taggedHash("BIP0340/challenge", xOnlyBytes(s.Rx), keyAgg.PubKey(), msg))
+	return s, nil
+}
+
+// marshalPointExt compresses a point, the point at infinity being 33 zero bytes
+func marshalPointExt(x, y *big.Int) []byte {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return make([]byte, compressedPubKeyLen)
+	}
+	return elliptic.MarshalCompressed(S256(), x, y)
+}
+
+// PartialSign returns the partial signature of a signer.
+// The secret nonce is erased so that it cannot be reused.
+func (s *MuSigSession) PartialSign(privKey *ecdsa.PrivateKey, nonce *MuSigNonce) ([]byte, error) {
+	if privKey.Curve != S256() {
+		return nil, ErrKeyTypeMismatch
+	}
+	if nonce.k1 == nil {
+		return nil, ErrMuSigNonceReused
+	}
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	if !s.keyAgg.hasKey(pubKey) {
+		return nil, ErrNotMuSigSigner
+	}
+	N := S256().Params().N
+	k1, k2 := nonce.k1, nonce.k2
+	nonce.k1, nonce.k2 = nil, nil
+	if s.Ry.Bit(0) == 1 {
+		k1, k2 = negateScalar(k1), negateScalar(k2)
+	}
+	d := new(big.Int).Set(privKey.D)
+	if s.keyAgg.Qy.Bit(0) == 1 {
+		d = negateScalar(d)
+	}
+	// k1 + b*k2 + e*a*d
+	sig := new(big.Int).Mul(s.b, k2)
+	sig.Add(sig, k1)
+	ead := new(big.Int).Mul(s.e, s.keyAgg.coefficient(pubKey))
+	ead.Mul(ead, d)
+	sig.Add(sig, ead)
+	sig.Mod(sig, N)
+	return sig.FillBytes(make([]byte, 32)), nil
+}
+
+// Aggregate combines the partial signatures of all signers into a BIP340
+// signature valid for the aggregated key
+func (s *MuSigSession) Aggregate(partialSigs [][]byte) ([]byte, error) {
+	if len(partialSigs) != len(s.keyAgg.pubKeys) {
+		return nil, ErrMuSigMissingSigner
+	}
+	N := S256().Params().N
+	sum := new(big.Int)
+	for _, partial := range partialSigs {
+		si := new(big.Int).SetBytes(partial)
+		if len(partial) != 32 || si.Cmp(N) >= 0 {
+			return nil, ErrInvalidPartialSig
+		}
+		sum.Add(sum, si)
+	}
+	sum.Mod(sum, N)
+	sig := append(xOnlyBytes(s.Rx), sum.FillBytes(make([]byte, 32))...)
+	if !SchnorrVerify(s.keyAgg.PubKey(), s.msg, sig) {
+		return nil, ErrInvalidPartialSig
+	}
+	return sig, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMuSigSigners(t *testing.T, n int) ([]*ecdsa.PrivateKey, [][]byte) {
+	var privKeys []*ecdsa.PrivateKey
+	var pubKeys [][]byte
+	for i := 0; i < n; i++ {
+		privKey, pubKey := newKeyPairOfType(KeyTypeSecp256k1)
+		if pubKey == nil {
+			t.Fatal("could not generate a secp256k1 key")
+		}
+		privKeys = append(privKeys, &privKey)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	return privKeys, pubKeys
+}
+
+// muSign runs a MuSig session between all signers
+func muSign(t *testing.T, privKeys []*ecdsa.PrivateKey, keyAgg *MuSigKeyAgg, msg []byte) []byte {
+	var nonces []*MuSigNonce
+	var pubNonces [][]byte
+	for range privKeys {
+		nonce, err := NewMuSigNonce()
+		assert.Nil(t, err)
+		nonces = append(nonces, nonce)
+		pubNonces = append(pubNonces, nonce.PubNonce)
+	}
+	session, err := NewMuSigSession(keyAgg, pubNonces, msg)
+	assert.Nil(t, err)
+	var partialSigs [][]byte
+	for i, privKey := range privKeys {
+		partialSig, err := session.PartialSign(privKey, nonces[i])
+		assert.Nil(t, err)
+		partialSigs = append(partialSigs, partialSig)
+	}
+	sig, err := session.Aggregate(partialSigs)
+	assert.Nil(t, err)
+	return sig
+}
+
+func TestAggregatePubKeys(t *testing.T) {
+	_, pubKeys := newTestMuSigSigners(t, 3)
+
+	keyAgg, err := AggregatePubKeys(pubKeys)
+	assert.Nil(t, err)
+	assert.Equal(t, SchnorrPubKeyLen, len(keyAgg.PubKey()))
+
+	// the aggregated key depends on the order of the keys
+	reordered, err := AggregatePubKeys([][]byte{pubKeys[1], pubKeys[0], pubKeys[2]})
+	assert.Nil(t, err)
+	assert.NotEqual(t, keyAgg.PubKey(), reordered.PubKey())
+
+	_, err = AggregatePubKeys(nil)
+	assert.ErrorIs(t, err, ErrNoMuSigKeys)
+	_, err = AggregatePubKeys([][]byte{pubKeys[0][1:]})
+	assert.ErrorIs(t, err, ErrInvalidPubKey)
+}
+
+func TestMuSign(t *testing.T) {
+	privKeys, pubKeys := newTestMuSigSigners(t, 3)
+	keyAgg, _ := AggregatePubKeys(pubKeys)
+	msg := taggedHash("test", []byte("musig"))
+
+	sig := muSign(t, privKeys, keyAgg, msg)
+	assert.True(t, SchnorrVerify(keyAgg.PubKey(), msg, sig))
+	for _, pubKey := range pubKeys {
+		assert.False(t, SchnorrVerify(pubKey[1:], msg, sig))
+	}
+}
+
+func TestMuSigSessionErrors(t *testing.T) {
+	privKeys, pubKeys := newTestMuSigSigners(t, 2)
+	keyAgg, _ := AggregatePubKeys(pubKeys)
+	msg := taggedHash("test", []byte("musig"))
+	nonce1, _ := NewMuSigNonce()
+	nonce2, _ := NewMuSigNonce()
+
+	_, err := NewMuSigSession(keyAgg, [][]byte{nonce1.PubNonce}, msg)
+	assert.ErrorIs(t, err, ErrInvalidMuSigNonce)
+	_, err = NewMuSigSession(keyAgg, [][]byte{nonce1.PubNonce, nonce2.PubNonce[1:]}, msg)
+	assert.ErrorIs(t, err, ErrInvalidMuSigNonce)
+
+	session, err := NewMuSigSession(keyAgg, [][]byte{nonce1.PubNonce, nonce2.PubNonce}, msg)
+	assert.Nil(t, err)
+
+	outsider, _ := newKeyPairOfType(KeyTypeSecp256k1)
+	_, err = session.PartialSign(&outsider, nonce1)
+	assert.ErrorIs(t, err, ErrNotMuSigSigner)
+
+	partialSig1, err := session.PartialSign(privKeys[0], nonce1)
+	assert.Nil(t, err)
+	_, err = session.PartialSign(privKeys[0], nonce1)
+	assert.ErrorIs(t, err, ErrMuSigNonceReused)
+
+	_, err = session.Aggregate([][]byte{partialSig1})
+	assert.ErrorIs(t, err, ErrMuSigMissingSigner)
+	// a partial signature made with a wrong key does not aggregate
+	_, err = session.Aggregate([][]byte{partialSig1, partialSig1})
+	assert.ErrorIs(t, err, ErrInvalidPartialSig)
+}
+
+func TestMuSigSpend(t *testing.T) {
+	privKeys, pubKeys := newTestMuSigSigners(t, 3)
+	keyAgg, _ := AggregatePubKeys(pubKeys)
+
+	// user1 pays 6 coins to the aggregated key
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddSchnorrOutput(keyAgg.PubKey(), 6))
+	fundTx, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(fundTx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "fund")
+	_, err = bc.MineBlock([]*Transaction{cbTx, fundTx})
+	assert.Nil(t, err)
+
+	// the signers jointly spend it to user2, as a single-key spend
+	builder = NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddForeignInput(fundTx.ID, 0, keyAgg.PubKey()))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 5))
+	spendTx, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, spendTx.Vin[0].PubKey)
+
+	prevTXs, _ := bc.GetInputTXsOf(spendTx)
+	sigHash, err := spendTx.SigHash(prevTXs)
+	assert.Nil(t, err)
+	spendTx.Vin[0].Signature = muSign(t, privKeys, keyAgg, sigHash)
+	assert.Nil(t, spendTx.Verify(prevTXs))
+
+	// a tampered transaction fails the batch verification of its block
+	tampered := *spendTx
+	tampered.Vout = []TXOutput{{Value: 6, PubKeyHash: GetPubKeyHashFromAddress(testAddressUser1)}}
+	tampered.ID = tampered.Hash()
+	assert.ErrorIs(t, tampered.Verify(prevTXs), ErrBadSignature)
+	cbTx, _ = NewCoinbaseTX(testAddressUser1, "tampered")
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx, &tampered}, bc.CurrentBlock().Hash)
+	assert.Nil(t, block.AddWitnessCommitment())
+	block.Mine()
+	assert.ErrorIs(t, bc.ValidateBlock(block), ErrBadSignature)
+
+	cbTx, _ = NewCoinbaseTX(testAddressUser1, "spend")
+	_, err = bc.MineBlock([]*Transaction{cbTx, spendTx})
+	assert.Nil(t, err)
+	_, err = bc.FindTransaction(spendTx.ID)
+	assert.Nil(t, err)
+}
+
+func TestSignSchnorr(t *testing.T) {
+	privKey, _ := newKeyPairOfType(KeyTypeSecp256k1)
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddSchnorrOutput(SchnorrPubKey(&privKey), 4))
+	fundTx, _ := builder.Build()
+	assert.Nil(t, bc.SignTransaction(fundTx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "fund")
+	_, err = bc.MineBlock([]*Transaction{cbTx, fundTx})
+	assert.Nil(t, err)
+
+	// the Schnorr output and the change of user1 are spent together
+	builder = NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddForeignInput(fundTx.ID, 0, SchnorrPubKey(&privKey)))
+	assert.Nil(t, builder.AddInput(fundTx.ID, 1))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 10))
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	prevTXs, _ := bc.GetInputTXsOf(tx)
+
+	assert.Nil(t, tx.SignSchnorr(&privKey, prevTXs))
+	assert.ErrorIs(t, tx.Verify(prevTXs), ErrBadSignature, "the ECDSA input is not signed yet")
+	assert.Nil(t, tx.Sign(*privKey1, prevTXs))
+	assert.Equal(t, SchnorrSignatureLen, len(tx.Vin[0].Signature), "the Schnorr signature is kept")
+	assert.Nil(t, tx.Verify(prevTXs))
+
+	// ECDSA keys cannot make Schnorr signatures
+	assert.ErrorIs(t, tx.SignSchnorr(privKey1, prevTXs), ErrKeyTypeMismatch)
+}
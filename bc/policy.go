@@ -0,0 +1,140 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// The mempool policy decides which valid transactions are relayed and kept
+// in the mempool. It protects the node from floods of cheap or unusual
+// transactions, but blocks are only judged by the consensus rules.
+
+var (
+	ErrTxNotStandard = errors.New("transaction is not standard")
+	ErrDustOutput    = errors.New("output value is below the dust threshold")
+	ErrFeeTooLow     = errors.New("transaction fee is below the minimum relay fee")
+	ErrMempoolFull   = errors.New("mempool is full")
+)
+
+// MempoolPolicy holds the rules transactions must follow on top of the
+// consensus rules to enter the mempool
+type MempoolPolicy struct {
+	// MinRelayFeeRate is the lowest fee rate of a transaction, or of a
+	// package added with AddPackage
+	MinRelayFeeRate FeeRatePerKB
+	// DustThreshold is the lowest value of an output, data-carrier outputs
+	// excepted
+	DustThreshold int
+	// MaxStandardTxSize is the maximum size in bytes of a transaction
+	MaxStandardTxSize int
+	// AllowedOutputs are the types of outputs a transaction may have
+	AllowedOutputs []OutputType
+	// MaxMempoolSize is the maximum total size in bytes of the mempool
+	// transactions. The transactions paying the lowest fee rate are evicted
+	// to make room.
+	MaxMempoolSize int
+}
+
+// DefaultMinRelayFeeRate is the lowest fee rate relayed by default, 1 coin
+// for a transaction of up to 1000 bytes. It keeps free transactions from
+// filling the mempool at no cost.
+const DefaultMinRelayFeeRate FeeRatePerKB = 1
+
+// DefaultMempoolPolicy rejects outputs of no value and transactions paying
+// less than DefaultMinRelayFeeRate, which wallets pay by default.
+var DefaultMempoolPolicy = MempoolPolicy{
+	MinRelayFeeRate:   DefaultMinRelayFeeRate,
+	DustThreshold:     1,
+	MaxStandardTxSize: MaxTxSize / 2,
+	AllowedOutputs:    []OutputType{OutputPubKeyHash, OutputSchnorr, OutputHTLC, OutputDataCarrier},
+	MaxMempoolSize:    100 * MaxBlockSize,
+}
+
+// checkStandard checks the transaction of the given size against the
+// policy rules, except the fee rate
+func (p *MempoolPolicy) checkStandard(tx *Transaction, size int) error {
+	if size > p.MaxStandardTxSize {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrTxNotStandard, size, p.MaxStandardTxSize)
+	}
+	if !tx.IsStandard() {
+		return fmt.Errorf("%w: invalid data-carrier outputs", ErrTxNotStandard)
+	}
+	for i, out := range tx.Vout {
+		if !slices.Contains(p.AllowedOutputs, out.Type()) {
+			return fmt.Errorf("%w: output %d of type %s", ErrTxNotStandard, i, out.Type())
+		}
+		if !out.IsDataCarrier() && out.Value < p.DustThreshold {
+			return fmt.Errorf("%w: output %d of value %d", ErrDustOutput, i, out.Value)
+		}
+	}
+	return nil
+}
+
+// checkFeeRate checks that fee pays the minimum relay fee rate for size bytes
+func (p *MempoolPolicy) checkFeeRate(fee, size int) error {
+	if minFee := p.MinRelayFeeRate.feeForSize(size); fee < minFee {
+		return fmt.Errorf("%w: %d, at least %d needed", ErrFeeTooLow, fee, minFee)
+	}
+	return nil
+}
+
+// trim evicts the transactions paying the lowest fee rate, with their
+// descendants, until the mempool fits its maximum size. A transaction is
+// ranked by the fee rate of it and its descendants, as they leave together.
+// The ranks are computed once and updated as descendants are evicted.
+// It fails with ErrMempoolFull when one of the added transactions is
+// evicted, leaving the mempool to be rolled back by the caller.
+func (mp *Mempool) trim(added []*Transaction) error {
+	size := mp.Size()
+	if size <= mp.policy.MaxMempoolSize {
+		return nil
+	}
+	queue := &packageQueue{lowestFirst: true}
+	packages := make(map[string]*packageEntry)
+	for txID, e := range mp.entries {
+		p := &packageEntry{MempoolEntry: e, txID: txID}
+		for _, d := range mp.withDescendants([]*MempoolEntry{e}) {
+			p.fee += d.Fee
+			p.size += d.Size
+		}
+		packages[txID] = p
+		heap.Push(queue, packageRank{p, p.fee, p.size})
+	}
+	for size > mp.policy.MaxMempoolSize && queue.Len() > 0 {
+		r := heap.Pop(queue).(packageRank)
+		lowest := r.entry
+		if !mp.Has(lowest.Tx.ID) || r.fee != lowest.fee || r.size != lowest.size {
+			continue
+		}
+		evicted := mp.withDescendants([]*MempoolEntry{lowest.MempoolEntry})
+		for _, tx := range added {
+			if _, ok := evicted[fmt.Sprintf("%x", tx.ID)]; ok {
+				return fmt.Errorf("%w: the fee rate is too low to evict other transactions", ErrMempoolFull)
+			}
+		}
+		// the ancestors left in the mempool no longer pay for the evicted
+		// transactions
+		updated := make(map[string]*packageEntry)
+		for _, e := range evicted {
+			for txID := range mp.ancestors(e.Tx) {
+				if _, ok := evicted[txID]; !ok {
+					a := packages[txID]
+					a.fee -= e.Fee
+					a.size -= e.Size
+					updated[txID] = a
+				}
+			}
+		}
+		for _, e := range evicted {
+			mp.removeEntry(e)
+		}
+		for _, a := range updated {
+			heap.Push(queue, packageRank{a, a.fee, a.size})
+		}
+		size -= lowest.size
+	}
+	mp.rebuildUTXOs()
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolPolicy(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	genesisIn := TXInput{Txid: genesisTx.ID, OutIdx: 0, PubKey: pubKeyToByte(*pubKey1)}
+
+	dust := &Transaction{Vin: []TXInput{genesisIn}, Vout: []TXOutput{*NewTXOutput(0, testAddressUser2), *NewTXOutput(10, testAddressUser1)}}
+	dust.ID = dust.Hash()
+	assert.Nil(t, bc.SignTransaction(dust, *privKey1))
+	err := mp.Add(dust)
+	assert.ErrorIs(t, err, ErrDustOutput)
+	assert.Equal(t, ErrDustOutput.Error()+": output 0 of value 0", err.Error())
+
+	twoData := &Transaction{Vin: []TXInput{genesisIn}, Vout: []TXOutput{{Data: []byte{1}}, {Data: []byte{2}}, *NewTXOutput(10, testAddressUser1)}}
+	twoData.ID = twoData.Hash()
+	assert.Nil(t, bc.SignTransaction(twoData, *privKey1))
+	assert.ErrorIs(t, mp.Add(twoData), ErrTxNotStandard)
+
+	data, err := NewDataCarrierTransaction(pubKeyToByte(*pubKey1), []byte("anchor"), mp.utxos)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(data, *privKey1))
+	policy := DefaultMempoolPolicy
+	policy.AllowedOutputs = []OutputType{OutputPubKeyHash}
+	mp.SetPolicy(policy)
+	err = mp.Add(data)
+	assert.ErrorIs(t, err, ErrTxNotStandard)
+	assert.Contains(t, err.Error(), "of type data")
+
+	tx := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 1)
+	size := len(tx.Serialize())
+	policy = DefaultMempoolPolicy
+	policy.MaxStandardTxSize = size - 1
+	mp.SetPolicy(policy)
+	assert.ErrorIs(t, mp.Add(tx), ErrTxNotStandard)
+
+	// the minimum fee is 2 for transactions of that size
+	policy = DefaultMempoolPolicy
+	policy.MinRelayFeeRate = FeeRatePerKB(2000 / size)
+	mp.SetPolicy(policy)
+	err = mp.Add(tx)
+	assert.ErrorIs(t, err, ErrFeeTooLow)
+	assert.Equal(t, ErrFeeTooLow.Error()+": 1, at least 2 needed", err.Error())
+	assert.Equal(t, 0, mp.Len())
+	assert.Nil(t, mp.Add(spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 2)))
+
+	// the policy does not apply to blocks
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "dust")
+	_, err = bc.MineBlock([]*Transaction{cbTx, dust})
+	assert.Nil(t, err)
+}
+
+func TestMempoolPackageFeeRate(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	utxos := bc.FindUTXOSet()
+	parent := spendTestCoin(t, utxos, genesisTx, 0, 2, 0)
+	utxos.Update([]*Transaction{parent})
+	child := spendTestCoin(t, utxos, parent, 1, 1, 6)
+	policy := DefaultMempoolPolicy
+	policy.MinRelayFeeRate = FeeRatePerKB(2000 / len(parent.Serialize()))
+	mp.SetPolicy(policy)
+
+	assert.ErrorIs(t, mp.Add(parent), ErrFeeTooLow)
+	// the child pays for its parent
+	assert.Nil(t, mp.AddPackage([]*Transaction{parent, child}))
+	assert.Equal(t, 2, mp.Len())
+
+	mp = NewMempool(bc)
+	policy.MinRelayFeeRate = 100000
+	mp.SetPolicy(policy)
+	assert.ErrorIs(t, mp.AddPackage([]*Transaction{parent, child}), ErrFeeTooLow)
+	assert.Equal(t, 0, mp.Len())
+}
+
+func TestMempoolSizeLimit(t *testing.T) {
+	_, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 1)
+	txB := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	policy := DefaultMempoolPolicy
+	policy.MaxMempoolSize = len(txA.Serialize()) + len(txB.Serialize())
+	mp.SetPolicy(policy)
+	assert.Nil(t, mp.Add(txA))
+	assert.Nil(t, mp.Add(txB))
+	assert.Equal(t, policy.MaxMempoolSize, mp.Size())
+
+	// txA pays the lowest fee rate, it makes room for the child of txB
+	txC := spendTestCoin(t, mp.utxos, txB, 1, 1, 3)
+	assert.Nil(t, mp.Add(txC))
+	assert.False(t, mp.Has(txA.ID))
+	assert.Equal(t, 2, mp.Len())
+
+	// a transaction paying less than the mempool entries is rejected
+	txD := spendTestCoin(t, mp.utxos, genesisTx, 0, 9, 1)
+	err := mp.Add(txD)
+	assert.ErrorIs(t, err, ErrMempoolFull)
+	assert.Equal(t, 2, mp.Len())
+	assert.True(t, mp.Has(txB.ID))
+	assert.True(t, mp.Has(txC.ID))
+	assert.Equal(t, []*Transaction{txB, txC}, mp.Select(MaxBlockSize))
+}
+
+func TestMempoolSizeLimitUpdatesRanks(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	policy := DefaultMempoolPolicy
+	policy.MinRelayFeeRate = 0
+	mp.SetPolicy(policy)
+	parent := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 3)
+	assert.Nil(t, mp.Add(parent))
+	child := spendTestCoin(t, mp.utxos, parent, 1, 2, 0)
+	assert.Nil(t, mp.Add(child))
+	other := spendTestCoin(t, mp.utxos, cbTx, 0, 4, 2)
+	assert.Nil(t, mp.Add(other))
+	newCbTx, _ := NewCoinbaseTX(testAddressUser1, "new coin")
+	block, err := bc.MineBlock([]*Transaction{newCbTx})
+	assert.Nil(t, err)
+	mp.BlockConnected(block)
+
+	// the free child drags the rank of its parent below the one of other,
+	// until it is evicted
+	tx := spendTestCoin(t, mp.utxos, newCbTx, 0, 4, 4)
+	policy.MaxMempoolSize = len(parent.Serialize()) + len(tx.Serialize())
+	mp.SetPolicy(policy)
+	assert.Nil(t, mp.Add(tx))
+	assert.True(t, mp.Has(parent.ID))
+	assert.True(t, mp.Has(tx.ID))
+	assert.Equal(t, 2, mp.Len())
+}
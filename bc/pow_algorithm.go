@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PowAlgorithm identifies the hash function of the proof-of-work
+type PowAlgorithm int
+
+const (
+	// PowSHA256d hashes the header twice with SHA-256, as Bitcoin does
+	PowSHA256d PowAlgorithm = iota
+	// PowScrypt hashes the header with scrypt, as Litecoin does. Each hash
+	// needs 128*ScryptN*ScryptR bytes of memory, which a parallel miner must
+	// provide for every hash in flight.
+	PowScrypt
+)
+
+const (
+	// ScryptN is the CPU and memory cost of the scrypt proof-of-work
+	ScryptN = 1024
+	// ScryptR is the block size of the scrypt proof-of-work
+	ScryptR = 1
+	// ScryptP is the parallelization of the scrypt proof-of-work
+	ScryptP = 1
+	// ScryptTargetBits define the mining difficulty with scrypt. A scrypt
+	// hash with these parameters costs about as much as 2^10 SHA-256d header
+	// hashes (about 400µs against 400ns on a desktop CPU), more than the
+	// 2^TARGETBITS hashes of a SHA-256d block: a block needs 2^4 scrypt
+	// hashes on average, about 2^6 times the time of a SHA-256d block, and a
+	// few milliseconds.
+	ScryptTargetBits = 4
+)
+
+var ErrUnknownPowAlgorithm = errors.New("unknown proof-of-work algorithm")
+
+// TargetBits returns the mining difficulty calibrated for the algorithm
+func (a PowAlgorithm) TargetBits() int64 {
+	switch a {
+	case PowScrypt:
+		return ScryptTargetBits
+	default:
+		return TARGETBITS
+	}
+}
+
+func (a PowAlgorithm) String() string {
+	switch a {
+	case PowSHA256d:
+		return "sha256d"
+	case PowScrypt:
+		return "scrypt"
+	default:
+		return "unknown"
+	}
+}
+
+// ParsePowAlgorithm returns the proof-of-work algorithm with the given name
+func ParsePowAlgorithm(name string) (PowAlgorithm, error) {
+	for _, a := range []PowAlgorithm{PowSHA256d, PowScrypt} {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, ErrUnknownPowAlgorithm
+}
+
+// scryptHash returns the scrypt hash of the serialized header, salted with
+// itself
+func scryptHash(header []byte) [32]byte {
+	key, err := scrypt.Key(header, header, ScryptN, ScryptR, ScryptP, 32)
+	if err != nil {
+		panic(err)
+	}
+	var hash [32]byte
+	copy(hash[:], key)
+	return hash
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePowAlgorithm(t *testing.T) {
+	for _, a := range []PowAlgorithm{PowSHA256d, PowScrypt} {
+		parsed, err := ParsePowAlgorithm(a.String())
+		assert.Nil(t, err)
+		assert.Equal(t, a, parsed)
+	}
+	_, err := ParsePowAlgorithm("argon2")
+	assert.ErrorIs(t, err, ErrUnknownPowAlgorithm)
+}
+
+func TestScryptProofOfWork(t *testing.T) {
+	useChainParams(t, &ScryptChainParams)
+	block := newTestMinerBlock("scrypt")
+	assert.Nil(t, NewMiner(2).Mine(context.Background(), block))
+	assert.Equal(t, int64(ScryptTargetBits), block.Difficulty)
+	assert.True(t, NewProofOfWork(block).Validate())
+
+	// the block hash is the scrypt hash of the header
+	header := block.Header()
+	hash := scryptHash(header.Serialize())
+	assert.Equal(t, hash[:], block.Hash)
+	assert.NotEqual(t, header.Hash(), block.Hash)
+
+	// the nonce is the one found by a sequential search
+	expected := newTestMinerBlock("scrypt")
+	expected.Mine()
+	assert.Equal(t, expected.Nonce, block.Nonce)
+
+	useChainParams(t, &P256ChainParams)
+	assert.False(t, NewProofOfWork(block).Validate(), "the SHA-256d hash differs")
+}
+
+func TestScryptBlockchain(t *testing.T) {
+	useChainParams(t, &ScryptChainParams)
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(ScryptTargetBits), bc.Engine().Difficulty(bc, bc.CurrentBlock()))
+	assert.Nil(t, bc.ValidateBlock(bc.GetGenesisBlock()))
+
+	block := newTestBranch(t, bc, bc.CurrentBlock(), "scrypt", 1)[0]
+	assert.Nil(t, bc.ConnectBlock(block))
+
+	// a block mined with SHA-256d is rejected
+	useChainParams(t, &P256ChainParams)
+	sha256d := newTestBranch(t, bc, bc.CurrentBlock(), "sha256d", 1)[0]
+	useChainParams(t, &ScryptChainParams)
+	assert.ErrorIs(t, bc.ConnectBlock(sha256d), ErrInvalidBlock)
+}
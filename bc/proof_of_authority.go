@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+const (
+	// snapshotCheckpoint is the number of blocks between two snapshots kept
+	// by the engine, the other snapshots being replayed from the previous one
+	snapshotCheckpoint = 64
+
+	// diffInTurn is the difficulty of a block sealed by the signer whose turn
+	// it is
+	diffInTurn = 2
+	// diffNoTurn is the difficulty of a block sealed by another signer
+	diffNoTurn = 1
+)
+
+var (
+	ErrUnauthorizedSigner = errors.New("signer is not authorized")
+	ErrSignedRecently     = errors.New("signer sealed one of the recent blocks")
+)
+
+// ProofOfAuthorityEngine is the consensus engine of a chain sealed by a set
+// of signers taking turns, instead of a proof-of-work. A block is sealed
+// with an ECDSA signature of its hash, and the chain with the most blocks
+// sealed in turn is preferred.
+// A signer seals at most one of len(signers)/2+1 consecutive blocks, and
+// can vote in its blocks to add or remove a signer: the change applies when
+// more than half of the signers voted for it.
+type ProofOfAuthorityEngine struct {
+	signers   [][]byte // The signers of the genesis block, compressed public keys
+	key       *ecdsa.PrivateKey
+	proposals map[string]bool // The votes to cast, by signer hex, true to add it
+
+	checkpoints map[string]*signerSnapshot // The snapshots every snapshotCheckpoint blocks, by block hash hex
+	last        *signerSnapshot            // The snapshot asked for last
+	lastHash    string                     // The hash hex of the block of last
+}
+
+// SignerVote is the vote of a signer to add or remove another
+type SignerVote struct {
+	Signer    []byte // The public key voted on
+	Authorize bool   // true to add the signer, false to remove it
+}
+
+// authoritySeal is the seal of a block sealed by proof-of-authority
+type authoritySeal struct {
+	Signer    []byte      // The public key of the signer
+	Vote      *SignerVote // nil when the signer does not vote
+	Signature []byte      // The DER signature of the seal hash
+}
+
+// NewProofOfAuthorityEngine creates a proof-of-authority engine with the
+// initial signers, given as compressed public keys. It verifies blocks only
+// until a key is set with Authorize.
+func NewProofOfAuthorityEngine(signers [][]byte) *ProofOfAuthorityEngine {
+	return &ProofOfAuthorityEngine{signers: signers, proposals: make(map[string]bool), checkpoints: make(map[string]*signerSnapshot)}
+}
+
+// SetSigners replaces the signers of the genesis block, e.g. to configure
+// the engine of the chain parameters before the chain is created
+func (e *ProofOfAuthorityEngine) SetSigners(signers [][]byte) {
+	e.signers = signers
+	e.checkpoints = make(map[string]*signerSnapshot)
+	e.last, e.lastHash = nil, ""
+}
+
+// Authorize sets the key the blocks are sealed with
+func (e *ProofOfAuthorityEngine) Authorize(key *ecdsa.PrivateKey) {
+	e.key = key
+}
+
+// Propose makes the next blocks sealed by this node vote to add or remove
+// the signer, until the change applies or Discard is called
+func (e *ProofOfAuthorityEngine) Propose(signer []byte, authorize bool) {
+	e.proposals[hex.EncodeToString(signer)] = authorize
+}
+
+// Discard drops a proposal made with Propose
+func (e *ProofOfAuthorityEngine) Discard(signer []byte) {
+	delete(e.proposals, hex.EncodeToString(signer))
+}
+
+// Signers returns the signers allowed to seal a block built on parent, nil
+// for the genesis block, in turn order
+func (e *ProofOfAuthorityEngine) Signers(chain *Blockchain, parent *Block) ([][]byte, error) {
+	snap, _, err := e.snapshot(chain, parent)
+	if err != nil {
+		return nil, err
+	}
+	var signers [][]byte
+	for _, signer := range snap.sorted() {
+		signers = append(signers, Hex2Bytes(signer))
+	}
+	return signers, nil
+}
+
+// Prepare implements ConsensusEngine
+func (e *ProofOfAuthorityEngine) Prepare(chain *Blockchain, block *Block) error {
+	block.Difficulty = e.Difficulty(chain, chain.parentOf(block))
+	block.updateMerkleRoot()
+	return nil
+}
+
+// Seal implements ConsensusEngine. The block votes for one of the
+// proposals still making a change.
+func (e *ProofOfAuthorityEngine) Seal(ctx context.Context, chain *Blockchain, block *Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.key == nil {
+		return ErrUnauthorizedSigner
+	}
+	snap, _, err := e.snapshot(chain, chain.parentOf(block))
+	if err != nil {
+		return err
+	}
+	seal := authoritySeal{Signer: pubKeyToByte(e.key.PublicKey)}
+	signer := hex.EncodeToString(seal.Signer)
+	if !snap.signers[signer] {
+		return ErrUnauthorizedSigner
+	}
+	if snap.signedRecently(signer) {
+		return ErrSignedRecently
+	}
+	for _, subject := range sortedKeys(e.proposals) {
+		if authorize := e.proposals[subject]; snap.signers[subject] != authorize {
+			seal.Vote = &SignerVote{Signer: Hex2Bytes(subject), Authorize: authorize}
+			break
+		}
+	}
+	block.Nonce = 0
+	header := block.Header()
+	block.Hash = header.Hash()
+	r, s := signRFC6979(e.key, seal.hash(block.Hash))
+	seal.Signature = encodeSignatureDER(r, normalizeS(e.key.Curve, s))
+	block.Seal = seal.Serialize()
+	return nil
+}
+
+// VerifySeal implements ConsensusEngine
+func (e *ProofOfAuthorityEngine) VerifySeal(chain *Blockchain, block *Block) error {
+	seal, err := deserializeAuthoritySeal(block.Seal)
+	if err != nil {
+		return err
+	}
+	parent := chain.parentOf(block)
+	if parent == nil && block.PrevBlockHash != nil {
+		return ErrBlockNotFound
+	}
+	snap, height, err := e.snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+	signer := hex.EncodeToString(seal.Signer)
+	if !snap.signers[signer] {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedSigner, signer)
+	}
+	if snap.signedRecently(signer) {
+		return fmt.Errorf("%w: %s", ErrSignedRecently, signer)
+	}
+	if expected := snap.difficulty(height, signer); block.Difficulty != expected {
+		return fmt.Errorf("%w: %d, expected %d", ErrBadDifficulty, block.Difficulty, expected)
+	}
+	header := block.Header()
+	if !bytes.Equal(block.Hash, header.Hash()) {
+		return ErrInvalidSeal
+	}
+	curve := ActiveChainParams.KeyType.Curve()
+	pubKey, err := parsePubKey(curve, seal.Signer)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	r, s, err := parseSignatureDER(curve, seal.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	if !ecdsa.Verify(pubKey, seal.hash(block.Hash), r, s) {
+		return ErrInvalidSeal
+	}
+	return nil
+}
+
+// Difficulty implements ConsensusEngine: diffInTurn when it is the turn of
+// the authorized key, diffNoTurn otherwise
+func (e *ProofOfAuthorityEngine) Difficulty(chain *Blockchain, parent *Block) int64 {
+	snap, height, err := e.snapshot(chain, parent)
+	if err != nil || e.key == nil {
+		return diffNoTurn
+	}
+	return snap.difficulty(height, hex.EncodeToString(pubKeyToByte(e.key.PublicKey)))
+}
+
+// ForkChoice implements ConsensusEngine: the branch with the highest total
+// difficulty is preferred, the current one on a tie
+func (e *ProofOfAuthorityEngine) ForkChoice(current, candidate []*Block) bool {
+	return totalDifficulty(candidate) > totalDifficulty(current)
+}
+
+func totalDifficulty(blocks []*Block) int64 {
+	var total int64
+	for _, b := range blocks {
+		total += b.Difficulty
+	}
+	return total
+}
+
+// snapshot returns the signers and the votes after parent, and the height of
+// the next block. The seals are replayed from the nearest snapshot kept, a
+// checkpoint or the last one asked for, or from the genesis block.
+// The snapshots are kept by block hash, which fixes the blocks before it, so
+// they stay valid across reorganizations.
+func (e *ProofOfAuthorityEngine) snapshot(chain *Blockchain, parent *Block) (*signerSnapshot, int, error) {
+	if parent == nil {
+		return newSignerSnapshot(e.signers), 0, nil
+	}
+	height := -1
+	for h := len(chain.blocks) - 1; h >= 0; h-- {
+		if bytes.Equal(chain.blocks[h].Hash, parent.Hash) {
+			height = h
+			break
+		}
+	}
+	if height < 0 {
+		return nil, 0, ErrBlockNotFound
+	}
+	snap, start := newSignerSnapshot(e.signers), 0
+	for h := height; h >= 0; h-- {
+		if kept := e.kept(hex.EncodeToString(chain.blocks[h].Hash)); kept != nil {
+			snap, start = kept.copy(), h+1
+			break
+		}
+	}
+	for h := start; h <= height; h++ {
+		b := chain.blocks[h]
+		seal, err := deserializeAuthoritySeal(b.Seal)
+		if err != nil {
+			return nil, 0, fmt.Errorf("block %x: %w", b.Hash, err)
+		}
+		snap.apply(hex.EncodeToString(seal.Signer), seal.Vote)
+		if (h+1)%snapshotCheckpoint == 0 {
+			e.checkpoints[hex.EncodeToString(b.Hash)] = snap.copy()
+		}
+	}
+	e.last, e.lastHash = snap, hex.EncodeToString(parent.Hash)
+	return snap, height + 1, nil
+}
+
+// kept returns the snapshot kept after the block of the given hash hex, nil
+// if none
+func (e *ProofOfAuthorityEngine) kept(hash string) *signerSnapshot {
+	if e.last != nil && e.lastHash == hash {
+		return e.last
+	}
+	return e.checkpoints[hash]
+}
+
+// hash returns the message signed by the signer: the block hash, the signer
+// and its vote
+func (seal *authoritySeal) hash(blockHash []byte) []byte {
+	data := append(append([]byte{}, blockHash...), seal.Signer...)
+	if seal.Vote != nil {
+		authorize := byte(0)
+		if seal.Vote.Authorize {
+			authorize = 1
+		}
+		data = append(append(data, authorize), seal.Vote.Signer...)
+	}
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// Serialize returns the gob encoding of the seal
+func (seal authoritySeal) Serialize() []byte {
+	var buff bytes.Buffer
+	if err := gob.NewEncoder(&buff).Encode(seal); err != nil {
+		panic("Could not encode the seal!")
+	}
+	return buff.Bytes()
+}
+
+func deserializeAuthoritySeal(data []byte) (*authoritySeal, error) {
+	var seal authoritySeal
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&seal); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	return &seal, nil
+}
+
+// signerSnapshot is the state of the signers at a height
+type signerSnapshot struct {
+	signers map[string]bool            // The authorized signers by hex public key
+	votes   map[string]map[string]bool // The votes on a signer, by voter
+	recent  []string                   // The signers of the last blocks, the last one last
+}
+
+func newSignerSnapshot(signers [][]byte) *signerSnapshot {
+	snap := &signerSnapshot{signers: make(map[string]bool), votes: make(map[string]map[string]bool)}
+	for _, signer := range signers {
+		snap.signers[hex.EncodeToString(signer)] = true
+	}
+	return snap
+}
+
+// copy returns a deep copy of the snapshot, to apply blocks to
+func (snap *signerSnapshot) copy() *signerSnapshot {
+	c := &signerSnapshot{
+		signers: make(map[string]bool, len(snap.signers)),
+		votes:   make(map[string]map[string]bool, len(snap.votes)),
+		recent:  append([]string{}, snap.recent...),
+	}
+	for signer := range snap.signers {
+		c.signers[signer] = true
+	}
+	for subject, votes := range snap.votes {
+		c.votes[subject] = make(map[string]bool, len(votes))
+		for voter, v := range votes {
+			c.votes[subject][voter] = v
+		}
+	}
+	return c
+}
+
+// sorted returns the signers in turn order
+func (snap *signerSnapshot) sorted() []string {
+	return sortedKeys(snap.signers)
+}
+
+// difficulty returns the difficulty of the block at height sealed by signer
+func (snap *signerSnapshot) difficulty(height int, signer string) int64 {
+	sorted := snap.sorted()
+	if len(sorted) > 0 && sorted[height%len(sorted)] == signer {
+		return diffInTurn
+	}
+	return diffNoTurn
+}
+
+// signedRecently checks whether signer sealed one of the last
+// len(signers)/2 blocks
+func (snap *signerSnapshot) signedRecently(signer string) bool {
+	return slices.Contains(snap.recent, signer)
+}
+
+// apply records a block sealed by signer, and its vote
+func (snap *signerSnapshot) apply(signer string, vote *SignerVote) {
+	snap.recent = append(snap.recent, signer)
+	if vote != nil {
+		subject := hex.EncodeToString(vote.Signer)
+		if snap.votes[subject] == nil {
+			snap.votes[subject] = make(map[string]bool)
+		}
+		snap.votes[subject][signer] = vote.Authorize
+		snap.tally(subject)
+	}
+	if limit := len(snap.signers) / 2; len(snap.recent) > limit {
+		snap.recent = snap.recent[len(snap.recent)-limit:]
+	}
+}
+
+// tally applies the change of subject when more than half of the signers
+// voted for it. The votes of a removed signer are dropped.
+func (snap *signerSnapshot) tally(subject string) {
+	authorize := !snap.signers[subject]
+	count := 0
+	for voter, v := range snap.votes[subject] {
+		if v == authorize && snap.signers[voter] {
+			count++
+		}
+	}
+	if count <= len(snap.signers)/2 {
+		return
+	}
+	delete(snap.votes, subject)
+	if authorize {
+		snap.signers[subject] = true
+		return
+	}
+	delete(snap.signers, subject)
+	for _, votes := range snap.votes {
+		delete(votes, subject)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAuthorityChain creates a blockchain sealed by n signers, whose
+// keys are returned in turn order. The genesis block is sealed by the first.
+func newTestAuthorityChain(t *testing.T, n int) (*Blockchain, *ProofOfAuthorityEngine, []*ecdsa.PrivateKey) {
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < n; i++ {
+		key, _ := newKeyPair()
+		keys = append(keys, &key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(pubKeyToByte(keys[i].PublicKey), pubKeyToByte(keys[j].PublicKey)) < 0
+	})
+	var signers [][]byte
+	for _, key := range keys {
+		signers = append(signers, pubKeyToByte(key.PublicKey))
+	}
+	engine := NewProofOfAuthorityEngine(signers)
+	engine.Authorize(keys[0])
+	useChainParams(t, &ChainParams{Name: "poa", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: engine})
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	return bc, engine, keys
+}
+
+// sealTestBlock seals a block on top of the tip with key
+func sealTestBlock(bc *Blockchain, engine *ProofOfAuthorityEngine, key *ecdsa.PrivateKey) (*Block, error) {
+	engine.Authorize(key)
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, fmt.Sprintf("Reward at height %d", bc.Height()+1))
+	block := NewBlock(TestBlockTime, []*Transaction{cbTx}, bc.CurrentBlock().Hash)
+	if err := engine.Prepare(bc, block); err != nil {
+		return nil, err
+	}
+	if err := engine.Seal(context.Background(), bc, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// signerKey returns the key of the signer in turn at the given height
+func signerKey(t *testing.T, bc *Blockchain, engine *ProofOfAuthorityEngine, keys []*ecdsa.PrivateKey, height int) *ecdsa.PrivateKey {
+	signers, err := engine.Signers(bc, bc.CurrentBlock())
+	assert.Nil(t, err)
+	for _, key := range keys {
+		if bytes.Equal(pubKeyToByte(key.PublicKey), signers[height%len(signers)]) {
+			return key
+		}
+	}
+	t.Fatal("signer not found")
+	return nil
+}
+
+func TestProofOfAuthoritySeal(t *testing.T) {
+	bc, engine, keys := newTestAuthorityChain(t, 3)
+	assert.Nil(t, engine.VerifySeal(bc, bc.GetGenesisBlock()))
+
+	block, err := sealTestBlock(bc, engine, signerKey(t, bc, engine, keys, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(diffInTurn), block.Difficulty)
+	assert.Nil(t, bc.ConnectBlock(block))
+
+	// the signer in turn at height 3 seals the block at height 2
+	block, err = sealTestBlock(bc, engine, signerKey(t, bc, engine, keys, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(diffNoTurn), block.Difficulty)
+	assert.Nil(t, engine.VerifySeal(bc, block))
+
+	block.Difficulty = diffInTurn
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrBadDifficulty)
+	block.Difficulty = diffNoTurn
+	block.Timestamp++
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrInvalidSeal)
+	header := block.Header()
+	block.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrInvalidSeal, "the signature no longer matches")
+	block.Seal = []byte("seal")
+	assert.ErrorIs(t, engine.VerifySeal(bc, block), ErrInvalidSeal)
+
+	outsider, _ := newKeyPair()
+	_, err = sealTestBlock(bc, engine, &outsider)
+	assert.ErrorIs(t, err, ErrUnauthorizedSigner)
+
+	// a proof-of-work block is not sealed
+	pow := newTestBranch(t, &Blockchain{blocks: bc.blocks, engine: NewProofOfWorkEngine(1)}, bc.CurrentBlock(), "pow", 1)
+	assert.ErrorIs(t, bc.ConnectBlock(pow[0]), ErrInvalidBlock)
+}
+
+func TestProofOfAuthorityRecentSigners(t *testing.T) {
+	bc, engine, keys := newTestAuthorityChain(t, 3)
+	block, err := sealTestBlock(bc, engine, keys[1])
+	assert.Nil(t, err)
+	assert.Nil(t, bc.ConnectBlock(block))
+
+	// one of 2 consecutive blocks at most
+	_, err = sealTestBlock(bc, engine, keys[1])
+	assert.ErrorIs(t, err, ErrSignedRecently)
+	block, err = sealTestBlock(bc, engine, keys[2])
+	assert.Nil(t, err)
+	assert.Nil(t, bc.ConnectBlock(block))
+	block, err = sealTestBlock(bc, engine, keys[1])
+	assert.Nil(t, err)
+	assert.Nil(t, bc.ConnectBlock(block))
+
+	// a single signer seals every block
+	bc, engine, keys = newTestAuthorityChain(t, 1)
+	for i := 0; i < 3; i++ {
+		block, err := sealTestBlock(bc, engine, keys[0])
+		assert.Nil(t, err)
+		assert.Equal(t, int64(diffInTurn), block.Difficulty)
+		assert.Nil(t, bc.ConnectBlock(block))
+	}
+}
+
+func TestProofOfAuthoritySnapshots(t *testing.T) {
+	bc, engine, keys := newTestAuthorityChain(t, 1)
+	for i := 0; i < snapshotCheckpoint+2; i++ {
+		block, err := sealTestBlock(bc, engine, keys[0])
+		assert.Nil(t, err)
+		assert.Nil(t, bc.ConnectBlock(block))
+	}
+	checkpoint := bc.blocks[snapshotCheckpoint-1]
+	assert.Equal(t, 1, len(engine.checkpoints))
+	assert.NotNil(t, engine.checkpoints[fmt.Sprintf("%x", checkpoint.Hash)])
+	assert.Equal(t, fmt.Sprintf("%x", bc.blocks[len(bc.blocks)-2].Hash), engine.lastHash)
+
+	// the snapshots kept give the same signers as a replay from the genesis
+	replayed := NewProofOfAuthorityEngine(engine.signers)
+	for _, parent := range []*Block{checkpoint, bc.blocks[snapshotCheckpoint], bc.CurrentBlock()} {
+		snap, height, err := engine.snapshot(bc, parent)
+		assert.Nil(t, err)
+		expected, expectedHeight, err := replayed.snapshot(bc, parent)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, snap)
+		assert.Equal(t, expectedHeight, height)
+	}
+
+	// a block out of the blockchain has no snapshot
+	_, _, err := engine.snapshot(bc, &Block{Hash: make([]byte, 32)})
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+}
+
+func TestProofOfAuthorityVotes(t *testing.T) {
+	bc, engine, keys := newTestAuthorityChain(t, 3)
+	newKey, newSigner := newKeyPair()
+	seal := func(key *ecdsa.PrivateKey) {
+		block, err := sealTestBlock(bc, engine, key)
+		assert.Nil(t, err)
+		assert.Nil(t, bc.ConnectBlock(block))
+	}
+	signers := func() [][]byte {
+		signers, err := engine.Signers(bc, bc.CurrentBlock())
+		assert.Nil(t, err)
+		return signers
+	}
+
+	// 2 of 3 signers add a signer
+	engine.Propose(newSigner, true)
+	seal(keys[1])
+	assert.Equal(t, 3, len(signers()))
+	_, err := sealTestBlock(bc, engine, &newKey)
+	assert.ErrorIs(t, err, ErrUnauthorizedSigner)
+	seal(keys[2])
+	assert.Equal(t, 4, len(signers()))
+	assert.Contains(t, signers(), newSigner)
+	seal(&newKey)
+
+	// 3 of 4 signers remove a signer, the proposal to add one is done
+	removed := pubKeyToByte(keys[2].PublicKey)
+	engine.Propose(removed, false)
+	seal(keys[0])
+	seal(keys[1])
+	assert.Equal(t, 4, len(signers()))
+	seal(&newKey)
+	assert.Equal(t, 3, len(signers()))
+	assert.NotContains(t, signers(), removed)
+	_, err = sealTestBlock(bc, engine, keys[2])
+	assert.ErrorIs(t, err, ErrUnauthorizedSigner)
+
+	// the votes are replayed by a new node
+	replayed := NewProofOfAuthorityEngine(engine.signers)
+	replayedSigners, err := replayed.Signers(bc, bc.CurrentBlock())
+	assert.Nil(t, err)
+	assert.Equal(t, signers(), replayedSigners)
+	for _, b := range bc.blocks {
+		assert.Nil(t, replayed.VerifySeal(bc, b))
+	}
+}
+
+func TestProofOfAuthorityForkChoice(t *testing.T) {
+	engine := NewProofOfAuthorityEngine(nil)
+	inTurn := []*Block{{Difficulty: diffInTurn}}
+	noTurn := []*Block{{Difficulty: diffNoTurn}}
+
+	assert.True(t, engine.ForkChoice(noTurn, inTurn))
+	assert.False(t, engine.ForkChoice(inTurn, noTurn))
+	assert.False(t, engine.ForkChoice(inTurn, inTurn))
+	assert.False(t, engine.ForkChoice(inTurn, append(noTurn, noTurn...)), "two blocks out of turn weigh as one in turn")
+}
+
+func TestProofOfAuthorityChainParams(t *testing.T) {
+	params, err := ParseChainParams("poa")
+	assert.Nil(t, err)
+	assert.Equal(t, &ProofOfAuthorityChainParams, params)
+	_, err = ParseChainParams("clique")
+	assert.ErrorIs(t, err, ErrUnknownChainParams)
+
+	// the engine of the preset is given its signers before the chain is
+	// created
+	engine := NewProofOfAuthorityEngine(nil)
+	useChainParams(t, &ChainParams{Name: "poa", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: engine})
+	key, pubKey := newKeyPair()
+	engine.Authorize(&key)
+	_, err = NewBlockchain(testAddressUser1)
+	assert.ErrorIs(t, err, ErrUnauthorizedSigner)
+	engine.SetSigners([][]byte{pubKey})
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	block, err := sealTestBlock(bc, engine, &key)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.ConnectBlock(block))
+}
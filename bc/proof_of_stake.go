@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// StakeMaturity is the number of blocks after which an output can stake
+	StakeMaturity = 10
+	// StakeMinAge is the age in seconds below which an output cannot stake
+	StakeMinAge = 60 * 60
+	// StakeMaxAge is the age in seconds above which the weight of an output
+	// stops growing
+	StakeMaxAge = 30 * 24 * 60 * 60
+	// StakeTargetBits define the staking difficulty: a kernel hash must be
+	// below the target of the bits times the weight of the stake
+	StakeTargetBits = 20
+	// StakeMaxFutureDrift is the number of seconds a block timestamp may be
+	// ahead of the local clock
+	StakeMaxFutureDrift = 15
+	// stakeSearchWindow is the number of timestamps, one per second, tried
+	// by Seal
+	stakeSearchWindow = 10 * 60
+)
+
+// coinstakeMarker is the data of the first output of a coinstake
+var coinstakeMarker = []byte("coinstake")
+
+var (
+	ErrNoCoinstake   = errors.New("block has no coinstake transaction")
+	ErrImmatureStake = errors.New("stake output is not mature")
+	ErrInvalidKernel = errors.New("stake kernel does not meet the target")
+	ErrNoStake       = errors.New("no output can stake the block")
+	ErrTimeTooNew    = errors.New("block timestamp is too far in the future")
+)
+
+// ProofOfStakeEngine is the consensus engine in which the right to produce
+// a block comes from the coins held instead of a proof-of-work. The kernel
+// hash of an unspent output and of the block timestamp must be below a
+// target growing with the value and the age of the output, so the larger
+// and the older the stake, the sooner a block.
+// The second transaction of a block, the coinstake, spends the stake output
+// back to its owner, resetting its age, and the block is signed with the
+// key of the stake. The coinbase pays the reward as for a proof-of-work.
+type ProofOfStakeEngine struct {
+	key *ecdsa.PrivateKey
+
+	maturity   int   // The number of blocks after which an output can stake
+	minAge     int64 // The age in seconds below which an output cannot stake
+	maxAge     int64 // The age in seconds above which the weight stops growing
+	targetBits int64
+	maxDrift   int64        // The seconds a block timestamp may be ahead of now
+	now        func() int64 // The local clock, in seconds
+}
+
+// stakeOutput is an output staking a block
+type stakeOutput struct {
+	txID   []byte
+	outIdx int
+	out    TXOutput
+	time   int64 // The timestamp of the block of the output
+}
+
+// NewProofOfStakeEngine creates a proof-of-stake engine with the default
+// staking rules. It verifies blocks only until a key is set with Authorize.
+func NewProofOfStakeEngine() *ProofOfStakeEngine {
+	return &ProofOfStakeEngine{
+		maturity:   StakeMaturity,
+		minAge:     StakeMinAge,
+		maxAge:     StakeMaxAge,
+		targetBits: StakeTargetBits,
+		maxDrift:   StakeMaxFutureDrift,
+		now:        func() int64 { return time.Now().Unix() },
+	}
+}
+
+// Authorize sets the key of the outputs staking the blocks
+func (e *ProofOfStakeEngine) Authorize(key *ecdsa.PrivateKey) {
+	e.key = key
+}
+
+// IsCoinstake checks whether the transaction spends a stake output back to
+// its owner
+func (tx Transaction) IsCoinstake() bool {
+	return !tx.IsCoinbase() && len(tx.Vin) > 0 && len(tx.Vout) > 1 &&
+		tx.Vout[0].IsDataCarrier() && bytes.Equal(tx.Vout[0].Data, coinstakeMarker)
+}
+
+// Prepare implements ConsensusEngine
+func (e *ProofOfStakeEngine) Prepare(chain *Blockchain, block *Block) error {
+	block.Difficulty = e.Difficulty(chain, chain.parentOf(block))
+	block.updateMerkleRoot()
+	return nil
+}
+
+// Seal implements ConsensusEngine. It looks for a kernel among the outputs
+// of the key not spent by the block, from the timestamp of the block on,
+// and sets the timestamp of the kernel found. The timestamps tried stay
+// within the drift allowed ahead of the local clock, so the block is not
+// rejected for it. The coinstake is inserted after the coinbase. The genesis
+// block has no stake.
+func (e *ProofOfStakeEngine) Seal(ctx context.Context, chain *Blockchain, block *Block) error {
+	if block.PrevBlockHash == nil {
+		header := block.Header()
+		block.Hash = header.Hash()
+		return nil
+	}
+	parentHeight := chain.heightOf(block.PrevBlockHash)
+	if parentHeight < 0 {
+		return ErrBlockNotFound
+	}
+	parent := chain.blocks[parentHeight]
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return ErrNoCoinbase
+	}
+	if e.key == nil {
+		return ErrNoStake
+	}
+	start := max(block.Timestamp, parent.Timestamp+1)
+	end := min(start+stakeSearchWindow, e.now()+e.maxDrift+1)
+	if start >= end {
+		return ErrTimeTooNew
+	}
+	stakes := e.stakes(chain, parentHeight, block)
+	for timestamp := start; timestamp < end; timestamp++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, stake := range stakes {
+			if e.checkKernel(parent, stake, timestamp) == nil {
+				block.Timestamp = timestamp
+				return e.sealWith(chain, block, stake)
+			}
+		}
+	}
+	return ErrNoStake
+}
+
+// stakes returns the outputs of the key not spent by the block, mature for a
+// block built on the block at parentHeight
+func (e *ProofOfStakeEngine) stakes(chain *Blockchain, parentHeight int, block *Block) []*stakeOutput {
+	pubKeyHash := HashPubKey(pubKeyToByte(e.key.PublicKey))
+	spent := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		for _, in := range tx.Vin {
+			spent[in.outpoint()] = true
+		}
+	}
+	var stakes []*stakeOutput
+	for txID, outs := range chain.FindUTXOSet() {
+		for outIdx, out := range outs {
+			if out.Type() != OutputPubKeyHash || !out.IsLockedWithKey(pubKeyHash) {
+				continue
+			}
+			in := TXInput{Txid: Hex2Bytes(txID), OutIdx: outIdx}
+			if spent[in.outpoint()] {
+				continue
+			}
+			if stake, err := e.stakeOf(chain, parentHeight, in); err == nil {
+				stakes = append(stakes, stake)
+			}
+		}
+	}
+	return stakes
+}
+
+// stakeOf returns the output spent by in, if it can stake a block built on
+// the block at parentHeight
+func (e *ProofOfStakeEngine) stakeOf(chain *Blockchain, parentHeight int, in TXInput) (*stakeOutput, error) {
+	tx, height, err := chain.findTransactionHeight(in.Txid)
+	if err != nil || !tx.hasSpendableOutput(in.OutIdx) {
+		return nil, fmt.Errorf("%w: stake output", ErrTxInputNotFound)
+	}
+	if height > parentHeight || parentHeight+1-height < e.maturity {
+		return nil, ErrImmatureStake
+	}
+	return &stakeOutput{txID: in.Txid, outIdx: in.OutIdx, out: tx.Vout[in.OutIdx], time: chain.blocks[height].Timestamp}, nil
+}
+
+// checkKernel checks that the kernel hash of the stake at timestamp is
+// below the target weighted by the value and the age of the stake
+func (e *ProofOfStakeEngine) checkKernel(parent *Block, stake *stakeOutput, timestamp int64) error {
+	age := timestamp - stake.time
+	if age < e.minAge {
+		return ErrImmatureStake
+	}
+	weight := big.NewInt(0).Mul(big.NewInt(int64(stake.out.Value)), big.NewInt(min(age, e.maxAge)))
+	target := weight.Mul(weight, powTarget(e.targetBits))
+	if toBigInt(kernelHash(parent, stake, timestamp)).Cmp(target) >= 0 {
+		return ErrInvalidKernel
+	}
+	return nil
+}
+
+// kernelHash hashes the stake output and the block timestamp. The parent
+// hash, the stake modifier, keeps the kernels from being computed in advance.
+func kernelHash(parent *Block, stake *stakeOutput, timestamp int64) []byte {
+	data := append(append([]byte{}, parent.Hash...), stake.txID...)
+	data = binary.BigEndian.AppendUint64(data, uint64(stake.outIdx))
+	data = binary.BigEndian.AppendUint64(data, uint64(stake.time))
+	data = binary.BigEndian.AppendUint64(data, uint64(timestamp))
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// sealWith adds the coinstake spending the stake to the block, and signs
+// the block
+func (e *ProofOfStakeEngine) sealWith(chain *Blockchain, block *Block, stake *stakeOutput) error {
+	marker, err := NewDataOutput(coinstakeMarker)
+	if err != nil {
+		return err
+	}
+	coinstake := &Transaction{
+		Vin:  []TXInput{{Txid: stake.txID, OutIdx: stake.outIdx}},
+		Vout: []TXOutput{*marker, stake.out},
+	}
+	coinstake.ID = coinstake.Hash()
+	if err := chain.SignTransaction(coinstake, *e.key); err != nil {
+		return err
+	}
+	block.Transactions = append([]*Transaction{block.Transactions[0], coinstake}, block.Transactions[1:]...)
+	block.updateMerkleRoot()
+	if err := block.AddWitnessCommitment(); err != nil {
+		return err
+	}
+	header := block.Header()
+	block.Hash = header.Hash()
+	r, s := signRFC6979(e.key, block.Hash)
+	block.Seal = encodeSignatureDER(r, normalizeS(e.key.Curve, s))
+	return nil
+}
+
+// VerifySeal implements ConsensusEngine. The coinstake itself is verified
+// with the other transactions of the block.
+func (e *ProofOfStakeEngine) VerifySeal(chain *Blockchain, block *Block) error {
+	header := block.Header()
+	if !bytes.Equal(block.Hash, header.Hash()) {
+		return ErrInvalidSeal
+	}
+	if block.PrevBlockHash == nil {
+		return nil
+	}
+	parentHeight := chain.heightOf(block.PrevBlockHash)
+	if parentHeight < 0 {
+		return ErrBlockNotFound
+	}
+	parent := chain.blocks[parentHeight]
+	if expected := e.Difficulty(chain, parent); block.Difficulty != expected {
+		return fmt.Errorf("%w: %d, expected %d", ErrBadDifficulty, block.Difficulty, expected)
+	}
+	if block.Timestamp <= parent.Timestamp {
+		return fmt.Errorf("%w: timestamp not after the parent", ErrInvalidSeal)
+	}
+	if block.Timestamp > e.now()+e.maxDrift {
+		return ErrTimeTooNew
+	}
+	if len(block.Transactions) < 2 || !block.Transactions[1].IsCoinstake() {
+		return ErrNoCoinstake
+	}
+	for _, tx := range block.Transactions[2:] {
+		if tx.IsCoinstake() {
+			return fmt.Errorf("%w: more than one coinstake", ErrInvalidSeal)
+		}
+	}
+	in := block.Transactions[1].Vin[0]
+	stake, err := e.stakeOf(chain, parentHeight, in)
+	if err != nil {
+		return err
+	}
+	if err := e.checkKernel(parent, stake, block.Timestamp); err != nil {
+		return err
+	}
+	// the block is signed by the owner of the stake, the coinstake proving
+	// the ownership
+	curve := ActiveChainParams.KeyType.Curve()
+	pubKey, err := parsePubKey(curve, in.PubKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	r, s, err := parseSignatureDER(curve, block.Seal)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	if !ecdsa.Verify(pubKey, block.Hash, r, s) {
+		return ErrInvalidSeal
+	}
+	return nil
+}
+
+// Difficulty implements ConsensusEngine. The difficulty is not retargeted,
+// every block is staked with the target bits of the engine.
+func (e *ProofOfStakeEngine) Difficulty(chain *Blockchain, parent *Block) int64 {
+	return e.targetBits
+}
+
+// ForkChoice implements ConsensusEngine: the branch with the most blocks,
+// weighted by their difficulty, is preferred, the current one on a tie
+func (e *ProofOfStakeEngine) ForkChoice(current, candidate []*Block) bool {
+	return chainWork(candidate).Cmp(chainWork(current)) > 0
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStakeChain creates a blockchain staked by user 1, who owns the
+// genesis coin. The local clock is two hours after the tip.
+func newTestStakeChain(t *testing.T) (*Blockchain, *ProofOfStakeEngine) {
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	engine := NewProofOfStakeEngine()
+	engine.maturity = 1
+	engine.minAge = 60
+	engine.Authorize(privKey1)
+	useChainParams(t, &ChainParams{Name: "pos", KeyType: KeyTypeP256, CoinbaseMaturity: 1, Consensus: engine})
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	engine.now = func() int64 { return bc.CurrentBlock().Timestamp + 2*3600 }
+	return bc, engine
+}
+
+// newTestStakeBlock prepares a block an hour after the tip
+func newTestStakeBlock(bc *Blockchain, txs ...*Transaction) *Block {
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, fmt.Sprintf("Reward at height %d", bc.Height()+1))
+	block := NewBlock(bc.CurrentBlock().Timestamp+3600, append([]*Transaction{cbTx}, txs...), bc.CurrentBlock().Hash)
+	bc.Engine().Prepare(bc, block)
+	return block
+}
+
+func TestProofOfStakeSeal(t *testing.T) {
+	bc, engine := newTestStakeChain(t)
+	genesis := bc.GetGenesisBlock()
+	assert.Nil(t, engine.VerifySeal(bc, genesis))
+
+	block := newTestStakeBlock(bc)
+	start := block.Timestamp
+	assert.Nil(t, engine.Seal(context.Background(), bc, block))
+	assert.GreaterOrEqual(t, block.Timestamp, start)
+	assert.Equal(t, 2, len(block.Transactions))
+	coinstake := block.Transactions[1]
+	assert.True(t, coinstake.IsCoinstake())
+	assert.Equal(t, genesis.Transactions[0].ID, coinstake.Vin[0].Txid)
+	assert.Equal(t, genesis.Transactions[0].Vout[0], coinstake.Vout[1], "the stake goes back to its owner")
+	assert.True(t, block.ValidWitnessCommitment())
+	assert.Nil(t, bc.ConnectBlock(block))
+	assert.Equal(t, 2, len(bc.FindUTXOSet().FindUTXO(GetPubKeyHashFromAddress(testAddressUser1))), "the stake and the reward")
+
+	// both the coinstake and the reward stake the next block
+	next := newTestStakeBlock(bc)
+	assert.Nil(t, engine.Seal(context.Background(), bc, next))
+	assert.Nil(t, bc.ConnectBlock(next))
+
+	forged := *block
+	forged.Seal = next.Seal
+	assert.ErrorIs(t, engine.VerifySeal(bc, &forged), ErrInvalidSeal)
+	forged = *block
+	forged.Timestamp = genesis.Timestamp
+	header := forged.Header()
+	forged.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, &forged), ErrInvalidSeal, "the timestamp must be after the parent")
+	// a block ahead of the local clock is not accepted yet
+	forged = *block
+	forged.Timestamp = engine.now() + engine.maxDrift + 1
+	header = forged.Header()
+	forged.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, &forged), ErrTimeTooNew)
+	forged = *block
+	forged.Difficulty++
+	header = forged.Header()
+	forged.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, &forged), ErrBadDifficulty)
+
+	// a block without stake is not sealed
+	unstaked := newTestStakeBlock(bc)
+	header = unstaked.Header()
+	unstaked.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, unstaked), ErrNoCoinstake)
+
+	// a block building on a block out of the chain has no stake to check
+	orphan := newTestStakeBlock(bc)
+	orphan.PrevBlockHash = make([]byte, 32)
+	assert.ErrorIs(t, engine.Seal(context.Background(), bc, orphan), ErrBlockNotFound)
+	header = orphan.Header()
+	orphan.Hash = header.Hash()
+	assert.ErrorIs(t, engine.VerifySeal(bc, orphan), ErrBlockNotFound)
+}
+
+func TestProofOfStakeChainParams(t *testing.T) {
+	params, err := ParseChainParams("pos")
+	assert.Nil(t, err)
+	assert.Equal(t, &ProofOfStakeChainParams, params)
+	assert.IsType(t, &ProofOfStakeEngine{}, params.Consensus)
+}
+
+func TestProofOfStakeKernel(t *testing.T) {
+	bc, engine := newTestStakeChain(t)
+	genesis := bc.GetGenesisBlock()
+	coinbase := genesis.Transactions[0]
+	stake, err := engine.stakeOf(bc, 0, TXInput{Txid: coinbase.ID, OutIdx: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, genesis.Timestamp, stake.time)
+
+	assert.ErrorIs(t, engine.checkKernel(genesis, stake, genesis.Timestamp+engine.minAge-1), ErrImmatureStake)
+	// most timestamps give no kernel
+	invalid := 0
+	for timestamp := genesis.Timestamp + engine.minAge; timestamp < genesis.Timestamp+engine.minAge+100; timestamp++ {
+		if err := engine.checkKernel(genesis, stake, timestamp); err != nil {
+			assert.ErrorIs(t, err, ErrInvalidKernel)
+			invalid++
+		}
+	}
+	assert.Greater(t, invalid, 50)
+
+	// the kernel is found sooner with a higher weight
+	stake.out.Value *= 1 << 20
+	assert.Nil(t, engine.checkKernel(genesis, stake, genesis.Timestamp+engine.minAge))
+
+	engine.maturity = 2
+	_, err = engine.stakeOf(bc, 0, TXInput{Txid: coinbase.ID, OutIdx: 0})
+	assert.ErrorIs(t, err, ErrImmatureStake)
+	_, err = engine.stakeOf(bc, 0, TXInput{Txid: coinbase.ID, OutIdx: 1})
+	assert.ErrorIs(t, err, ErrTxInputNotFound)
+}
+
+func TestProofOfStakeNoStake(t *testing.T) {
+	bc, engine := newTestStakeChain(t)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+
+	// the only coin of the staker is spent by the block
+	tx, err := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(tx, *privKey1))
+	assert.ErrorIs(t, engine.Seal(context.Background(), bc, newTestStakeBlock(bc, tx)), ErrNoStake)
+
+	// the coin is not mature
+	engine.maturity = 2
+	assert.ErrorIs(t, engine.Seal(context.Background(), bc, newTestStakeBlock(bc)), ErrNoStake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	engine.maturity = 1
+	assert.ErrorIs(t, engine.Seal(ctx, bc, newTestStakeBlock(bc)), context.Canceled)
+
+	// the kernel search does not go past the drift allowed ahead of the clock
+	block := newTestStakeBlock(bc)
+	engine.now = func() int64 { return block.Timestamp - engine.maxDrift - 1 }
+	assert.ErrorIs(t, engine.Seal(context.Background(), bc, block), ErrTimeTooNew)
+	engine.now = func() int64 { return block.Timestamp }
+	if err := engine.Seal(context.Background(), bc, block); err == nil {
+		assert.LessOrEqual(t, block.Timestamp, engine.now()+engine.maxDrift)
+	} else {
+		assert.ErrorIs(t, err, ErrNoStake)
+	}
+
+	assert.ErrorIs(t, NewProofOfStakeEngine().Seal(context.Background(), bc, newTestStakeBlock(bc)), ErrNoStake)
+}
@@ -2,14 +2,15 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
+	"fmt"
 	"math"
 	"math/big"
 )
 
 var maxNonce = math.MaxInt64
 
-// TARGETBITS define the mining difficulty
+// TARGETBITS define the mining difficulty with SHA-256d
 const TARGETBITS = 8
 
 // ProofOfWork represents a block mined with a target difficulty
@@ -18,22 +19,26 @@ type ProofOfWork struct {
 	target *big.Int
 }
 
-// NewProofOfWork builds a ProofOfWork
+// NewProofOfWork builds a ProofOfWork for the difficulty of the block, the
+// one of the proof-of-work algorithm when not set
 func NewProofOfWork(block *Block) *ProofOfWork {
-	target := big.NewInt(0).Exp(big.NewInt(2), big.NewInt(248), nil)
-	return &ProofOfWork{block: block, target: target}
+	bits := block.Difficulty
+	if bits == 0 {
+		bits = ActiveChainParams.PowAlgorithm.TargetBits()
+	}
+	return &ProofOfWork{block: block, target: powTarget(bits)}
+}
+
+// powTarget returns the value the block hashes must be below for the
+// given target bits
+func powTarget(bits int64) *big.Int {
+	return big.NewInt(0).Lsh(big.NewInt(1), uint(256-bits))
 }
 
-// setupHeader prepare the header of the block
+// setupHeader prepare the header of the block, without the nonce
 func (pow *ProofOfWork) setupHeader() []byte {
-	var header []byte
-	timeStamp := IntToHex(pow.block.Timestamp)
-	tb := IntToHex(TARGETBITS)
-	header = append(header, pow.block.PrevBlockHash...)
-	header = append(header, pow.block.HashTransactions()...)
-	header = append(header, timeStamp...)
-	header = append(header, tb...)
-	return header
+	header := pow.block.Header()
+	return header.Serialize()[:BlockHeaderSize-8]
 }
 
 // addNonce adds a nonce to the header
@@ -43,36 +48,30 @@ func addNonce(nonce int, header []byte) []byte {
 	return header
 }
 
-// Run performs the proof-of-work
-func (pow *ProofOfWork) Run() (int, []byte) {
-	header := pow.setupHeader()
-	nonce := 0
-	for nonce <= maxNonce {
-		headerNonced := addNonce(nonce, header)
-		hashHeader := sha256.Sum256(headerNonced)
+// Run performs the proof-of-work. It fails when no nonce up to maxNonce
+// gives a hash below the target.
+func (pow *ProofOfWork) Run() (int, []byte, error) {
+	hasher := newHeaderHasher(pow.setupHeader())
+	for nonce := 0; ; nonce++ {
+		hashHeader := hasher.hash(nonce)
 		bigIntHash := toBigInt(hashHeader[:])
 		compare := bigIntHash.Cmp(pow.target)
 		if compare == -1 {
-			return nonce, hashHeader[:]
+			return nonce, hashHeader[:], nil
+		}
+		if nonce == maxNonce {
+			return 0, nil, errNonceSpaceExhausted
 		}
-		nonce += 1
 	}
-	return 0, nil
 }
 
 // Validate validates block's Proof-Of-Work
-// This function just validates if the block header hash
-// is less than the target AND equals to the mined block hash.
+// The header is hashed once with the block nonce, by the algorithm of the
+// chain parameters: the hash must be less than the target AND equal to the
+// block hash.
 func (pow *ProofOfWork) Validate() bool {
-	oldNonce := pow.block.Nonce
-	unMinedBh := pow.block.Hash
-	bigIntHash := toBigInt(unMinedBh)
-	hashEqual := bigIntHash.Cmp(pow.target)
-	pow.block.Mine()
-	newNonce := pow.block.Nonce
-	afterMine := pow.block.Hash
-	minedEqual := bytes.Equal(pow.block.Hash, afterMine)
-	return hashEqual == -1 && minedEqual && oldNonce == newNonce
+	hashHeader := newHeaderHasher(pow.setupHeader()).hash(pow.block.Nonce)
+	return toBigInt(hashHeader[:]).Cmp(pow.target) == -1 && bytes.Equal(hashHeader[:], pow.block.Hash)
 }
 
 func toBigInt(hashHeader []byte) *big.Int {
@@ -83,3 +82,70 @@ func toBigInt(hashHeader []byte) *big.Int {
 	}
 	return hIntoBigInt
 }
+
+// ProofOfWorkEngine is the consensus engine sealing blocks with a
+// proof-of-work, the chain with the most work being preferred
+type ProofOfWorkEngine struct {
+	miner *Miner
+}
+
+// NewProofOfWorkEngine creates a proof-of-work engine mining with the given
+// number of workers, one per CPU when workers is not positive
+func NewProofOfWorkEngine(workers int) *ProofOfWorkEngine {
+	return &ProofOfWorkEngine{miner: NewMiner(workers)}
+}
+
+// Miner returns the miner sealing the blocks, e.g. to read its hashrate
+func (e *ProofOfWorkEngine) Miner() *Miner {
+	return e.miner
+}
+
+// Prepare implements ConsensusEngine
+func (e *ProofOfWorkEngine) Prepare(chain *Blockchain, block *Block) error {
+	block.Difficulty = e.Difficulty(chain, chain.parentOf(block))
+	block.updateMerkleRoot()
+	return nil
+}
+
+// Seal implements ConsensusEngine. The blocks having a coinbase are mined
+// by the workers of the miner, the others by a sequential search as they
+// have no extra nonce to roll: it fails when their nonces are exhausted.
+func (e *ProofOfWorkEngine) Seal(ctx context.Context, chain *Blockchain, block *Block) error {
+	if len(block.Transactions) > 0 && block.Transactions[0].IsCoinbase() {
+		return e.miner.Mine(ctx, block)
+	}
+	return block.Mine()
+}
+
+// VerifySeal implements ConsensusEngine
+func (e *ProofOfWorkEngine) VerifySeal(chain *Blockchain, block *Block) error {
+	if expected := e.Difficulty(chain, chain.parentOf(block)); block.Difficulty != expected {
+		return fmt.Errorf("%w: %d, expected %d", ErrBadDifficulty, block.Difficulty, expected)
+	}
+	if !NewProofOfWork(block).Validate() {
+		return ErrInvalidSeal
+	}
+	return nil
+}
+
+// Difficulty implements ConsensusEngine. The difficulty is not retargeted,
+// every block is mined with the target bits of the proof-of-work algorithm.
+func (e *ProofOfWorkEngine) Difficulty(chain *Blockchain, parent *Block) int64 {
+	return ActiveChainParams.PowAlgorithm.TargetBits()
+}
+
+// ForkChoice implements ConsensusEngine: the branch with the most work is
+// preferred, the current one on a tie
+func (e *ProofOfWorkEngine) ForkChoice(current, candidate []*Block) bool {
+	return chainWork(candidate).Cmp(chainWork(current)) > 0
+}
+
+// chainWork returns the expected number of hashes needed to mine the
+// blocks, 2^bits per block
+func chainWork(blocks []*Block) *big.Int {
+	work := big.NewInt(0)
+	for _, b := range blocks {
+		work.Add(work, big.NewInt(0).Lsh(big.NewInt(1), uint(b.Difficulty)))
+	}
+	return work
+}
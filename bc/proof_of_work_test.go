@@ -43,12 +43,15 @@ func TestSetupHeader(t *testing.T) {
 		block: &Block{
 			Timestamp:    TestBlockTime,
 			Transactions: []*Transaction{testTransactions["tx0"]},
+			MerkleRoot:   Hex2Bytes("fdfa9ad1db072757d55c11ba05aecae0bbd99e29b8dc2a869a68ebeb1ca09147"),
+			Difficulty:   TARGETBITS,
 		},
 		target: testTargetDifficulty,
 	}
 	header := pow.setupHeader()
 
-	expectedHeader := newMockHeader(nil, Hex2Bytes("fdfa9ad1db072757d55c11ba05aecae0bbd99e29b8dc2a869a68ebeb1ca09147"))
+	// the header has a fixed size, a missing previous hash is zero
+	expectedHeader := newMockHeader(make([]byte, 32), Hex2Bytes("fdfa9ad1db072757d55c11ba05aecae0bbd99e29b8dc2a869a68ebeb1ca09147"))
 	assert.Equalf(t, expectedHeader, header, "The current block header: %x isn't equal to the expected %x\n", header, expectedHeader)
 }
 
@@ -66,15 +69,36 @@ func TestRun(t *testing.T) {
 				Timestamp:     TestBlockTime,
 				Transactions:  block.Transactions,
 				PrevBlockHash: block.PrevBlockHash,
+				MerkleRoot:    block.MerkleRoot,
+				Difficulty:    block.Difficulty,
 			}
 			pow := &ProofOfWork{b, testTargetDifficulty}
-			nonce, hash := pow.Run()
+			nonce, hash, err := pow.Run()
+			assert.Nil(t, err)
 			diff(t, testBlockchainData[k].Nonce, nonce, fmt.Sprintf("wrong nonce for %s", k))
 			diff(t, testBlockchainData[k].Hash, hash, fmt.Sprintf("wrong hash for %s", k))
 		})
 	}
 }
 
+func TestRunNonceSpaceExhausted(t *testing.T) {
+	defer func(n int) { maxNonce = n }(maxNonce)
+	maxNonce = 0
+	block := testBlockchainData["block1"]
+	b := &Block{
+		Timestamp:     TestBlockTime,
+		Transactions:  block.Transactions,
+		PrevBlockHash: block.PrevBlockHash,
+		MerkleRoot:    block.MerkleRoot,
+	}
+	// no hash is below the target of the highest difficulty
+	b.Difficulty = 255
+	_, _, err := NewProofOfWork(b).Run()
+	assert.ErrorIs(t, err, errNonceSpaceExhausted)
+	assert.ErrorIs(t, b.Mine(), errNonceSpaceExhausted)
+	assert.Nil(t, b.Hash)
+}
+
 func TestValidatePoW(t *testing.T) {
 	for k, block := range testBlockchainData {
 		t.Run(k, func(t *testing.T) {
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// psbtMagic starts every serialized partially signed transaction
+var psbtMagic = []byte("psbt\xff")
+
+var (
+	ErrInvalidPSBT        = errors.New("invalid partially signed transaction")
+	ErrPSBTMismatch       = errors.New("partially signed transactions are not for the same transaction")
+	ErrPSBTNotSigner      = errors.New("key cannot sign any input of the transaction")
+	ErrPSBTIncomplete     = errors.New("transaction inputs are not all signed")
+	ErrPSBTNotFinalized   = errors.New("partially signed transaction is not finalized")
+	ErrPSBTInvalidWitness = errors.New("finalized transaction does not verify")
+)
+
+// PSBT is a partially signed transaction. It holds everything needed to sign
+// the transaction without access to the blockchain, so it can be built on an
+// online machine, signed offline and signed by several co-signers.
+type PSBT struct {
+	Tx       Transaction       // The unsigned transaction
+	Inputs   []PSBTInput       // The signing data of each input of Tx
+	Metadata map[string]string // Free-form information, e.g. a description of the payment
+}
+
+// PSBTInput holds the signing data of one transaction input
+type PSBTInput struct {
+	PrevOut     TXOutput          // The output spent by the input
+	Preimage    []byte            // The preimage claiming a hash time-locked output
+	PartialSigs map[string][]byte // Signatures by hex encoded public key
+	FinalPubKey []byte            // The public key of the finalized input
+	FinalSig    []byte            // The signature of the finalized input
+}
+
+// NewPSBT creates a partially signed transaction from an unsigned
+// transaction and the transactions its inputs spend from
+func NewPSBT(tx *Transaction, prevTXs map[string]*Transaction) (*PSBT, error) {
+	if tx.IsCoinbase() || !validInputs(tx.Vin, prevTXs) {
+		return nil, ErrTxInputNotFound
+	}
+	p := &PSBT{Tx: tx.TrimmedCopy(), Metadata: make(map[string]string)}
+	for _, in := range tx.Vin {
+		prevTX := prevTXs[fmt.Sprintf("%x", in.Txid)]
+		if in.OutIdx < 0 || in.OutIdx >= len(prevTX.Vout) {
+			return nil, ErrTxInputNotFound
+		}
+		p.Inputs = append(p.Inputs, PSBTInput{
+			PrevOut:     prevTX.Vout[in.OutIdx],
+			Preimage:    in.Preimage,
+			PartialSigs: make(map[string][]byte),
+		})
+	}
+	return p, nil
+}
+
+// prevTXs rebuilds the previous transactions of the inputs. Only the spent
+// outputs are known, which is all signing and verifying need.
+func (p *PSBT) prevTXs() map[string]*Transaction {
+	prevTXs := make(map[string]*Transaction)
+	for i, in := range p.Tx.Vin {
+		txID := fmt.Sprintf("%x", in.Txid)
+		prevTX, ok := prevTXs[txID]
+		if !ok {
+			prevTX = &Transaction{ID: in.Txid}
+			prevTXs[txID] = prevTX
+		}
+		for len(prevTX.Vout) <= in.OutIdx {
+			prevTX.Vout = append(prevTX.Vout, TXOutput{})
+		}
+		prevTX.Vout[in.OutIdx] = p.Inputs[i].PrevOut
+	}
+	return prevTXs
+}
+
+// canSign checks whether the owner of pubKey can spend the input
+func (in *PSBTInput) canSign(pubKey []byte) bool {
+	out := in.PrevOut
+	switch {
+	case out.IsDataCarrier():
+		return false
+	case out.IsSchnorr():
+		return len(pubKey) == SchnorrPubKeyLen && bytes.Equal(out.SchnorrKey, pubKey)
+	case out.IsHTLC():
+		if in.Preimage != nil {
+			return bytes.Equal(out.HTLC.ReceiverPubKeyHash, HashPubKey(pubKey))
+		}
+		return bytes.Equal(out.HTLC.SenderPubKeyHash, HashPubKey(pubKey))
+	default:
+		return out.IsLockedWithKey(HashPubKey(pubKey))
+	}
+}
+
+// verifySig checks whether sig is a signature of sigHash by the owner of pubKey
+func (in *PSBTInput) verifySig(pubKey, sig, sigHash []byte) bool {
+	if in.PrevOut.IsSchnorr() {
+		return SchnorrVerify(in.PrevOut.SchnorrKey, sigHash, sig)
+	}
+	curve := ActiveChainParams.KeyType.Curve()
+	r, s, err := parseSignatureDER(curve, sig)
+	if err != nil {
+		return false
+	}
+	key, err := parsePubKey(curve, pubKey)
+	if err != nil {
+		return false
+	}
+	return ecdsa.Verify(key, sigHash, r, s)
+}
+
+// Sign adds the signatures of privKey to the inputs it can spend, and
+// returns the number of signed inputs.
+// Inputs locked with a Schnorr key are signed with BIP340 signatures, the
+// others with ECDSA.
+func (p *PSBT) Sign(privKey *ecdsa.PrivateKey) (int, error) {
+	sigHash, err := p.Tx.SigHash(p.prevTXs())
+	if err != nil {
+		return 0, err
+	}
+	ecdsaKey := pubKeyToByte(privKey.PublicKey)
+	var schnorrKey []byte
+	if privKey.Curve == S256() {
+		schnorrKey = SchnorrPubKey(privKey)
+	}
+
+	signed := 0
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		var pubKey, sig []byte
+		switch {
+		case schnorrKey != nil && in.canSign(schnorrKey):
+			pubKey = schnorrKey
+			if sig, err = SchnorrSign(privKey, sigHash, nil); err != nil {
+				return signed, err
+			}
+		case in.canSign(ecdsaKey):
+			if privKey.Curve != ActiveChainParams.KeyType.Curve() {
+				return signed, ErrKeyTypeMismatch
+			}
+			pubKey = ecdsaKey
+			r, s := signRFC6979(privKey, sigHash)
+			sig = encodeSignatureDER(r, normalizeS(privKey.Curve, s))
+		default:
+			continue
+		}
+		in.PartialSigs[hex.EncodeToString(pubKey)] = sig
+		signed++
+	}
+	if signed == 0 {
+		return 0, ErrPSBTNotSigner
+	}
+	return signed, nil
+}
+
+// CombinePSBT merges the signatures of partially signed copies of the same
+// transaction, e.g. signed by different co-signers
+func CombinePSBT(psbts ...*PSBT) (*PSBT, error) {
+	if len(psbts) == 0 {
+		return nil, ErrInvalidPSBT
+	}
+	combined := &PSBT{Tx: psbts[0].Tx, Metadata: make(map[string]string)}
+	for _, in := range psbts[0].Inputs {
+		in.PartialSigs = make(map[string][]byte)
+		combined.Inputs = append(combined.Inputs, in)
+	}
+	for _, p := range psbts {
+		if !bytes.Equal(p.Tx.Hash(), combined.Tx.Hash()) || len(p.Inputs) != len(combined.Inputs) {
+			return nil, ErrPSBTMismatch
+		}
+		for k, v := range p.Metadata {
+			combined.Metadata[k] = v
+		}
+		for i, in := range p.Inputs {
+			for pubKey, sig := range in.PartialSigs {
+				combined.Inputs[i].PartialSigs[pubKey] = sig
+			}
+			if in.FinalSig != nil {
+				combined.Inputs[i].FinalPubKey = in.FinalPubKey
+				combined.Inputs[i].FinalSig = in.FinalSig
+			}
+		}
+	}
+	return combined, nil
+}
+
+// Finalize picks the signature completing each input, the first partial
+// signature by public key that verifies against the transaction.
+// Inputs locked with a Schnorr key only need the signature, the output key
+// verifies it.
+func (p *PSBT) Finalize() error {
+	sigHash, err := p.Tx.SigHash(p.prevTXs())
+	if err != nil {
+		return err
+	}
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalSig != nil {
+			continue
+		}
+		encodedKeys := make([]string, 0, len(in.PartialSigs))
+		for encodedKey := range in.PartialSigs {
+			encodedKeys = append(encodedKeys, encodedKey)
+		}
+		sort.Strings(encodedKeys)
+		for _, encodedKey := range encodedKeys {
+			sig := in.PartialSigs[encodedKey]
+			pubKey, err := hex.DecodeString(encodedKey)
+			if err != nil || !in.canSign(pubKey) || !in.verifySig(pubKey, sig, sigHash) {
+				continue
+			}
+			in.FinalSig = sig
+			if !in.PrevOut.IsSchnorr() {
+				in.FinalPubKey = pubKey
+			}
+			break
+		}
+		if in.FinalSig == nil {
+			return ErrPSBTIncomplete
+		}
+	}
+	return nil
+}
+
+// IsFinalized checks whether every input has its final signature
+func (p *PSBT) IsFinalized() bool {
+	for _, in := range p.Inputs {
+		if in.FinalSig == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the signed transaction of a finalized PSBT
+func (p *PSBT) Extract() (*Transaction, error) {
+	if !p.IsFinalized() {
+		return nil, ErrPSBTNotFinalized
+	}
+	tx := p.Tx
+	tx.Vin = nil
+	for i, in := range p.Tx.Vin {
+		tx.Vin = append(tx.Vin, TXInput{
+			Txid:      in.Txid,
+			OutIdx:    in.OutIdx,
+			Signature: p.Inputs[i].FinalSig,
+			PubKey:    p.Inputs[i].FinalPubKey,
+			Preimage:  p.Inputs[i].Preimage,
+		})
+	}
+	if err := tx.Verify(p.prevTXs()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPSBTInvalidWitness, err)
+	}
+	return &tx, nil
+}
+
+// Serialize returns the binary encoding of the PSBT
+func (p *PSBT) Serialize() []byte {
+	var buff bytes.Buffer
+	buff.Write(psbtMagic)
+	enc := gob.NewEncoder(&buff)
+	if err := enc.Encode(p); err != nil {
+		panic("Could not encode the partially signed transaction!")
+	}
+	return buff.Bytes()
+}
+
+// DeserializePSBT decodes a PSBT encoded by Serialize
+func DeserializePSBT(data []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(data, psbtMagic) {
+		return nil, ErrInvalidPSBT
+	}
+	var p PSBT
+	dec := gob.NewDecoder(bytes.NewReader(data[len(psbtMagic):]))
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+	}
+	if len(p.Inputs) != len(p.Tx.Vin) {
+		return nil, ErrInvalidPSBT
+	}
+	for i := range p.Inputs {
+		if p.Inputs[i].PartialSigs == nil {
+			p.Inputs[i].PartialSigs = make(map[string][]byte)
+		}
+	}
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]string)
+	}
+	return &p, nil
+}
+
+// WriteFile saves the PSBT to a file
+func (p *PSBT) WriteFile(path string) error {
+	return writeFileAtomic(path, p.Serialize())
+}
+
+// ReadPSBTFile loads a PSBT saved by WriteFile
+func ReadPSBTFile(path string) (*PSBT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DeserializePSBT(data)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCoSigned creates a blockchain where user1 and user2 both own coins,
+// and an unsigned transaction spending one coin of each
+func newTestCoSigned(t *testing.T) (*Blockchain, *Transaction) {
+	bc, err := NewBlockchain(testAddressUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	payTx, err := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, bc.SignTransaction(payTx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "co-signed")
+	_, err = bc.MineBlock([]*Transaction{cbTx, payTx})
+	assert.Nil(t, err)
+
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	_, pubKey2 := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	assert.Nil(t, builder.AddForeignInput(payTx.ID, 0, pubKeyToByte(*pubKey2))) // 4 coins of user2
+	assert.Nil(t, builder.AddInput(payTx.ID, 1))                                // 6 coins of user1
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 9))
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	return bc, tx
+}
+
+func TestPSBTCoSigning(t *testing.T) {
+	bc, tx := newTestCoSigned(t)
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	privKey2, _ := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+
+	// created online
+	prevTXs, err := bc.GetInputTXsOf(tx)
+	assert.Nil(t, err)
+	psbt, err := NewPSBT(tx, prevTXs)
+	assert.Nil(t, err)
+	psbt.Metadata["note"] = "co-signed payment"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tx.psbt")
+	assert.Nil(t, psbt.WriteFile(path))
+	assert.Nil(t, psbt.WriteFile(path), "an existing file is replaced")
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1, "no temporary file is left behind")
+
+	// each co-signer signs its own copy offline
+	copy1, err := ReadPSBTFile(path)
+	assert.Nil(t, err)
+	signed, err := copy1.Sign(privKey1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, signed)
+	assert.ErrorIs(t, copy1.Finalize(), ErrPSBTIncomplete)
+
+	copy2, err := ReadPSBTFile(path)
+	assert.Nil(t, err)
+	signed, err = copy2.Sign(privKey2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, signed)
+
+	// the copies are combined and finalized
+	combined, err := CombinePSBT(copy1, copy2)
+	assert.Nil(t, err)
+	assert.Equal(t, "co-signed payment", combined.Metadata["note"])
+	_, err = combined.Extract()
+	assert.ErrorIs(t, err, ErrPSBTNotFinalized)
+	assert.Nil(t, combined.Finalize())
+
+	signedTx, err := combined.Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, tx.ID, signedTx.ID)
+	assert.Nil(t, signedTx.Verify(prevTXs))
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "extracted")
+	_, err = bc.MineBlock([]*Transaction{cbTx, signedTx})
+	assert.Nil(t, err)
+	_, err = bc.FindTransaction(tx.ID)
+	assert.Nil(t, err)
+}
+
+func TestPSBTSchnorrInput(t *testing.T) {
+	privKey := newS256PrivateKey(hexInt("b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef"))
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddSchnorrOutput(SchnorrPubKey(privKey), 9))
+	fundTx, _ := builder.Build()
+	assert.Nil(t, bc.SignTransaction(fundTx, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "fund")
+	_, err = bc.MineBlock([]*Transaction{cbTx, fundTx})
+	assert.Nil(t, err)
+
+	builder = NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddForeignInput(fundTx.ID, 0, SchnorrPubKey(privKey)))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 8))
+	tx, _ := builder.Build()
+	prevTXs, _ := bc.GetInputTXsOf(tx)
+	psbt, err := NewPSBT(tx, prevTXs)
+	assert.Nil(t, err)
+
+	_, err = psbt.Sign(privKey1)
+	assert.ErrorIs(t, err, ErrPSBTNotSigner)
+	signed, err := psbt.Sign(privKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, signed)
+	assert.Nil(t, psbt.Finalize())
+	signedTx, err := psbt.Extract()
+	assert.Nil(t, err)
+	assert.Nil(t, signedTx.Vin[0].PubKey)
+	assert.Nil(t, signedTx.Verify(prevTXs))
+}
+
+func TestPSBTErrors(t *testing.T) {
+	bc, tx := newTestCoSigned(t)
+	prevTXs, _ := bc.GetInputTXsOf(tx)
+	psbt, _ := NewPSBT(tx, prevTXs)
+
+	_, err := NewPSBT(tx, map[string]*Transaction{})
+	assert.ErrorIs(t, err, ErrTxInputNotFound)
+
+	// copies of different transactions cannot be combined
+	other := *tx
+	other.Vout = []TXOutput{{Value: 10, PubKeyHash: GetPubKeyHashFromAddress(testAddressUser1)}}
+	otherPSBT, _ := NewPSBT(&other, prevTXs)
+	_, err = CombinePSBT(psbt, otherPSBT)
+	assert.ErrorIs(t, err, ErrPSBTMismatch)
+	_, err = CombinePSBT()
+	assert.ErrorIs(t, err, ErrInvalidPSBT)
+
+	// a forged partial signature is not picked to finalize its input
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	privKey2, _ := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	psbt.Sign(privKey1)
+	psbt.Sign(privKey2)
+	forgedSig := psbt.Inputs[1].PartialSigs[pubKeyHex(t, psbt, 1)]
+	validSig := psbt.Inputs[0].PartialSigs[pubKeyHex(t, psbt, 0)]
+	psbt.Inputs[0].PartialSigs[pubKeyHex(t, psbt, 0)] = forgedSig
+	assert.ErrorIs(t, psbt.Finalize(), ErrPSBTIncomplete)
+	psbt.Inputs[0].PartialSigs[pubKeyHex(t, psbt, 0)] = validSig
+	assert.Nil(t, psbt.Finalize())
+
+	// a forged final signature is caught on extraction
+	psbt.Inputs[0].FinalSig = forgedSig
+	_, err = psbt.Extract()
+	assert.ErrorIs(t, err, ErrPSBTInvalidWitness)
+
+	// the signatures commit to the values of the spent outputs, so a value
+	// forged for the signer invalidates the transaction
+	forged, _ := NewPSBT(tx, prevTXs)
+	forged.Inputs[0].PrevOut.Value++
+	forged.Sign(privKey1)
+	forged.Sign(privKey2)
+	assert.Nil(t, forged.Finalize())
+	forgedTx, err := forged.Extract()
+	assert.Nil(t, err)
+	assert.ErrorIs(t, forgedTx.Verify(prevTXs), ErrBadSignature)
+
+	_, err = DeserializePSBT([]byte("not a psbt"))
+	assert.ErrorIs(t, err, ErrInvalidPSBT)
+	_, err = DeserializePSBT(append(append([]byte{}, psbtMagic...), 0x01, 0x02))
+	assert.ErrorIs(t, err, ErrInvalidPSBT)
+}
+
+// pubKeyHex returns the key of the only partial signature of an input
+func pubKeyHex(t *testing.T, psbt *PSBT, idx int) string {
+	for pubKey := range psbt.Inputs[idx].PartialSigs {
+		return pubKey
+	}
+	t.Fatal("input has no partial signature")
+	return ""
+}
+
+func TestPSBTSerialize(t *testing.T) {
+	bc, tx := newTestCoSigned(t)
+	prevTXs, _ := bc.GetInputTXsOf(tx)
+	psbt, _ := NewPSBT(tx, prevTXs)
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	psbt.Sign(privKey1)
+
+	decoded, err := DeserializePSBT(psbt.Serialize())
+	assert.Nil(t, err)
+	diff(t, psbt, decoded, "incorrect decoded PSBT")
+}
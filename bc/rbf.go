@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+)
+
+// Replace-by-fee lets a conflicting transaction paying more replace an
+// unconfirmed one, e.g. one stuck with a too low fee. The rules follow
+// BIP125, without the opt-in signaling:
+// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
+
+// MaxReplacementEvictions is the maximum number of transactions a
+// replacement evicts, descendants included
+const MaxReplacementEvictions = 100
+
+var (
+	ErrReplacementFee            = errors.New("replacement does not pay enough fee")
+	ErrReplacementFeeRate        = errors.New("replacement does not pay a higher fee rate")
+	ErrTooManyEvictions          = errors.New("replacement would evict too many transactions")
+	ErrReplacementSpendsConflict = errors.New("replacement spends an output of a transaction it replaces")
+	ErrNotChangeOutput           = errors.New("output is not a change output of the key")
+)
+
+// conflicts returns the entries spending the same outputs as tx
+func (mp *Mempool) conflicts(tx *Transaction) []*MempoolEntry {
+	var conflicts []*MempoolEntry
+	seen := make(map[string]bool)
+	for _, in := range tx.Vin {
+		if spender, ok := mp.spent[in.outpoint()]; ok && !seen[spender] {
+			seen[spender] = true
+			conflicts = append(conflicts, mp.entries[spender])
+		}
+	}
+	return conflicts
+}
+
+// replace adds tx in place of the conflicting entries and their descendants.
+// The mempool is left unchanged when tx is rejected.
+func (mp *Mempool) replace(tx *Transaction, conflicts []*MempoolEntry, checkFeeRate bool) error {
+	evicted := mp.withDescendants(conflicts)
+	if len(evicted) > MaxReplacementEvictions {
+		return ErrTooManyEvictions
+	}
+	evictedFee := 0
+	for txID, e := range evicted {
+		for _, in := range tx.Vin {
+			if fmt.Sprintf("%x", in.Txid) == txID {
+				return ErrReplacementSpendsConflict
+			}
+		}
+		evictedFee += e.Fee
+	}
+
+	mark := len(mp.journal)
+	for _, e := range evicted {
+		mp.removeEntry(e)
+	}
+	mp.rebuildUTXOs()
+	err := mp.accept(tx, checkFeeRate)
+	if err == nil {
+		err = checkReplacement(mp.entries[fmt.Sprintf("%x", tx.ID)], conflicts, evictedFee, mp.policy.MinRelayFeeRate)
+	}
+	if err != nil {
+		mp.rollback(mark)
+		return err
+	}
+	return nil
+}
+
+// checkReplacement checks that a replacement pays for the evicted
+// transactions plus its own relay at minRelayFeeRate, and pays a higher fee
+// rate than the ones it conflicts with
+func checkReplacement(entry *MempoolEntry, conflicts []*MempoolEntry, evictedFee int, minRelayFeeRate FeeRatePerKB) error {
+	if minFee := evictedFee + minRelayFeeRate.feeForSize(entry.Size); entry.Fee < minFee {
+		return fmt.Errorf("%w: %d, at least %d needed", ErrReplacementFee, entry.Fee, minFee)
+	}
+	for _, c := range conflicts {
+		if entry.compareFeeRate(c) <= 0 {
+			return ErrReplacementFeeRate
+		}
+	}
+	return nil
+}
+
+// BumpFee rebuilds an unconfirmed transaction of the owner of privKey so
+// that it pays fee, and signs it. The output at changeIdx, -1 when there is
+// none, is the change: it pays the fee and is added back last. The other
+// outputs are paid unchanged, a payment to the key itself included. Other
+// coins of the key are added when the change cannot cover the fee.
+// The returned transaction replaces the original once added to the mempool.
+func (mp *Mempool) BumpFee(txID []byte, privKey ecdsa.PrivateKey, changeIdx, fee int) (*Transaction, error) {
+	original, err := mp.Get(txID)
+	if err != nil {
+		return nil, err
+	}
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	// the coins of the original and of its descendants are available again
+	utxos := mp.utxosWithout(mp.withDescendants([]*MempoolEntry{original}))
+	builder := NewTxBuilder(pubKey, utxos)
+	builder.SetFeePolicy(FixedFee(fee))
+	for _, in := range original.Tx.Vin {
+		if err := builder.AddInput(in.Txid, in.OutIdx); err != nil {
+			return nil, err
+		}
+	}
+	outputs := append([]TXOutput{}, original.Tx.Vout...)
+	if changeIdx >= 0 {
+		if changeIdx >= len(outputs) || outputs[changeIdx].Type() != OutputPubKeyHash ||
+			!outputs[changeIdx].IsLockedWithKey(HashPubKey(pubKey)) {
+			return nil, fmt.Errorf("%w: %d", ErrNotChangeOutput, changeIdx)
+		}
+		outputs = append(outputs[:changeIdx], outputs[changeIdx+1:]...)
+	}
+	for _, out := range outputs {
+		if err := addOutputTo(builder, out); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	tx.LockTime = original.Tx.LockTime
+	tx.ID = tx.Hash()
+
+	prevTXs := make(map[string]*Transaction)
+	for _, in := range tx.Vin {
+		prevID := fmt.Sprintf("%x", in.Txid)
+		if e, ok := mp.entries[prevID]; ok {
+			prevTXs[prevID] = e.Tx
+		} else if prevTXs[prevID], err = mp.bc.FindTransaction(in.Txid); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Sign(privKey, prevTXs); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// addOutputTo adds a copy of out to the outputs of builder
+func addOutputTo(builder *TxBuilder, out TXOutput) error {
+	switch out.Type() {
+	case OutputHTLC:
+		return builder.AddHTLCOutput(*out.HTLC, out.Value)
+	case OutputDataCarrier:
+		return builder.AddData(out.Data)
+	case OutputSchnorr:
+		return builder.AddSchnorrOutput(out.SchnorrKey, out.Value)
+	default:
+		return builder.AddOutput(string(addressOfPubKeyHash(out.PubKeyHash)), out.Value)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceByFee(t *testing.T) {
+	bc, mp, genesisTx, cbTx := newTestMempool(t)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 1)
+	assert.Nil(t, mp.Add(txA))
+	child := spendTestCoin(t, mp.utxos, txA, 1, 1, 1)
+	assert.Nil(t, mp.Add(child))
+
+	// the replacement pays for txA, its child and the increment
+	lowFee := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 5, 2)
+	err := mp.Add(lowFee)
+	assert.ErrorIs(t, err, ErrReplacementFee)
+	assert.Equal(t, ErrReplacementFee.Error()+": 2, at least 3 needed", err.Error())
+	assert.Equal(t, 2, mp.Len())
+	assert.True(t, mp.Has(txA.ID))
+	assert.True(t, mp.Has(child.ID))
+
+	replacement := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 4, 4)
+	assert.Nil(t, mp.Add(replacement))
+	assert.Equal(t, 1, mp.Len())
+	assert.True(t, mp.Has(replacement.ID))
+	assert.Equal(t, []*Transaction{replacement}, mp.Select(MaxBlockSize))
+
+	// a larger transaction paying more, but less per byte
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	assert.Nil(t, builder.AddInput(genesisTx.ID, 0))
+	assert.Nil(t, builder.AddInput(cbTx.ID, 0))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 15))
+	assert.Nil(t, builder.AddData(make([]byte, MaxDataCarrierSize)))
+	builder.SetFeePolicy(FixedFee(5))
+	larger, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(larger, *privKey1))
+	assert.ErrorIs(t, mp.Add(larger), ErrReplacementFeeRate)
+	assert.True(t, mp.Has(replacement.ID))
+
+	// a replacement cannot depend on what it replaces
+	spendsConflict := &Transaction{
+		Vin:  []TXInput{{Txid: genesisTx.ID, OutIdx: 0}, {Txid: replacement.ID, OutIdx: 1}},
+		Vout: []TXOutput{*NewTXOutput(5, testAddressUser2)},
+	}
+	spendsConflict.ID = spendsConflict.Hash()
+	assert.ErrorIs(t, mp.Add(spendsConflict), ErrReplacementSpendsConflict)
+
+	// invalid replacements do not evict anything
+	unsigned := *replacement
+	unsigned.Vin = []TXInput{{Txid: genesisTx.ID, OutIdx: 0}}
+	unsigned.Vout = []TXOutput{*NewTXOutput(1, testAddressUser2)}
+	unsigned.ID = unsigned.Hash()
+	assert.ErrorIs(t, mp.Add(&unsigned), ErrBadSignature)
+	assert.True(t, mp.Has(replacement.ID))
+	assert.Equal(t, []*Transaction{replacement}, mp.Select(MaxBlockSize))
+}
+
+func TestReplaceByFeeRelayIncrement(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	policy := DefaultMempoolPolicy
+	policy.MinRelayFeeRate = 5
+	mp.SetPolicy(policy)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 1, 4)
+	assert.Nil(t, mp.Add(txA))
+
+	// the replacement pays for its own relay on top of the evicted fees
+	lowFee := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 1, 5)
+	minFee := 4 + (5*len(lowFee.Serialize())+999)/1000
+	assert.Greater(t, minFee, 5)
+	err := mp.Add(lowFee)
+	assert.ErrorIs(t, err, ErrReplacementFee)
+	assert.Equal(t, fmt.Sprintf("%s: 5, at least %d needed", ErrReplacementFee, minFee), err.Error())
+	assert.True(t, mp.Has(txA.ID))
+
+	replacement := spendTestCoin(t, bc.FindUTXOSet(), genesisTx, 0, 1, minFee)
+	assert.Nil(t, mp.Add(replacement))
+	assert.True(t, mp.Has(replacement.ID))
+	assert.False(t, mp.Has(txA.ID))
+}
+
+func TestReplaceByFeeEvictionLimit(t *testing.T) {
+	bc, mp, genesisTx, _ := newTestMempool(t)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	// the genesis coin is split in coins of user1, each passed on by a
+	// chain of free transactions within the package limits
+	const chains, chainLength = 5, MaxReplacementEvictions/5 + 1
+	policy := DefaultMempoolPolicy
+	policy.MinRelayFeeRate = 0
+	mp.SetPolicy(policy)
+	split := &Transaction{Vin: []TXInput{{Txid: genesisTx.ID, OutIdx: 0, PubKey: pubKeyToByte(*pubKey1)}}}
+	for i := 0; i < chains; i++ {
+		split.Vout = append(split.Vout, *NewTXOutput(2, testAddressUser1))
+	}
+	split.ID = split.Hash()
+	assert.Nil(t, bc.SignTransaction(split, *privKey1))
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "split")
+	block, err := bc.MineBlock([]*Transaction{cbTx, split})
+	assert.Nil(t, err)
+	mp.BlockConnected(block)
+
+	for i := 0; i < chains; i++ {
+		prevTX, outIdx := split, i
+		for j := 0; j < chainLength; j++ {
+			builder := NewTxBuilder(pubKeyToByte(*pubKey1), mp.utxos)
+			assert.Nil(t, builder.AddInput(prevTX.ID, outIdx))
+			assert.Nil(t, builder.AddOutput(testAddressUser1, 2))
+			builder.SetFeePolicy(FixedFee(0))
+			tx, err := builder.Build()
+			assert.Nil(t, err)
+			assert.Nil(t, tx.Sign(*privKey1, map[string]*Transaction{fmt.Sprintf("%x", prevTX.ID): prevTX}))
+			if !assert.Nil(t, mp.Add(tx)) {
+				return
+			}
+			prevTX, outIdx = tx, 0
+		}
+	}
+	assert.Greater(t, mp.Len(), MaxReplacementEvictions)
+
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), bc.FindUTXOSet())
+	for i := 0; i < chains; i++ {
+		assert.Nil(t, builder.AddInput(split.ID, i))
+	}
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 1))
+	builder.SetFeePolicy(FixedFee(9))
+	replacement, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SignTransaction(replacement, *privKey1))
+	assert.ErrorIs(t, mp.Add(replacement), ErrTooManyEvictions)
+	assert.Equal(t, chains*chainLength, mp.Len())
+}
+
+func TestBumpFee(t *testing.T) {
+	_, mp, genesisTx, _ := newTestMempool(t)
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	txA := spendTestCoin(t, mp.utxos, genesisTx, 0, 5, 1)
+	assert.Nil(t, mp.Add(txA))
+
+	// the fee is taken from the change
+	bumped, err := mp.BumpFee(txA.ID, *privKey1, 1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, txA.Vin[0].Txid, bumped.Vin[0].Txid)
+	assert.Equal(t, []TXOutput{txA.Vout[0], {Value: 2, PubKeyHash: txA.Vout[1].PubKeyHash}}, bumped.Vout)
+	assert.Nil(t, mp.Add(bumped))
+	assert.False(t, mp.Has(txA.ID))
+	entry, _ := mp.Get(bumped.ID)
+	assert.Equal(t, 3, entry.Fee)
+
+	// another coin pays the part of the fee the change cannot cover
+	bumped2, err := mp.BumpFee(bumped.ID, *privKey1, 1, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(bumped2.Vin))
+	assert.Equal(t, txA.Vout[0], bumped2.Vout[0])
+	assert.Nil(t, mp.Add(bumped2))
+	assert.Equal(t, 1, mp.Len())
+	entry, _ = mp.Get(bumped2.ID)
+	assert.Equal(t, 7, entry.Fee)
+
+	_, err = mp.BumpFee(txA.ID, *privKey1, 1, 4)
+	assert.ErrorIs(t, err, ErrTxNotFound)
+}
+
+func TestBumpFeeKeepsPayments(t *testing.T) {
+	_, mp, _, cbTx := newTestMempool(t)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	secretHash := make([]byte, 32)
+	htlc := HTLC{SecretHash: secretHash, ReceiverPubKeyHash: GetPubKeyHashFromAddress(testAddressUser2), SenderPubKeyHash: GetPubKeyHashFromAddress(testAddressUser1), LockHeight: 10}
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), mp.utxos)
+	assert.Nil(t, builder.AddInput(cbTx.ID, 0))
+	assert.Nil(t, builder.AddOutput(testAddressUser1, 2))
+	assert.Nil(t, builder.AddHTLCOutput(htlc, 3))
+	assert.Nil(t, builder.AddData([]byte("invoice")))
+	builder.SetFeePolicy(FixedFee(1))
+	txA, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, txA.Sign(*privKey1, map[string]*Transaction{fmt.Sprintf("%x", cbTx.ID): cbTx}))
+	assert.Nil(t, mp.Add(txA))
+
+	// only the change output pays the fee, the payment to the key itself is kept
+	bumped, err := mp.BumpFee(txA.ID, *privKey1, 3, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, txA.Vout[:3], bumped.Vout[:3])
+	assert.Equal(t, TXOutput{Value: 3, PubKeyHash: txA.Vout[3].PubKeyHash}, bumped.Vout[3])
+	assert.Nil(t, mp.Add(bumped))
+
+	// an output not locked with the key cannot be the change
+	_, err = mp.BumpFee(bumped.ID, *privKey1, 1, 3)
+	assert.ErrorIs(t, err, ErrNotChangeOutput)
+	_, err = mp.BumpFee(bumped.ID, *privKey1, 4, 3)
+	assert.ErrorIs(t, err, ErrNotChangeOutput)
+}
+
+func TestBumpFeeSelfPayment(t *testing.T) {
+	_, mp, genesisTx, _ := newTestMempool(t)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), mp.utxos)
+	assert.Nil(t, builder.AddInput(genesisTx.ID, 0))
+	assert.Nil(t, builder.AddOutput(testAddressUser1, 9))
+	builder.SetFeePolicy(FixedFee(1))
+	txA, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Len(t, txA.Vout, 1, "the whole coin is spent, there is no change")
+	assert.Nil(t, txA.Sign(*privKey1, map[string]*Transaction{fmt.Sprintf("%x", genesisTx.ID): genesisTx}))
+	assert.Nil(t, mp.Add(txA))
+
+	// the payment to the key itself is not mistaken for change
+	bumped, err := mp.BumpFee(txA.ID, *privKey1, -1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, txA.Vout[0], bumped.Vout[0])
+	assert.Equal(t, 2, len(bumped.Vin), "another coin pays the fee")
+	assert.Nil(t, mp.Add(bumped))
+	entry, _ := mp.Get(bumped.ID)
+	assert.Equal(t, 2, entry.Fee)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+)
+
+// Deterministic ECDSA signatures as specified by RFC 6979:
+// https://www.rfc-editor.org/rfc/rfc6979
+// The nonce is derived from the private key and the message hash with
+// HMAC-SHA256, so signing never depends on the quality of a random source
+// and the same message always gets the same signature.
+
+// rfc6979Nonces generates the sequence of candidate nonces (RFC 6979, 3.2)
+type rfc6979Nonces struct {
+	q    *big.Int
+	K, V []byte
+}
+
+func newRFC6979Nonces(q, x *big.Int, hash []byte) *rfc6979Nonces {
+	g := &rfc6979Nonces{q: q, K: make([]byte, sha256.Size), V: make([]byte, sha256.Size)}
+	for i := range g.V {
+		g.V[i] = 0x01
+	}
+	seed := append(g.int2octets(x), g.bits2octets(hash)...)
+	g.K = g.mac(g.V, []byte{0x00}, seed)
+	g.V = g.mac(g.V)
+	g.K = g.mac(g.V, []byte{0x01}, seed)
+	g.V = g.mac(g.V)
+	return g
+}
+
+func (g *rfc6979Nonces) mac(data ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.K)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// next returns the next nonce candidate in [1, q-1]
+func (g *rfc6979Nonces) next() *big.Int {
+	rolen := (g.q.BitLen() + 7) / 8
+	for {
+		var t []byte
+		for len(t) < rolen {
+			g.V = g.mac(g.V)
+			t = append(t, g.V...)
+		}
+		k := g.bits2int(t[:rolen])
+		// the state moves on, should the caller need another candidate
+		g.K = g.mac(g.V, []byte{0x00})
+		g.V = g.mac(g.V)
+		if k.Sign() > 0 && k.Cmp(g.q) < 0 {
+			return k
+		}
+	}
+}
+
+// bits2int keeps the leftmost qlen bits of b
+func (g *rfc6979Nonces) bits2int(b []byte) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - g.q.BitLen(); excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+	return v
+}
+
+func (g *rfc6979Nonces) int2octets(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, (g.q.BitLen()+7)/8))
+}
+
+func (g *rfc6979Nonces) bits2octets(b []byte) []byte {
+	z := g.bits2int(b)
+	return g.int2octets(z.Mod(z, g.q))
+}
+
+// signRFC6979 signs a message hash with a deterministic nonce.
+// The signature S is returned as computed, it may be high.
+func signRFC6979(privKey *ecdsa.PrivateKey, hash []byte) (*big.Int, *big.Int) {
+	curve := privKey.Curve
+	N := curve.Params().N
+	nonces := newRFC6979Nonces(N, privKey.D, hash)
+	e := nonces.bits2int(hash)
+	for {
+		k := nonces.next()
+		r, _ := curve.ScalarBaseMult(k.Bytes())
+		r.Mod(r, N)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = k^-1 (e + r*d) mod N
+		s := new(big.Int).Mul(r, privKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, N))
+		s.Mod(s, N)
+		if s.Sign() != 0 {
+			return r, s
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignRFC6979(t *testing.T) {
+	// RFC 6979, A.2.5: ECDSA, 256 Bits (Prime Field), with SHA-256
+	p256Key := &ecdsa.PrivateKey{D: hexInt("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")}
+	p256Key.Curve = elliptic.P256()
+	p256Key.X, p256Key.Y = p256Key.Curve.ScalarBaseMult(p256Key.D.Bytes())
+	// Widely used secp256k1 vectors, with the private key 1
+	s256Key := newS256PrivateKey(big.NewInt(1))
+
+	for _, test := range []struct {
+		name    string
+		privKey *ecdsa.PrivateKey
+		msg     string
+		k       string
+		r, s    string
+	}{
+		{
+			name:    "P-256 sample",
+			privKey: p256Key,
+			msg:     "sample",
+			k:       "a6e3c57dd01abe90086538398355dd4c3b17aa873382b0f24d6129493d8aad60",
+			r:       "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+			s:       "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+		},
+		{
+			name:    "P-256 test",
+			privKey: p256Key,
+			msg:     "test",
+			k:       "d16b6ae827f17175e040871a1c7ec3500192c4c92677336ec2537acaee0008e0",
+			r:       "f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+			s:       "019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083",
+		},
+		{
+			name:    "secp256k1 Satoshi Nakamoto",
+			privKey: s256Key,
+			msg:     "Satoshi Nakamoto",
+			k:       "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15",
+			r:       "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8",
+			s:       "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			hash := sha256.Sum256([]byte(test.msg))
+			nonces := newRFC6979Nonces(test.privKey.Curve.Params().N, test.privKey.D, hash[:])
+			assert.Equal(t, hexInt(test.k), nonces.next())
+
+			r, s := signRFC6979(test.privKey, hash[:])
+			assert.Equal(t, hexInt(test.r), r)
+			// the secp256k1 vectors give S in its low form
+			curve := test.privKey.Curve
+			assert.Equal(t, normalizeS(curve, hexInt(test.s)), normalizeS(curve, s))
+			assert.True(t, ecdsa.Verify(&test.privKey.PublicKey, hash[:], r, s))
+		})
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	privKey, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	prevTXs := map[string]*Transaction{
+		"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": testTransactions["tx0"],
+	}
+	var signatures [][]byte
+	for i := 0; i < 2; i++ {
+		tx := *testTransactions["tx1"]
+		tx.Vin = append([]TXInput{}, tx.Vin...)
+		assert.Nil(t, tx.Sign(*privKey, prevTXs))
+		signatures = append(signatures, tx.Vin[0].Signature)
+	}
+	assert.Equal(t, signatures[0], signatures[1])
+}
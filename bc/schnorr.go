@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Schnorr signatures over secp256k1 as specified by BIP340:
+// https://github.com/bitcoin/bips/blob/master/bip-0340.mediawiki
+// Public keys are the 32 bytes of the X coordinate of a point with an even Y.
+
+const (
+	SchnorrPubKeyLen    = 32
+	SchnorrSignatureLen = 64
+)
+
+var (
+	ErrInvalidSchnorrKey = errors.New("invalid Schnorr public key")
+	ErrSchnorrSign       = errors.New("could not create the Schnorr signature")
+)
+
+// taggedHash returns SHA256(SHA256(tag) || SHA256(tag) || msgs)
+func taggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msgs {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// xOnlyBytes returns the 32 bytes encoding of the X coordinate
+func xOnlyBytes(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, SchnorrPubKeyLen))
+}
+
+// hashToScalar interprets a hash as an integer modulo the curve order
+func hashToScalar(hash []byte) *big.Int {
+	e := new(big.Int).SetBytes(hash)
+	return e.Mod(e, S256().Params().N)
+}
+
+// liftX returns the point with the given X coordinate and an even Y
+func liftX(xBytes []byte) (*big.Int, *big.Int, error) {
+	if len(xBytes) != SchnorrPubKeyLen {
+		return nil, nil, ErrInvalidSchnorrKey
+	}
+	X, Y := elliptic.UnmarshalCompressed(S256(), append([]byte{0x02}, xBytes...))
+	if X == nil {
+		return nil, nil, ErrInvalidSchnorrKey
+	}
+	return X, Y, nil
+}
+
+// negateScalar returns N - k
+func negateScalar(k *big.Int) *big.Int {
+	return new(big.Int).Sub(S256().Params().N, k)
+}
+
+// SchnorrPubKey returns the x-only public key of a secp256k1 private key
+func SchnorrPubKey(privKey *ecdsa.PrivateKey) []byte {
+	return xOnlyBytes(privKey.X)
+}
+
+// SchnorrSign signs a 32 bytes message hash with a secp256k1 private key.
+// auxRand is the auxiliary randomness mixed into the nonce, it is read from
+// crypto/rand when nil.
+func SchnorrSign(privKey *ecdsa.PrivateKey, msg []byte, auxRand []byte) ([]byte, error) {
+	curve := S256()
+	N := curve.Params().N
+	if privKey.Curve != curve {
+		return nil, ErrKeyTypeMismatch
+	}
+	if auxRand == nil {
+		auxRand = make([]byte, 32)
+		if _, err := rand.Read(auxRand); err != nil {
+			return nil, err
+		}
+	}
+	d := new(big.Int).Set(privKey.D)
+	if privKey.Y.Bit(0) == 1 {
+		d = negateScalar(d)
+	}
+	pubKey := xOnlyBytes(privKey.X)
+
+	t := d.FillBytes(make([]byte, 32))
+	for i, b := range taggedHash("BIP0340/aux", auxRand) {
+		t[i] ^= b
+	}
+	k := hashToScalar(taggedHash("BIP0340/nonce", t, pubKey, msg))
+	if k.Sign() == 0 {
+		return nil, ErrSchnorrSign
+	}
+	Rx, Ry := curve.ScalarBaseMult(k.Bytes())
+	if Ry.Bit(0) == 1 {
+		k = negateScalar(k)
+	}
+	rBytes := xOnlyBytes(Rx)
+	e := hashToScalar(taggedHash("BIP0340/challenge", rBytes, pubKey, msg))
+
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, N)
+	sig := append(rBytes, s.FillBytes(make([]byte, 32))...)
+	if !SchnorrVerify(pubKey, msg, sig) {
+		return nil, ErrSchnorrSign
+	}
+	return sig, nil
+}
+
+// parseSchnorrSignature splits a signature into R.x and s, checking their range
+func parseSchnorrSignature(sig []byte) (*big.Int, *big.Int, bool) {
+	if len(sig) != SchnorrSignatureLen {
+		return nil, nil, false
+	}
+	params := S256().Params()
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(params.P) >= 0 || s.Cmp(params.N) >= 0 {
+		return nil, nil, false
+	}
+	return r, s, true
+}
+
+// SchnorrVerify verifies the signature of a message hash by an x-only public key
+func SchnorrVerify(pubKey, msg, sig []byte) bool {
+	curve := S256()
+	Px, Py, err := liftX(pubKey)
+	if err != nil {
+		return false
+	}
+	r, s, ok := parseSchnorrSignature(sig)
+	if !ok {
+		return false
+	}
+	e := hashToScalar(taggedHash("BIP0340/challenge", sig[:32], pubKey, msg))
+
+	// R = s*G - e*P
+	sGx, sGy := curve.ScalarBaseMult(s.Bytes())
+	ePx, ePy := curve.ScalarMult(Px, Py, negateScalar(e).Bytes())
+	Rx, Ry := curve.Add(sGx, sGy, ePx, ePy)
+	if Rx.Sign() == 0 && Ry.Sign() == 0 {
+		return false
+	}
+	return Ry.Bit(0) == 0 && Rx.Cmp(r) == 0
+}
+
+// SchnorrBatch collects Schnorr signatures to verify them all at once.
+// A batch is faster than verifying each signature, but only tells whether
+// all of them are valid.
+type SchnorrBatch struct {
+	pubKeys [][]byte
+	msgs    [][]byte
+	sigs    [][]byte
+}
+
+// Add adds a signature to the batch
+func (b *SchnorrBatch) Add(pubKey, msg, sig []byte) {
+	b.pubKeys = append(b.pubKeys, pubKey)
+	b.msgs = append(b.msgs, msg)
+	b.sigs = append(b.sigs, sig)
+}
+
+// Len returns the number of signatures in the batch
+func (b *SchnorrBatch) Len() int {
+	return len(b.sigs)
+}
+
+// Verify checks that all signatures of the batch are valid, that is
+// (s1 + a2*s2 + ... + au*su)*G = R1 + a2*R2 + ... + au*Ru + e1*P1 + (a2*e2)*P2 + ... + (au*eu)*Pu
+// for random a2 ... au.
+func (b *SchnorrBatch) Verify() bool {
+	switch len(b.sigs) {
+	case 0:
+		return true
+	case 1:
+		return SchnorrVerify(b.pubKeys[0], b.msgs[0], b.sigs[0])
+	}
+	curve := S256()
+	N := curve.Params().N
+	sum := new(big.Int)
+	sumX, sumY := new(big.Int), new(big.Int)
+	for i := range b.sigs {
+		Px, Py, err := liftX(b.pubKeys[i])
+		if err != nil {
+			return false
+		}
+		r, s, ok := parseSchnorrSignature(b.sigs[i])
+		if !ok {
+			return false
+		}
+		Rx, Ry, err := liftX(xOnlyBytes(r))
+		if err != nil {
+			return false
+		}
+		e := hashToScalar(taggedHash("BIP0340/challenge", b.sigs[i][:32], b.pubKeys[i], b.msgs[i]))
+
+		a := big.NewInt(1)
+		if i > 0 {
+			if a, err = randScalar(); err != nil {
+				return false
+			}
+		}
+		as := new(big.Int).Mul(a, s)
+		sum.Add(sum, as)
+		sum.Mod(sum, N)
+
+		aRx, aRy := curve.ScalarMult(Rx, Ry, a.Bytes())
+		e.Mul(e, a)
+		e.Mod(e, N)
+		ePx, ePy := curve.ScalarMult(Px, Py, e.Bytes())
+		sumX, sumY = curve.Add(sumX, sumY, aRx, aRy)
+		sumX, sumY = curve.Add(sumX, sumY, ePx, ePy)
+	}
+	Gx, Gy := curve.ScalarBaseMult(sum.Bytes())
+	return Gx.Cmp(sumX) == 0 && Gy.Cmp(sumY) == 0
+}
+
+// randScalar returns a random integer in [1, N-1]
+func randScalar() (*big.Int, error) {
+	max := new(big.Int).Sub(S256().Params().N, big.NewInt(1))
+	k, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return nil, err
+	}
+	return k.Add(k, big.NewInt(1)), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newS256PrivateKey returns the secp256k1 private key of the scalar d
+func newS256PrivateKey(d *big.Int) *ecdsa.PrivateKey {
+	privKey := &ecdsa.PrivateKey{D: d}
+	privKey.Curve = S256()
+	privKey.X, privKey.Y = S256().ScalarBaseMult(d.Bytes())
+	return privKey
+}
+
+// Test vectors from BIP340
+func TestSchnorrSign(t *testing.T) {
+	for _, test := range []struct {
+		privKey string
+		pubKey  string
+		auxRand string
+		msg     string
+		sig     string
+	}{
+		{
+			privKey: "0000000000000000000000000000000000000000000000000000000000000003",
+			pubKey:  "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+			auxRand: "0000000000000000000000000000000000000000000000000000000000000000",
+			msg:     "0000000000000000000000000000000000000000000000000000000000000000",
+			sig:     "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0",
+		},
+		{
+			privKey: "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef",
+			pubKey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			auxRand: "0000000000000000000000000000000000000000000000000000000000000001",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+		},
+		{
+			privKey: "c90fdaa22168c234c4c6628b80dc1cd129024e088a67cc74020bbea63b14e5c9",
+			pubKey:  "dd308afec5777e13121fa72b9cc1b7cc0139715309b086c960e18fd969774eb8",
+			auxRand: "c87aa53824b4d7ae2eb035a2b5bbbccc080e76cdc6d1692c4b0b62d798e6d906",
+			msg:     "7e2d58d8b3bcdf1abadec7829054f90dda9805aab56c77333024b9d0a508b75c",
+			sig:     "5831aaeed7b44bb74e5eab94ba9d4294c49bcf2a60728d8b4c200f50dd313c1bab745879a5ad954a72c45a91c3a51d3c7adea98d82f8481e0e1e03674a6f3fb7",
+		},
+	} {
+		privKey := newS256PrivateKey(new(big.Int).SetBytes(Hex2Bytes(test.privKey)))
+		assert.Equal(t, Hex2Bytes(test.pubKey), SchnorrPubKey(privKey))
+
+		sig, err := SchnorrSign(privKey, Hex2Bytes(test.msg), Hex2Bytes(test.auxRand))
+		assert.Nil(t, err)
+		assert.Equal(t, Hex2Bytes(test.sig), sig)
+		assert.True(t, SchnorrVerify(Hex2Bytes(test.pubKey), Hex2Bytes(test.msg), sig))
+	}
+}
+
+// Test vectors from BIP340
+func TestSchnorrVerifyInvalid(t *testing.T) {
+	pubKey := "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"
+	msg := "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89"
+	for _, test := range []struct {
+		name   string
+		pubKey string
+		sig    string
+	}{
+		{
+			name:   "public key not on the curve",
+			pubKey: "eefdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34",
+			sig:    "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e17776969e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+		},
+		{
+			name:   "has odd R.y",
+			pubKey: pubKey,
+			sig:    "fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a14602975563cc27944640ac607cd107ae10923d9ef7a73c643e166be5ebeafa34b1ac553e2",
+		},
+		{
+			name:   "negated message",
+			pubKey: pubKey,
+			sig:    "1fa62e331edbc21c394792d2ab1100a7b432b013df3f6ff4f99fcb33e0e1515f28890b3edb6e7189b630448b515ce4f8622a954cfe545735aaea5134fccdb2bd",
+		},
+		{
+			name:   "negated s",
+			pubKey: pubKey,
+			sig:    "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769961764b3aa9b2ffcb6ef947b6887a226e8d7c93e00c5ed0c1834ff0d0c2e6da6",
+		},
+		{
+			name:   "s equal to the curve order",
+			pubKey: pubKey,
+			sig:    "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+		},
+		{
+			name:   "truncated signature",
+			pubKey: pubKey,
+			sig:    "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.False(t, SchnorrVerify(Hex2Bytes(test.pubKey), Hex2Bytes(msg), Hex2Bytes(test.sig)))
+		})
+	}
+}
+
+func TestSchnorrBatch(t *testing.T) {
+	batch := &SchnorrBatch{}
+	assert.True(t, batch.Verify())
+
+	for i := 1; i <= 4; i++ {
+		privKey, _ := newKeyPairOfType(KeyTypeSecp256k1)
+		msg := taggedHash("test", []byte{byte(i)})
+		sig, err := SchnorrSign(&privKey, msg, nil)
+		assert.Nil(t, err)
+		batch.Add(SchnorrPubKey(&privKey), msg, sig)
+	}
+	assert.Equal(t, 4, batch.Len())
+	assert.True(t, batch.Verify())
+
+	// a single invalid signature fails the whole batch
+	batch.msgs[2] = taggedHash("test", []byte("other"))
+	assert.False(t, batch.Verify())
+}
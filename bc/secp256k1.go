@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+// secp256k1Curve implements elliptic.Curve for secp256k1, the curve used by
+// Bitcoin: y² = x³ + 7 over the prime field P.
+// The generic elliptic.CurveParams arithmetic assumes a = -3, so the curve
+// provides its own point operations in Jacobian coordinates.
+// NOTE: The arithmetic relies on math/big and is not constant time.
+type secp256k1Curve struct {
+	params *elliptic.CurveParams
+}
+
+var (
+	initSecp256k1 sync.Once
+	secp256k1     *secp256k1Curve
+)
+
+// S256 returns the secp256k1 curve
+func S256() elliptic.Curve {
+	initSecp256k1.Do(func() {
+		params := &elliptic.CurveParams{Name: "secp256k1", BitSize: 256}
+		params.P, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+		params.N, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+		params.B = big.NewInt(7)
+		params.Gx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+		params.Gy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+		secp256k1 = &secp256k1Curve{params: params}
+	})
+	return secp256k1
+}
+
+// Params implements elliptic.Curve
+func (c *secp256k1Curve) Params() *elliptic.CurveParams {
+	return c.params
+}
+
+// polynomial returns x³ + 7 mod P
+func (c *secp256k1Curve) polynomial(x *big.Int) *big.Int {
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	y2.Add(y2, c.params.B)
+	return y2.Mod(y2, c.params.P)
+}
+
+// IsOnCurve implements elliptic.Curve
+func (c *secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || x.Cmp(c.params.P) >= 0 || y.Sign() < 0 || y.Cmp(c.params.P) >= 0 {
+		return false
+	}
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, c.params.P)
+	return c.polynomial(x).Cmp(y2) == 0
+}
+
+// Add implements elliptic.Curve
+func (c *secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	p1 := c.toJacobian(x1, y1)
+	p2 := c.toJacobian(x2, y2)
+	return c.toAffine(c.addJacobian(p1, p2))
+}
+
+// Double implements elliptic.Curve
+func (c *secp256k1Curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.doubleJacobian(c.toJacobian(x1, y1)))
+}
+
+// ScalarMult implements elliptic.Curve
+func (c *secp256k1Curve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	base := c.toJacobian(x1, y1)
+	result := jacobianPoint{x: new(big.Int), y: new(big.Int), z: new(big.Int)}
+	for _, b := range k {
+		for bit := 7; bit >= 0; bit-- {
+			result = c.doubleJacobian(result)
+			if b>>uint(bit)&1 == 1 {
+				result = c.addJacobian(result, base)
+			}
+		}
+	}
+	return c.toAffine(result)
+}
+
+// ScalarBaseMult implements elliptic.Curve
+func (c *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
+
+// Unmarshal parses an uncompressed SEC1 point.
+// elliptic.Unmarshal uses it instead of its a = -3 curve equation.
+func (c *secp256k1Curve) Unmarshal(data []byte) (*big.Int, *big.Int) {
+	byteLen := (c.params.BitSize + 7) / 8
+	if len(data) != 1+2*byteLen || data[0] != 4 {
+		return nil, nil
+	}
+	x := new(big.Int).SetBytes(data[1 : 1+byteLen])
+	y := new(big.Int).SetBytes(data[1+byteLen:])
+	if !c.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	return x, y
+}
+
+// UnmarshalCompressed parses a compressed SEC1 point.
+// elliptic.UnmarshalCompressed uses it instead of its a = -3 curve equation.
+func (c *secp256k1Curve) UnmarshalCompressed(data []byte) (*big.Int, *big.Int) {
+	byteLen := (c.params.BitSize + 7) / 8
+	if len(data) != 1+byteLen || (data[0] != 2 && data[0] != 3) {
+		return nil, nil
+	}
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(c.params.P) >= 0 {
+		return nil, nil
+	}
+	y := new(big.Int).ModSqrt(c.polynomial(x), c.params.P)
+	if y == nil {
+		return nil, nil
+	}
+	if byte(y.Bit(0)) != data[0]&1 {
+		y.Neg(y).Mod(y, c.params.P)
+	}
+	if !c.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	return x, y
+}
+
+// jacobianPoint is the point (x/z², y/z³), z = 0 being the point at infinity
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+// toJacobian converts an affine point, (0, 0) being the point at infinity
+func (c *secp256k1Curve) toJacobian(x, y *big.Int) jacobianPoint {
+	z := new(big.Int)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		z.SetInt64(1)
+	}
+	return jacobianPoint{x: new(big.Int).Set(x), y: new(big.Int).Set(y), z: z}
+}
+
+func (c *secp256k1Curve) toAffine(p jacobianPoint) (*big.Int, *big.Int) {
+	if p.z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	P := c.params.P
+	zInv := new(big.Int).ModInverse(p.z, P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(p.x, zInv2)
+	x.Mod(x, P)
+	zInv2.Mul(zInv2, zInv)
+	y := new(big.Int).Mul(p.y, zInv2)
+	y.Mod(y, P)
+	return x, y
+}
+
+// addJacobian adds two points ("add-2007-bl")
+func (c *secp256k1Curve) addJacobian(p1, p2 jacobianPoint) jacobianPoint {
+	if p1.z.Sign() == 0 {
+		return p2
+	}
+	if p2.z.Sign() == 0 {
+		return p1
+	}
+	P := c.params.P
+	z1z1 := new(big.Int).Mul(p1.z, p1.z)
+	z1z1.Mod(z1z1, P)
+	z2z2 := new(big.Int).Mul(p2.z, p2.z)
+	z2z2.Mod(z2z2, P)
+
+	u1 := new(big.Int).Mul(p1.x, z2z2)
+	u1.Mod(u1, P)
+	u2 := new(big.Int).Mul(p2.x, z1z1)
+	u2.Mod(u2, P)
+	s1 := new(big.Int).Mul(p1.y, p2.z)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, P)
+	s2 := new(big.Int).Mul(p2.y, p1.z)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, P)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.doubleJacobian(p1)
+		}
+		return jacobianPoint{x: new(big.Int), y: new(big.Int), z: new(big.Int)}
+	}
+	r.Lsh(r, 1)
+
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	j := new(big.Int).Mul(h, i)
+	v := new(big.Int).Mul(u1, i)
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, v)
+	x3.Sub(x3, v)
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1.Mul(s1, j)
+	s1.Lsh(s1, 1)
+	y3.Sub(y3, s1)
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Add(p1.z, p2.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, P)
+	return jacobianPoint{x: x3, y: y3, z: z3}
+}
+
+// doubleJacobian doubles a point on a curve with a = 0 ("dbl-2009-l")
+func (c *secp256k1Curve) doubleJacobian(p jacobianPoint) jacobianPoint {
+	if p.z.Sign() == 0 || p.y.Sign() == 0 {
+		return jacobianPoint{x: new(big.Int), y: new(big.Int), z: new(big.Int)}
+	}
+	P := c.params.P
+	a := new(big.Int).Mul(p.x, p.x)
+	a.Mod(a, P)
+	b := new(big.Int).Mul(p.y, p.y)
+	b.Mod(b, P)
+	cc := new(big.Int).Mul(b, b)
+	cc.Mod(cc, P)
+
+	d := new(big.Int).Add(p.x, b)
+	d.Mul(d, d)
+	d.Sub(d, a)
+	d.Sub(d, cc)
+	d.Lsh(d, 1)
+	d.Mod(d, P)
+
+	e := new(big.Int).Lsh(a, 1)
+	e.Add(e, a)
+	f := new(big.Int).Mul(e, e)
+
+	x3 := new(big.Int).Sub(f, d)
+	x3.Sub(x3, d)
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e)
+	cc.Lsh(cc, 3)
+	y3.Sub(y3, cc)
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Mul(p.y, p.z)
+	z3.Lsh(z3, 1)
+	z3.Mod(z3, P)
+	return jacobianPoint{x: x3, y: y3, z: z3}
+}
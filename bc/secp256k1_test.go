@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hexInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+func TestS256Params(t *testing.T) {
+	curve := S256()
+	assert.Equal(t, "secp256k1", curve.Params().Name)
+	assert.True(t, curve.IsOnCurve(curve.Params().Gx, curve.Params().Gy))
+	assert.False(t, curve.IsOnCurve(curve.Params().Gx, new(big.Int).Add(curve.Params().Gy, big.NewInt(1))))
+	// the same curve instance is returned so keys can be compared
+	assert.True(t, curve == S256())
+}
+
+func TestS256ScalarBaseMult(t *testing.T) {
+	curve := S256()
+	for _, test := range []struct {
+		k    *big.Int
+		x, y string
+	}{
+		{
+			k: big.NewInt(1),
+			x: "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			y: "483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8",
+		},
+		{
+			k: big.NewInt(2),
+			x: "c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+			y: "1ae168fea63dc339a3c58419466ceaeef7f632653266d0e1236431a950cfe52a",
+		},
+		{
+			k: big.NewInt(3),
+			x: "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+			y: "388f7b0f632de8140fe337e62a37f3566500a99934c2231b6cb9fd7584b8e672",
+		},
+		{
+			k: new(big.Int).Sub(curve.Params().N, big.NewInt(1)),
+			x: "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			y: "b7c52588d95c3b9aa25b0403f1eef75702e84bb7597aabe663b82f6f04ef2777",
+		},
+	} {
+		x, y := curve.ScalarBaseMult(test.k.Bytes())
+		assert.Equal(t, hexInt(test.x), x, "x of %vG", test.k)
+		assert.Equal(t, hexInt(test.y), y, "y of %vG", test.k)
+	}
+
+	// N * G is the point at infinity
+	x, y := curve.ScalarBaseMult(curve.Params().N.Bytes())
+	assert.Equal(t, 0, x.Sign())
+	assert.Equal(t, 0, y.Sign())
+}
+
+func TestS256AddDouble(t *testing.T) {
+	curve := S256()
+	Gx, Gy := curve.Params().Gx, curve.Params().Gy
+
+	x1, y1 := curve.Double(Gx, Gy)
+	x2, y2 := curve.Add(Gx, Gy, Gx, Gy)
+	assert.Equal(t, x1, x2)
+	assert.Equal(t, y1, y2)
+
+	x3, y3 := curve.Add(x1, y1, Gx, Gy)
+	x4, y4 := curve.ScalarBaseMult([]byte{3})
+	assert.Equal(t, x4, x3)
+	assert.Equal(t, y4, y3)
+
+	// P + (-P) is the point at infinity, the neutral element
+	negY := new(big.Int).Sub(curve.Params().P, Gy)
+	x5, y5 := curve.Add(Gx, Gy, Gx, negY)
+	assert.Equal(t, 0, x5.Sign())
+	assert.Equal(t, 0, y5.Sign())
+	x6, y6 := curve.Add(x5, y5, Gx, Gy)
+	assert.Equal(t, Gx, x6)
+	assert.Equal(t, Gy, y6)
+}
+
+func TestS256Compressed(t *testing.T) {
+	curve := S256()
+	x, y := curve.ScalarBaseMult([]byte{1})
+	compressed := elliptic.MarshalCompressed(curve, x, y)
+	assert.Equal(t, Hex2Bytes("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"), compressed)
+
+	pubKey, err := parsePubKey(curve, compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, x, pubKey.X)
+	assert.Equal(t, y, pubKey.Y)
+
+	x, y = curve.ScalarBaseMult(new(big.Int).Sub(curve.Params().N, big.NewInt(1)).Bytes())
+	compressed = elliptic.MarshalCompressed(curve, x, y)
+	assert.Equal(t, byte(0x03), compressed[0])
+	pubKey, err = parsePubKey(curve, compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, y, pubKey.Y)
+
+	// x = 5 is not the abscissa of a point on secp256k1
+	notOnCurve := append([]byte{0x02}, make([]byte, 31)...)
+	notOnCurve = append(notOnCurve, 5)
+	_, err = parsePubKey(curve, notOnCurve)
+	assert.ErrorIs(t, err, ErrInvalidPubKey)
+}
+
+func TestS256ECDSA(t *testing.T) {
+	curve := S256()
+	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	assert.Nil(t, err)
+	hash := sha256.Sum256([]byte("secp256k1"))
+
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash[:])
+	assert.Nil(t, err)
+	assert.True(t, ecdsa.Verify(&privKey.PublicKey, hash[:], r, s))
+
+	hash[0] ^= 0xff
+	assert.False(t, ecdsa.Verify(&privKey.PublicKey, hash[:], r, s))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrInvalidPubKey    = errors.New("invalid public key encoding")
+	ErrInvalidSignature = errors.New("invalid signature encoding")
+	ErrHighS            = errors.New("signature S value is not canonical (high S)")
+)
+
+// compressedPubKeyLen is the length of a SEC1 compressed public key
+const compressedPubKeyLen = 33
+
+// parsePubKey parses a SEC1 compressed public key on the given curve
+func parsePubKey(curve elliptic.Curve, pubKey []byte) (*ecdsa.PublicKey, error) {
+	if len(pubKey) != compressedPubKeyLen {
+		return nil, ErrInvalidPubKey
+	}
+	X, Y := elliptic.UnmarshalCompressed(curve, pubKey)
+	if X == nil {
+		return nil, ErrInvalidPubKey
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: X, Y: Y}, nil
+}
+
+// encodeSignatureDER returns the DER encoding of the signature (r, s)
+// 0x30 <total length> 0x02 <length of r> <r> 0x02 <length of s> <s>
+func encodeSignatureDER(r, s *big.Int) []byte {
+	rb := derInteger(r)
+	sb := derInteger(s)
+	sig := []byte{0x30, byte(4 + len(rb) + len(sb))}
+	sig = append(sig, 0x02, byte(len(rb)))
+	sig = append(sig, rb...)
+	sig = append(sig, 0x02, byte(len(sb)))
+	sig = append(sig, sb...)
+	return sig
+}
+
+// derInteger returns the minimal big-endian encoding of a positive integer,
+// prefixed with a zero byte when the high bit is set
+func derInteger(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 {
+		return []byte{0x00}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0x00}, b...)
+	}
+	return b
+}
+
+// parseSignatureDER strictly parses a DER encoded signature.
+// Only the canonical encoding is accepted, and S must be in the lower half
+// of the curve order so that the signature cannot be malleated.
+func parseSignatureDER(curve elliptic.Curve, sig []byte) (*big.Int, *big.Int, error) {
+	// minimal size: 0x30 len 0x02 1 r 0x02 1 s
+	if len(sig) < 8 || len(sig) > 72 {
+		return nil, nil, ErrInvalidSignature
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-2 {
+		return nil, nil, ErrInvalidSignature
+	}
+	r, rest, err := parseDERInteger(sig[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	s, rest, err := parseDERInteger(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+	N := curve.Params().N
+	if r.Cmp(N) >= 0 || s.Cmp(N) >= 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+	if !isLowS(curve, s) {
+		return nil, nil, ErrHighS
+	}
+	return r, s, nil
+}
+
+// parseDERInteger parses a strictly encoded positive DER integer and
+// returns it with the remaining bytes
+func parseDERInteger(data []byte) (*big.Int, []byte, error) {
+	if len(data) < 3 || data[0] != 0x02 {
+		return nil, nil, ErrInvalidSignature
+	}
+	length := int(data[1])
+	if length == 0 || len(data) < 2+length {
+		return nil, nil, ErrInvalidSignature
+	}
+	b := data[2 : 2+length]
+	if b[0]&0x80 != 0 { // negative
+		return nil, nil, ErrInvalidSignature
+	}
+	if length > 1 && b[0] == 0x00 && b[1]&0x80 == 0 { // unnecessary padding
+		return nil, nil, ErrInvalidSignature
+	}
+	n := new(big.Int).SetBytes(b)
+	if n.Sign() == 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+	return n, data[2+length:], nil
+}
+
+// isLowS checks whether s is at most half the curve order
+func isLowS(curve elliptic.Curve, s *big.Int) bool {
+	halfN := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfN) <= 0
+}
+
+// normalizeS returns the low S equivalent of s
+func normalizeS(curve elliptic.Curve, s *big.Int) *big.Int {
+	if isLowS(curve, s) {
+		return s
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
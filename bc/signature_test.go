@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureDER(t *testing.T) {
+	curve := elliptic.P256()
+	for _, test := range []struct {
+		name    string
+		r, s    *big.Int
+		encoded []byte
+	}{
+		{
+			name:    "small values",
+			r:       big.NewInt(1),
+			s:       big.NewInt(2),
+			encoded: Hex2Bytes("3006020101020102"),
+		},
+		{
+			name:    "high bit padding",
+			r:       big.NewInt(0x80),
+			s:       big.NewInt(0x7f),
+			encoded: Hex2Bytes("30070202008002017f"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sig := encodeSignatureDER(test.r, test.s)
+			assert.Equal(t, test.encoded, sig)
+			r, s, err := parseSignatureDER(curve, sig)
+			assert.Nil(t, err)
+			assert.Equal(t, test.r, r)
+			assert.Equal(t, test.s, s)
+		})
+	}
+}
+
+func TestParseSignatureDERStrict(t *testing.T) {
+	curve := elliptic.P256()
+	highS := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	for _, test := range []struct {
+		name string
+		sig  []byte
+		err  error
+	}{
+		{name: "empty", sig: nil, err: ErrInvalidSignature},
+		{name: "wrong sequence tag", sig: Hex2Bytes("3106020101020102"), err: ErrInvalidSignature},
+		{name: "wrong total length", sig: Hex2Bytes("3007020101020102"), err: ErrInvalidSignature},
+		{name: "trailing bytes", sig: Hex2Bytes("300702010102010200"), err: ErrInvalidSignature},
+		{name: "unnecessary padding", sig: Hex2Bytes("300702020001020102"), err: ErrInvalidSignature},
+		{name: "negative r", sig: Hex2Bytes("3006020181020102"), err: ErrInvalidSignature},
+		{name: "zero s", sig: Hex2Bytes("3006020101020100"), err: ErrInvalidSignature},
+		{name: "wrong integer tag", sig: Hex2Bytes("3006030101020102"), err: ErrInvalidSignature},
+		{name: "high s", sig: encodeSignatureDER(big.NewInt(1), highS), err: ErrHighS},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := parseSignatureDER(curve, test.sig)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestNormalizeS(t *testing.T) {
+	curve := elliptic.P256()
+	N := curve.Params().N
+	lowS := big.NewInt(5)
+	assert.Equal(t, lowS, normalizeS(curve, lowS))
+	assert.Equal(t, lowS, normalizeS(curve, new(big.Int).Sub(N, lowS)))
+}
+
+func TestParsePubKey(t *testing.T) {
+	curve := elliptic.P256()
+	pubkey := decodePublicKey(testEncPubKeyUser1)
+
+	parsed, err := parsePubKey(curve, pubKeyToByte(*pubkey))
+	assert.Nil(t, err)
+	assert.True(t, pubkey.Equal(parsed))
+
+	// the former concatenation of coordinates is rejected
+	_, err = parsePubKey(curve, append(pubkey.X.Bytes(), pubkey.Y.Bytes()...))
+	assert.ErrorIs(t, err, ErrInvalidPubKey)
+
+	// unknown prefix
+	badPrefix := pubKeyToByte(*pubkey)
+	badPrefix[0] = 0x05
+	_, err = parsePubKey(curve, badPrefix)
+	assert.ErrorIs(t, err, ErrInvalidPubKey)
+}
@@ -47,15 +47,6 @@ func diff(t *testing.T, want interface{}, got interface{}, message string) {
 	}
 }
 
-func removeTXInputSignature(tx *Transaction) {
-	var inputs []TXInput
-
-	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.OutIdx, nil, vin.PubKey})
-	}
-	*tx = Transaction{tx.ID, inputs, tx.Vout}
-}
-
 // Transactions example flow:
 // tx0: genesis coinbase tx - Rodrigo received 10 coins
 // tx1: Rodrigo sent 5 coins to Leander and get 5 coins as remainder
@@ -67,10 +58,11 @@ func removeTXInputSignature(tx *Transaction) {
 // get 1 coin as remainder
 // tx5: Using tx3 and tx4 outputs, Leander sent 3 "coins" to Rodrigo
 //
-// NOTE: The mocked txs below ignores the tx signature!
+// The inputs are signed with the deterministic signatures of testEncPrivKeyUser1
+// and testEncPrivKeyUser2.
 var testTransactions = map[string]*Transaction{
 	"tx0": {
-		ID: Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+		ID: Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 		Vin: []TXInput{
 			{
 				Txid:      nil,
@@ -82,114 +74,114 @@ var testTransactions = map[string]*Transaction{
 		Vout: []TXOutput{
 			{
 				Value:      BlockReward,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	},
 	"tx1": {
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
-				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	},
 	"tx2": {
-		ID: Hex2Bytes("dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492"),
+		ID: Hex2Bytes("4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+				Txid:      Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 				OutIdx:    0,
-				Signature: nil,
-				PubKey:    Hex2Bytes("c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882dd401732381783c7444112abc729b3bee04643015d80fe67e0c28a5b28a20910"),
+				Signature: Hex2Bytes("3045022100be0f505abc63b632ee7bff4df9443555d9cc5775f0294eb1ea0251ba0bc4ea1102201faaf093689a6f0764aaac6121fdadea18574dd1d73aeb6f893f07da7a103c4c"),
+				PubKey:    Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      3,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 			{
 				Value:      2,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 		},
 	},
 	"tx3": {
-		ID: Hex2Bytes("e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b"),
+		ID: Hex2Bytes("481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+				Txid:      Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 				OutIdx:    1,
-				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("30450221009543a9b0050b8834041c4d1edb5683b4e0a7ba09f2c6d59d71cb8643a5658c5902207700ddf38fb714d9c99ea85dfc7ad5aafac3d299bdbf51d8cd732694276892b9"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      1,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      4,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	},
 	"tx4": {
-		ID: Hex2Bytes("91d6fe8fe351e50fa6e16bb391ff74f5dc650646ce6ad02442e647742566b31b"),
+		ID: Hex2Bytes("b0bb3f82ac0dfdf656e9fffec548fa64a60e766ae7d99823111af67c5c114600"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492"),
+				Txid:      Hex2Bytes("4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154"),
 				OutIdx:    0,
-				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("30450221009fbf6146e6275cc56ce379d9606996d3dbc3cff39a53e2f1adc6c1239eac16e902205c7e9dc54c76c93bbe7d981a7f57e60162ce93532fc1ab4c2efb8586b02ac9bf"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      2,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      1,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	},
 	"tx5": {
-		ID: Hex2Bytes("b63d956b234d27c3494d9935ac9764634db0232f32ef7f576979d8ba5ec93fbc"),
+		ID: Hex2Bytes("e01338ccc29acd3444745baa362db188fa900ce81bfa9b1beff08395843d7ede"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b"),
+				Txid:      Hex2Bytes("481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a"),
 				OutIdx:    0,
-				Signature: nil,
-				PubKey:    Hex2Bytes("c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882dd401732381783c7444112abc729b3bee04643015d80fe67e0c28a5b28a20910"),
+				Signature: Hex2Bytes("3045022100aa6555c7d270919d6974aa7a204f55bd83cc65fff81ec250eb4739e682ec45ee02201b55dbcf8eba09085404f45d6427a0c9c7b0baf0ce4fdb735f6d7a1066ecdef3"),
+				PubKey:    Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882"),
 			},
 			{
-				Txid:      Hex2Bytes("91d6fe8fe351e50fa6e16bb391ff74f5dc650646ce6ad02442e647742566b31b"),
+				Txid:      Hex2Bytes("b0bb3f82ac0dfdf656e9fffec548fa64a60e766ae7d99823111af67c5c114600"),
 				OutIdx:    0,
-				Signature: nil,
-				PubKey:    Hex2Bytes("c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882dd401732381783c7444112abc729b3bee04643015d80fe67e0c28a5b28a20910"),
+				Signature: Hex2Bytes("3045022100aa6555c7d270919d6974aa7a204f55bd83cc65fff81ec250eb4739e682ec45ee02201b55dbcf8eba09085404f45d6427a0c9c7b0baf0ce4fdb735f6d7a1066ecdef3"),
+				PubKey:    Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      3,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	},
@@ -199,7 +191,9 @@ func getTestInputsTX(tx string) []TXInput {
 	return testTransactions[tx].Vin
 }
 
-func newMockCoinbaseTX(to, data, txID string) *Transaction {
+// newMockCoinbaseTX creates the coinbase of a mined block, committing to the
+// witness root of the block when not empty
+func newMockCoinbaseTX(to, data, txID, witnessRoot string) *Transaction {
 	tx := &Transaction{
 		ID: Hex2Bytes(txID),
 		Vin: []TXInput{
@@ -217,15 +211,18 @@ func newMockCoinbaseTX(to, data, txID string) *Transaction {
 			},
 		},
 	}
+	if witnessRoot != "" {
+		tx.Vout = append(tx.Vout, TXOutput{Data: append(append([]byte{}, witnessCommitmentHeader...), Hex2Bytes(witnessRoot)...)})
+	}
 	return tx
 }
 
 // Miner address: 12znKfjybYauJASaggYEKCWyN9MLKYfA5i
 var minerCoinbaseTx = map[string]*Transaction{
-	"tx1": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "1", "0ca136effc2424a42d2bcf6b498e7c0c226ada6eff5499a7fa600c0ae6bad9c0"),
-	"tx2": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "2", "64e97834110d5525f68fbf719743cd22feffb4e91ffb50639f5e232228e3f1e5"),
-	"tx3": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "3", "68f0b05abdfa09bbfb732e37248ccb2a737db189d03d22224c3aa13afe593994"),
-	"tx4": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "4", "c8b152a0040e1f98b261b41444d6eeca09c3bfcc7d1ec69a792748f70efa1efb"),
+	"tx1": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "1", "1f59ca84f2fa689d98c64be3486f1b28b82a2f74f153eaa2fb914c14fb8058f7", "9d9471d0ddc6bb7911ec495973a2d927329841c42170de8fb4a5174f820e93a8"),
+	"tx2": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "2", "fb3d954fb90a2eb867e7da1aedab00636b85d38b7bd6f2a04471e8234a9f16bf", "48f5263dafbe8c0ca393e7eb0d7cf4eb1d0f9da553c59ce4e5516993321cc6cb"),
+	"tx3": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "3", "d145ce4b0f255d422f74854f7a7a2d47d81f48fef0cc7d1d35f7cffe4cf1e7fc", "8b688bb5bca0153e4871e26928336a31c52f6051751e74d05cef1d1ad7956278"),
+	"tx4": newMockCoinbaseTX("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971", "4", "3917076ffff3af483635a68a5285a56d91a7809b15354feef91fe0dac744a47d", "ebe86db1b304747ce331c1157cddb154b8dd488d42da7b70604ce07fa8666367"),
 }
 
 var testBlockchainData = map[string]*Block{
@@ -235,8 +232,10 @@ var testBlockchainData = map[string]*Block{
 			testTransactions["tx0"],
 		},
 		PrevBlockHash: nil,
-		Hash:          Hex2Bytes("00d4eeaee903dce5468d4c6975376dfbc4c45ea1bc6c5bbbfd8e13b26aaf6e3b"),
-		Nonce:         59,
+		MerkleRoot:    Hex2Bytes("ca7462c236948a5860447acbb9f0c22b1ff855f5afac56f62e4842d91af025fb"),
+		Difficulty:    TARGETBITS,
+		Hash:          Hex2Bytes("00fddc3b9eee74d66e584941b5b133b31f66931b0c7ffcccd8c5cb4b2f0b77cb"),
+		Nonce:         550,
 	},
 	"block1": {
 		Timestamp: TestBlockTime,
@@ -244,9 +243,11 @@ var testBlockchainData = map[string]*Block{
 			minerCoinbaseTx["tx1"],
 			testTransactions["tx1"],
 		},
-		PrevBlockHash: Hex2Bytes("00d4eeaee903dce5468d4c6975376dfbc4c45ea1bc6c5bbbfd8e13b26aaf6e3b"),
-		Hash:          Hex2Bytes("0017379eb3ca189e5deaecc58523533883452ffe7dbba43cd71c3319d392a931"),
-		Nonce:         35,
+		PrevBlockHash: Hex2Bytes("00fddc3b9eee74d66e584941b5b133b31f66931b0c7ffcccd8c5cb4b2f0b77cb"),
+		MerkleRoot:    Hex2Bytes("0cadb68130a658756fd10c1c31667ad2714491af1fe75a22c8dc2c892455ef60"),
+		Difficulty:    TARGETBITS,
+		Hash:          Hex2Bytes("0091a88d499686189c86776c97c1eb9bebe8bcb64adebd0a77219b509e56bcb4"),
+		Nonce:         521,
 	},
 	"block2": {
 		Timestamp: TestBlockTime,
@@ -255,9 +256,11 @@ var testBlockchainData = map[string]*Block{
 			testTransactions["tx3"],
 			testTransactions["tx2"],
 		},
-		PrevBlockHash: Hex2Bytes("0017379eb3ca189e5deaecc58523533883452ffe7dbba43cd71c3319d392a931"),
-		Hash:          Hex2Bytes("00f53a20971ded89b7e8192fbac5255211bc538e1ef705255dff352a78855b46"),
-		Nonce:         626,
+		PrevBlockHash: Hex2Bytes("0091a88d499686189c86776c97c1eb9bebe8bcb64adebd0a77219b509e56bcb4"),
+		MerkleRoot:    Hex2Bytes("51d0a22f8dd44bff57120a10f08ad132b67db4611cdd38398d7a72ce1e1b44d8"),
+		Difficulty:    TARGETBITS,
+		Hash:          Hex2Bytes("0071e50674baf83e41db9d1193becc74ed54a714b0e5767b626be052441a1129"),
+		Nonce:         198,
 	},
 	"block3": {
 		Timestamp: TestBlockTime,
@@ -265,9 +268,11 @@ var testBlockchainData = map[string]*Block{
 			minerCoinbaseTx["tx3"],
 			testTransactions["tx4"],
 		},
-		PrevBlockHash: Hex2Bytes("00f53a20971ded89b7e8192fbac5255211bc538e1ef705255dff352a78855b46"),
-		Hash:          Hex2Bytes("00efff94a452db304494aecb66dde7dad4d4ddea986d6eb7a7c71b70d6512a7d"),
-		Nonce:         279,
+		PrevBlockHash: Hex2Bytes("0071e50674baf83e41db9d1193becc74ed54a714b0e5767b626be052441a1129"),
+		MerkleRoot:    Hex2Bytes("71b94c94122a16f0691a283b6586083447c9727778b3f3abf5298872bf0d864d"),
+		Difficulty:    TARGETBITS,
+		Hash:          Hex2Bytes("00d49c4c35365b90a02e5493f2a83044ec1b989ad0025af3ac81cbae2eeeb157"),
+		Nonce:         65,
 	},
 	"block4": {
 		Timestamp: TestBlockTime,
@@ -275,9 +280,11 @@ var testBlockchainData = map[string]*Block{
 			minerCoinbaseTx["tx4"],
 			testTransactions["tx5"],
 		},
-		PrevBlockHash: Hex2Bytes("00efff94a452db304494aecb66dde7dad4d4ddea986d6eb7a7c71b70d6512a7d"),
-		Hash:          Hex2Bytes("00cb768ee28075b65bec7bb949571a1a940863389bfbbbcce9a3e82b78a94feb"),
-		Nonce:         154,
+		PrevBlockHash: Hex2Bytes("00d49c4c35365b90a02e5493f2a83044ec1b989ad0025af3ac81cbae2eeeb157"),
+		MerkleRoot:    Hex2Bytes("9a1b6eeeb0b7b6654d78cc4682eb18499025ff1fafda623fd3770a015dd20515"),
+		Difficulty:    TARGETBITS,
+		Hash:          Hex2Bytes("007fc4b33296b2ed143452fce9eb0fc347682395d0a080a549cbf2ed8821212d"),
+		Nonce:         172,
 	},
 }
 
@@ -288,21 +295,21 @@ var testUTXOs = map[string]struct {
 	"block0": { // (0 input -> 1 output, generating "coins")
 		utxos: UTXOSet{},
 		expectedUTXOs: UTXOSet{
-			"9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2": {0: testTransactions["tx0"].Vout[0]},
-			// tx0: Address 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh create coinbase transaction and received 10 "coins"
+			"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": {0: testTransactions["tx0"].Vout[0]},
+			// tx0: Address 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug create coinbase transaction and received 10 "coins"
 		},
 	},
 	"block1": { // (1 input -> 2 outputs, splitting one input)
 		utxos: UTXOSet{
-			"9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2": {0: testTransactions["tx0"].Vout[0]},
+			"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": {0: testTransactions["tx0"].Vout[0]},
 		},
 		expectedUTXOs: UTXOSet{
-			"397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13": {
+			"3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73": {
 				0: testTransactions["tx1"].Vout[0],
 				1: testTransactions["tx1"].Vout[1],
 			},
-			// tx1: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 5 "coins" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and get 5 as remainder
-			"0ca136effc2424a42d2bcf6b498e7c0c226ada6eff5499a7fa600c0ae6bad9c0": {
+			// tx1: 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug sent 5 "coins" to 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs and get 5 as remainder
+			"1f59ca84f2fa689d98c64be3486f1b28b82a2f74f153eaa2fb914c14fb8058f7": {
 				0: {
 					Value:      BlockReward,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
@@ -312,23 +319,23 @@ var testUTXOs = map[string]struct {
 	},
 	"block2": { // (1 input -> 2 output, with multiple txs)
 		utxos: UTXOSet{
-			"397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13": {
+			"3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73": {
 				0: testTransactions["tx1"].Vout[0],
 				1: testTransactions["tx1"].Vout[1],
 			},
 		},
 		expectedUTXOs: UTXOSet{
-			"dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492": {
+			"4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154": {
 				0: testTransactions["tx2"].Vout[0],
 				1: testTransactions["tx2"].Vout[1],
 			},
-			// tx2: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 1 "coin" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and get 4 as remainder
-			"e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b": {
+			// tx2: 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug sent 1 "coin" to 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs and get 4 as remainder
+			"481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a": {
 				0: testTransactions["tx3"].Vout[0],
 				1: testTransactions["tx3"].Vout[1],
 			},
-			// tx3: 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX sent 3 "coins" to 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh and get 2 as remainder
-			"64e97834110d5525f68fbf719743cd22feffb4e91ffb50639f5e232228e3f1e5": {
+			// tx3: 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs sent 3 "coins" to 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug and get 2 as remainder
+			"fb3d954fb90a2eb867e7da1aedab00636b85d38b7bd6f2a04471e8234a9f16bf": {
 				0: {
 					Value:      BlockReward,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
@@ -340,19 +347,19 @@ var testUTXOs = map[string]struct {
 	"block3": { // (1 input -> 2 outputs)
 		utxos: UTXOSet{
 			// tx3 was intentionally ignored
-			"dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492": {
+			"4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154": {
 				0: testTransactions["tx2"].Vout[0],
 				1: testTransactions["tx2"].Vout[1],
 			},
 		},
 		expectedUTXOs: UTXOSet{
-			"dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492": {1: testTransactions["tx2"].Vout[1]},
-			"91d6fe8fe351e50fa6e16bb391ff74f5dc650646ce6ad02442e647742566b31b": {
+			"4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154": {1: testTransactions["tx2"].Vout[1]},
+			"b0bb3f82ac0dfdf656e9fffec548fa64a60e766ae7d99823111af67c5c114600": {
 				0: testTransactions["tx4"].Vout[0],
 				1: testTransactions["tx4"].Vout[1],
 			},
-			// tx4: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 2 "coins" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and get 1 as remainder
-			"68f0b05abdfa09bbfb732e37248ccb2a737db189d03d22224c3aa13afe593994": {
+			// tx4: 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug sent 2 "coins" to 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs and get 1 as remainder
+			"d145ce4b0f255d422f74854f7a7a2d47d81f48fef0cc7d1d35f7cffe4cf1e7fc": {
 				0: {
 					Value:      BlockReward,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
@@ -362,21 +369,21 @@ var testUTXOs = map[string]struct {
 	},
 	"block4": { // (2 inputs -> 1 output)
 		utxos: UTXOSet{
-			"e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b": {
+			"481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a": {
 				0: testTransactions["tx3"].Vout[0],
 				1: testTransactions["tx3"].Vout[1],
 			},
-			"91d6fe8fe351e50fa6e16bb391ff74f5dc650646ce6ad02442e647742566b31b": {
+			"b0bb3f82ac0dfdf656e9fffec548fa64a60e766ae7d99823111af67c5c114600": {
 				0: testTransactions["tx4"].Vout[0],
 				1: testTransactions["tx4"].Vout[1],
 			},
 		},
 		expectedUTXOs: UTXOSet{
-			"e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b": {1: testTransactions["tx3"].Vout[1]},
-			"91d6fe8fe351e50fa6e16bb391ff74f5dc650646ce6ad02442e647742566b31b": {1: testTransactions["tx4"].Vout[1]},
-			"b63d956b234d27c3494d9935ac9764634db0232f32ef7f576979d8ba5ec93fbc": {0: testTransactions["tx5"].Vout[0]},
-			// tx5: 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX sent 3 "coins" to 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh
-			"c8b152a0040e1f98b261b41444d6eeca09c3bfcc7d1ec69a792748f70efa1efb": {
+			"481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a": {1: testTransactions["tx3"].Vout[1]},
+			"b0bb3f82ac0dfdf656e9fffec548fa64a60e766ae7d99823111af67c5c114600": {1: testTransactions["tx4"].Vout[1]},
+			"e01338ccc29acd3444745baa362db188fa900ce81bfa9b1beff08395843d7ede": {0: testTransactions["tx5"].Vout[0]},
+			// tx5: 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs sent 3 "coins" to 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug
+			"3917076ffff3af483635a68a5285a56d91a7809b15354feef91fe0dac744a47d": {
 				0: {
 					Value:      BlockReward,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
@@ -3,13 +3,11 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"math/big"
 	"strings"
 )
 
@@ -20,18 +18,25 @@ var (
 
 // Transaction represents a Bitcoin transaction
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
+	ID       []byte
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime int // The block height before which the transaction cannot be included in a block
 }
 
 // NewCoinbaseTX creates a new coinbase transaction
 func NewCoinbaseTX(to, data string) (*Transaction, error) {
+	return NewCoinbaseTXWithValue(to, data, BlockReward)
+}
+
+// NewCoinbaseTXWithValue creates a coinbase transaction paying value, e.g.
+// the block reward plus the fees of the block transactions
+func NewCoinbaseTXWithValue(to, data string, value int) (*Transaction, error) {
 	if data == "" {
 		data = fmt.Sprintf("Reward to %s", to)
 	}
 	txin := TXInput{OutIdx: -1, PubKey: []byte(data)}
-	txout := TXOutput{Value: BlockReward, PubKeyHash: GetPubKeyHashFromAddress(to)}
+	txout := TXOutput{Value: value, PubKeyHash: GetPubKeyHashFromAddress(to)}
 	txn := &Transaction{Vin: []TXInput{txin}, Vout: []TXOutput{txout}}
 	txn.ID = txn.Hash()
 	return txn, nil
@@ -40,23 +45,34 @@ func NewCoinbaseTX(to, data string) (*Transaction, error) {
 // NewUTXOTransaction creates a new UTXO transaction
 // NOTE: The returned tx is NOT signed!
 func NewUTXOTransaction(pubKey []byte, to string, amount int, utxos UTXOSet) (*Transaction, error) {
-	outputs := []TXOutput{}
-	hpubkey := HashPubKey(pubKey)
-	curBalance, inputs := utxoTxInputs(utxos, pubKey)
-	if curBalance >= amount {
-		txout := TXOutput{Value: amount, PubKeyHash: GetPubKeyHashFromAddress(to)}
-		outputs = append(outputs, txout)
-		unspent := curBalance - amount
-		if unspent > 0 {
-			outMyself := TXOutput{Value: unspent, PubKeyHash: hpubkey}
-			outputs = append(outputs, outMyself)
-		}
-		txn := &Transaction{Vin: inputs, Vout: outputs}
-		id := txn.Hash()
-		txn.ID = id
-		return txn, nil
+	return NewUTXOTransactionWithFee(pubKey, to, amount, 0, utxos, DefaultCoinSelector)
+}
+
+// NewUTXOTransactionWithFee creates a new UTXO transaction paying amount to
+// the address "to" and leaving fee to the miner. The selector picks only the
+// inputs needed to cover both, and no change is created for a near-exact match.
+// NOTE: The returned tx is NOT signed!
+func NewUTXOTransactionWithFee(pubKey []byte, to string, amount, fee int, utxos UTXOSet, selector CoinSelector) (*Transaction, error) {
+	builder := NewTxBuilder(pubKey, utxos)
+	if err := builder.AddOutput(to, amount); err != nil {
+		return nil, err
 	}
-	return nil, ErrNoFunds
+	builder.SetFeePolicy(FixedFee(fee))
+	builder.SetCoinSelector(selector)
+	return builder.Build()
+}
+
+// NewDataCarrierTransaction creates a new transaction anchoring data on chain
+// with an unspendable data-carrier output. The spent input is paid back as
+// change, less the fee of DefaultMinRelayFeeRate.
+// NOTE: The returned tx is NOT signed!
+func NewDataCarrierTransaction(pubKey []byte, data []byte, utxos UTXOSet) (*Transaction, error) {
+	builder := NewTxBuilder(pubKey, utxos)
+	if err := builder.AddData(data); err != nil {
+		return nil, err
+	}
+	builder.SetCoinSelector(SmallestFirst{})
+	return builder.Build()
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -69,6 +85,24 @@ func (tx Transaction) Equals(ID []byte) bool {
 	return bytes.Equal(tx.ID, ID)
 }
 
+// IsStandard checks whether the transaction follows the relay rules
+// Only one data-carrier output is allowed, holding at most MaxDataCarrierSize
+// bytes and no value
+func (tx Transaction) IsStandard() bool {
+	dataOutputs := 0
+	for _, out := range tx.Vout {
+		if out.Data == nil {
+			continue
+		}
+		dataOutputs++
+		if !out.IsDataCarrier() || len(out.Data) > MaxDataCarrierSize || out.Value != 0 ||
+			out.PubKeyHash != nil || out.HTLC != nil || out.SchnorrKey != nil {
+			return false
+		}
+	}
+	return dataOutputs <= 1
+}
+
 // Serialize returns a serialized Transaction
 func (tx Transaction) Serialize() []byte {
 	var buff bytes.Buffer
@@ -80,15 +114,52 @@ func (tx Transaction) Serialize() []byte {
 	return buff.Bytes()
 }
 
-// Hash returns the hash of the Transaction
+// Hash returns the hash of the Transaction body, its ID.
+// The witness (signatures, public keys and preimages of the inputs) is not
+// covered, so signing or malleating a signature never changes the ID.
 func (tx *Transaction) Hash() []byte {
-	txCopy := *tx
+	txCopy := tx.Body()
 	txCopy.ID = nil
 	serlizedTxn := txCopy.Serialize()
 	hbytes := sha256.Sum256(serlizedTxn)
 	return hbytes[:]
 }
 
+// WitnessHash returns the hash of the whole Transaction, witness included.
+// The witness hash of a coinbase is zero, as the coinbase commits to the
+// witness hashes of the other transactions of its block.
+func (tx *Transaction) WitnessHash() []byte {
+	if tx.IsCoinbase() {
+		return make([]byte, sha256.Size)
+	}
+	txCopy := *tx
+	txCopy.ID = nil
+	hbytes := sha256.Sum256(txCopy.Serialize())
+	return hbytes[:]
+}
+
+// Body returns a copy of the Transaction without its witness.
+// The input of a coinbase carries data instead of a witness and is kept.
+func (tx Transaction) Body() Transaction {
+	if tx.IsCoinbase() {
+		return tx
+	}
+	return tx.TrimmedCopy()
+}
+
+// HasWitness checks whether any input carries witness data
+func (tx Transaction) HasWitness() bool {
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, in := range tx.Vin {
+		if in.Signature != nil || in.PubKey != nil || in.Preimage != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // TrimmedCopy creates a trimmed copy of Transaction to be used in signing
 func (tx Transaction) TrimmedCopy() Transaction {
 	txinputs := []TXInput{}
@@ -105,7 +176,6 @@ func (tx Transaction) TrimmedCopy() Transaction {
 
 // Sign signs each input of a Transaction
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]*Transaction) error {
-	var signature []byte
 	var txinputs []TXInput
 	if tx.IsCoinbase() {
 		return nil
@@ -113,55 +183,148 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]*Transa
 	if !validInputs(tx.Vin, prevTXs) {
 		return ErrTxInputNotFound
 	}
-	// data to be signed
-	trimCopy := tx.TrimmedCopy()
-	data := dataToSign(&trimCopy, prevTXs)
-	r, s, err := ecdsa.Sign(rand.Reader, &privKey, data.Serialize())
+	if privKey.Curve != ActiveChainParams.KeyType.Curve() {
+		return ErrKeyTypeMismatch
+	}
+	// hash of the data to be signed
+	sigHash, err := tx.SigHash(prevTXs)
 	if err != nil {
-		return errors.New("could not sign the transaction input")
+		return err
 	}
-	signature = append(signature, r.Bytes()...)
-	signature = append(signature, s.Bytes()...)
+	// the nonce is derived from the key and the hash, see RFC 6979
+	r, s := signRFC6979(&privKey, sigHash)
+	signature := encodeSignatureDER(r, normalizeS(privKey.Curve, s))
 
-	for _, inp := range trimCopy.Vin {
-		if inp.Signature == nil {
-			txin := TXInput{Txid: inp.Txid,
-				OutIdx:    inp.OutIdx,
-				Signature: signature,
-				PubKey:    pubKeyToByte(privKey.PublicKey)}
-			txinputs = append(txinputs, txin)
+	for _, inp := range tx.Vin {
+		if prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx].IsSchnorr() {
+			// signed separately by SignSchnorr
+			txinputs = append(txinputs, inp)
+			continue
 		}
+		txin := TXInput{Txid: inp.Txid,
+			OutIdx:    inp.OutIdx,
+			Signature: signature,
+			PubKey:    pubKeyToByte(privKey.PublicKey),
+			Preimage:  inp.Preimage}
+		txinputs = append(txinputs, txin)
 	}
 	tx.Vin = txinputs
 	return nil
 }
 
-// Verify verifies signatures of Transaction inputs
-func (tx Transaction) Verify(prevTXs map[string]*Transaction) bool {
+// SignSchnorr signs the inputs spending Schnorr outputs locked with the
+// x-only key of privKey, a secp256k1 key
+func (tx *Transaction) SignSchnorr(privKey *ecdsa.PrivateKey, prevTXs map[string]*Transaction) error {
 	if tx.IsCoinbase() {
-		return true
+		return nil
+	}
+	sigHash, err := tx.SigHash(prevTXs)
+	if err != nil {
+		return err
+	}
+	signature, err := SchnorrSign(privKey, sigHash, nil)
+	if err != nil {
+		return err
+	}
+	pubKey := SchnorrPubKey(privKey)
+	for i, inp := range tx.Vin {
+		prevOut := prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx]
+		if prevOut.IsSchnorr() && bytes.Equal(prevOut.SchnorrKey, pubKey) {
+			tx.Vin[i].Signature = signature
+		}
 	}
+	return nil
+}
+
+// SigHash returns the 32 bytes hash committed to by the signatures of the
+// inputs, e.g. the message the signers of a MuSig session sign.
+// It commits to the values of the spent outputs, as BIP143 does, so a signer
+// given forged previous outputs, e.g. in a PSBT, signs a transaction that
+// does not verify instead of paying a fee it did not see.
+func (tx Transaction) SigHash(prevTXs map[string]*Transaction) ([]byte, error) {
 	if !validInputs(tx.Vin, prevTXs) {
-		return false
+		return nil, ErrTxInputNotFound
 	}
-	// reconstruct the signing data
 	trimCopy := tx.TrimmedCopy()
-	data := dataToSign(&trimCopy, prevTXs)
-	elCurve := elliptic.P256()
+	data := dataToSign(&trimCopy, prevTXs).Serialize()
 	for _, inp := range tx.Vin {
-		if len(inp.Signature) == 0 {
-			return false
+		value := prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx].Value
+		data = binary.BigEndian.AppendUint64(data, uint64(value))
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// Verify verifies the Transaction against the transactions its inputs spend
+// from: its ID must be its hash, the inputs must exist and unlock the spent
+// outputs, and the values must balance. The returned error is a *TxValidationError.
+func (tx Transaction) Verify(prevTXs map[string]*Transaction) error {
+	return tx.verify(prevTXs, nil)
+}
+
+// verify verifies the Transaction inputs. The Schnorr signatures are added
+// to batch when one is given, instead of being verified one by one.
+func (tx Transaction) verify(prevTXs map[string]*Transaction, batch *SchnorrBatch) error {
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return txError(ErrTxIDMismatch, -1)
+	}
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if len(tx.Serialize()) > MaxTxSize {
+		return txError(ErrTxOversized, -1)
+	}
+	spent := make(map[string]bool)
+	for i, inp := range tx.Vin {
+		prevTX, ok := prevTXs[fmt.Sprintf("%x", inp.Txid)]
+		if !ok || !prevTX.hasSpendableOutput(inp.OutIdx) {
+			return txError(ErrTxInputNotFound, i)
+		}
+		if spent[inp.outpoint()] {
+			return txError(ErrInputSpent, i)
+		}
+		spent[inp.outpoint()] = true
+	}
+	if err := tx.checkValues(prevTXs); err != nil {
+		return err
+	}
+	// reconstruct the signing data
+	sigHash, err := tx.SigHash(prevTXs)
+	if err != nil {
+		return txError(err, -1)
+	}
+	elCurve := ActiveChainParams.KeyType.Curve()
+	for i, inp := range tx.Vin {
+		prevOut := prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx]
+		if prevOut.IsSchnorr() {
+			if batch != nil {
+				batch.Add(prevOut.SchnorrKey, sigHash, inp.Signature)
+			} else if !SchnorrVerify(prevOut.SchnorrKey, sigHash, inp.Signature) {
+				return txError(ErrBadSignature, i)
+			}
+			continue
 		}
-		r, s := extractSign(inp.Signature)
-		X, Y := extractPubkey(inp.PubKey)
-		//X,Y := elliptic.Unmarshal(elCurve, inp.PubKey)
-		verfiedPubKey := ecdsa.PublicKey{Curve: elCurve, X: X, Y: Y}
-		verifySign := ecdsa.Verify(&verfiedPubKey, data.Serialize(), r, s)
+		r, s, err := parseSignatureDER(elCurve, inp.Signature)
+		if err != nil {
+			return txError(ErrBadSignature, i)
+		}
+		verfiedPubKey, err := parsePubKey(elCurve, inp.PubKey)
+		if err != nil {
+			return txError(ErrBadSignature, i)
+		}
+		verifySign := ecdsa.Verify(verfiedPubKey, sigHash, r, s)
 		if !verifySign {
-			return false
+			return txError(ErrBadSignature, i)
+		}
+		if prevOut.IsHTLC() {
+			if !prevOut.HTLC.CanSpend(inp, tx.LockTime) {
+				return txError(ErrBadSignature, i)
+			}
+		} else if !prevOut.IsLockedWithKey(HashPubKey(inp.PubKey)) {
+			return txError(ErrBadSignature, i)
 		}
 	}
-	return true
+	return nil
 }
 
 // String returns a human-readable representation of a transaction
@@ -176,37 +339,37 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("       OutIdx:    %d", input.OutIdx))
 		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
 		lines = append(lines, fmt.Sprintf("       PubKey: %x", input.PubKey))
+		if input.Preimage != nil {
+			lines = append(lines, fmt.Sprintf("       Preimage: %x", input.Preimage))
+		}
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
 		lines = append(lines, fmt.Sprintf("       PubKeyHash: %x", output.PubKeyHash))
+		if output.IsHTLC() {
+			lines = append(lines, fmt.Sprintf("       HTLC: %v", output.HTLC))
+		}
+		if output.IsDataCarrier() {
+			lines = append(lines, fmt.Sprintf("       Data: %x", output.Data))
+		}
+		if output.IsSchnorr() {
+			lines = append(lines, fmt.Sprintf("       SchnorrKey: %x", output.SchnorrKey))
+		}
 	}
 
-	return strings.Join(lines, "\n")
-}
-
-func utxoTxInputs(utxos UTXOSet, pubKey []byte) (int, []TXInput) {
-	curBalance := 0
-	inputs := []TXInput{}
-	hpubkey := HashPubKey(pubKey)
-	for id, utxoOut := range utxos {
-		tx := Hex2Bytes(id)
-		for idx, utxo := range utxoOut {
-			if utxo.IsLockedWithKey(hpubkey) {
-				curBalance += utxo.Value
-				txin := TXInput{Txid: tx, OutIdx: idx, PubKey: pubKey}
-				inputs = append(inputs, txin)
-			}
-		}
+	if tx.LockTime > 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
 	}
-	return curBalance, inputs
+
+	return strings.Join(lines, "\n")
 }
 
 func validInputs(inputs []TXInput, prevTXs map[string]*Transaction) bool {
 	for _, inp := range inputs {
-		if _, ok := prevTXs[fmt.Sprintf("%x", inp.Txid)]; !ok {
+		prevTX, ok := prevTXs[fmt.Sprintf("%x", inp.Txid)]
+		if !ok || !prevTX.hasSpendableOutput(inp.OutIdx) {
 			return false
 		}
 	}
@@ -220,27 +383,12 @@ func dataToSign(trimCopy *Transaction, prevTXs map[string]*Transaction) *Transac
 			getPrevOutput := prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx]
 			txin := inp
 			txin.PubKey = getPrevOutput.PubKeyHash
+			if getPrevOutput.IsSchnorr() {
+				txin.PubKey = getPrevOutput.SchnorrKey
+			}
 			txinputsKeys = append(txinputsKeys, txin)
 		}
 	}
 	trimCopy.Vin = txinputsKeys // update the trimcopy with new input.publickeys
 	return trimCopy
 }
-
-func extractSign(sign []byte) (*big.Int, *big.Int) {
-	rs := sign // reconstruct the signature
-	mid := len(rs) / 2
-	r := toBigInt(rs[:mid])
-	s := toBigInt(rs[mid:])
-	return r, s
-}
-
-func extractPubkey(XY []byte) (*big.Int, *big.Int) {
-	mid := len(XY) / 2
-	X := toBigInt(XY[:mid])
-	Y := toBigInt(XY[mid:])
-	if X == nil {
-		panic("could not revert the pubkey")
-	}
-	return X, Y
-}
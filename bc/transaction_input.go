@@ -2,7 +2,7 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"fmt"
 )
 
 // TXInput represents a transaction input
@@ -10,11 +10,16 @@ type TXInput struct {
 	Txid      []byte // The ID of the referenced transaction containing the output used
 	OutIdx    int    // The index of the specific output in the transaction. The first output is 0, etc.
 	Signature []byte // The signature of this input
-	PubKey    []byte // The logic that authorizes the use of this input by satisfying the output's PubKeyHash. In this demo we will be using the raw public key (not hashed)
+	PubKey    []byte // The logic that authorizes the use of this input by satisfying the output's PubKeyHash. In this demo we will be using the SEC1 compressed public key (not hashed)
+	Preimage  []byte // The secret revealed when claiming a hash time-locked output
 }
 
 // UsesKey checks whether the address initiated the transaction
 func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
-	txPubKey := sha256.Sum256(in.PubKey)
-	return bytes.Equal(txPubKey[:], pubKeyHash)
+	return bytes.Equal(HashPubKey(in.PubKey), pubKeyHash)
+}
+
+// outpoint returns the key of the output spent by the input
+func (in *TXInput) outpoint() string {
+	return fmt.Sprintf("%x:%d", in.Txid, in.OutIdx)
 }
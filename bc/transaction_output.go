@@ -2,13 +2,43 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 )
 
+var ErrInvalidDataSize = errors.New("invalid data-carrier output size")
+
+// OutputType is the kind of conditions locking an output
+type OutputType int
+
+const (
+	OutputPubKeyHash OutputType = iota
+	OutputSchnorr
+	OutputHTLC
+	OutputDataCarrier
+)
+
+func (t OutputType) String() string {
+	switch t {
+	case OutputPubKeyHash:
+		return "pubkeyhash"
+	case OutputSchnorr:
+		return "schnorr"
+	case OutputHTLC:
+		return "htlc"
+	case OutputDataCarrier:
+		return "data"
+	}
+	return fmt.Sprintf("OutputType(%d)", int(t))
+}
+
 // TXOutput represents a transaction output
 type TXOutput struct {
 	Value      int    // The transaction value
 	PubKeyHash []byte // The conditions to claim this output. For this demo we will use the hash of the public key (used to "lock" the output)
+	HTLC       *HTLC  // Optional hash time-locked contract conditions. When set, the PubKeyHash is empty
+	Data       []byte // Arbitrary data carried by a provably unspendable output. When set, the output has no owner
+	SchnorrKey []byte // Optional x-only key whose BIP340 Schnorr signature unlocks the output. When set, the PubKeyHash is empty
 }
 
 // Lock locks the transaction to a specific address
@@ -23,6 +53,19 @@ func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 	return bytes.Equal(out.PubKeyHash, pubKeyHash)
 }
 
+// IsDataCarrier checks whether the output only carries data and can never be spent
+func (out *TXOutput) IsDataCarrier() bool {
+	return len(out.Data) > 0
+}
+
+// NewDataOutput creates a new unspendable output carrying the given data
+func NewDataOutput(data []byte) (*TXOutput, error) {
+	if len(data) == 0 || len(data) > MaxDataCarrierSize {
+		return nil, ErrInvalidDataSize
+	}
+	return &TXOutput{Value: 0, Data: data}, nil
+}
+
 // NewTXOutput create a new TXOutput
 func NewTXOutput(value int, address string) *TXOutput {
 	// Create a new locked TXOutput
@@ -31,6 +74,47 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txout
 }
 
+// NewSchnorrOutput creates a new output locked with an x-only public key,
+// either of a single signer or aggregated from several ones
+func NewSchnorrOutput(value int, pubKey []byte) (*TXOutput, error) {
+	if _, _, err := liftX(pubKey); err != nil {
+		return nil, err
+	}
+	return &TXOutput{Value: value, SchnorrKey: pubKey}, nil
+}
+
+// IsSchnorr checks whether the output is locked with a Schnorr public key
+func (out *TXOutput) IsSchnorr() bool {
+	return len(out.SchnorrKey) > 0
+}
+
+// IsHTLC checks whether the output is locked by a hash time-locked contract
+func (out *TXOutput) IsHTLC() bool {
+	return out.HTLC != nil
+}
+
+// Type returns the kind of conditions locking the output
+func (out *TXOutput) Type() OutputType {
+	switch {
+	case out.IsHTLC():
+		return OutputHTLC
+	case out.IsDataCarrier():
+		return OutputDataCarrier
+	case out.IsSchnorr():
+		return OutputSchnorr
+	}
+	return OutputPubKeyHash
+}
+
 func (out TXOutput) String() string {
+	if out.IsHTLC() {
+		return fmt.Sprintf("{%d, %v}", out.Value, out.HTLC)
+	}
+	if out.IsDataCarrier() {
+		return fmt.Sprintf("{%d, data: %x}", out.Value, out.Data)
+	}
+	if out.IsSchnorr() {
+		return fmt.Sprintf("{%d, schnorr: %x}", out.Value, out.SchnorrKey)
+	}
 	return fmt.Sprintf("{%d, %x}", out.Value, out.PubKeyHash)
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"encoding/gob"
+	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,7 +71,7 @@ func TestIsCoinbase(t *testing.T) {
 
 func TestNewCoinbaseTXWithData(t *testing.T) {
 	// Passing data to the coinbase transaction
-	tx, err := NewCoinbaseTX("14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh", GenesisCoinbaseData)
+	tx, err := NewCoinbaseTX("13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug", GenesisCoinbaseData)
 	if tx == nil {
 		t.Fatal("NewCoinbaseTX returned nil")
 	}
@@ -79,12 +81,12 @@ func TestNewCoinbaseTXWithData(t *testing.T) {
 	assert.Nil(t, tx.Vin[0].Txid)
 	assert.Nil(t, tx.Vin[0].Signature)
 	assert.Equal(t, BlockReward, tx.Vout[0].Value)
-	assert.Equal(t, Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"), tx.Vout[0].PubKeyHash)
+	assert.Equal(t, Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"), tx.Vout[0].PubKeyHash)
 }
 
 func TestNewCoinbaseTXWithDefaultData(t *testing.T) {
 	// Using default data
-	tx, err := NewCoinbaseTX("14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh", "")
+	tx, err := NewCoinbaseTX("13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug", "")
 	if tx == nil {
 		t.Fatal("NewCoinbaseTX returned nil")
 	}
@@ -92,20 +94,20 @@ func TestNewCoinbaseTXWithDefaultData(t *testing.T) {
 	assert.Nil(t, tx.Vin[0].Txid)
 	assert.Equal(t, -1, tx.Vin[0].OutIdx)
 	assert.Equal(t, BlockReward, tx.Vout[0].Value)
-	assert.Equal(t, Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"), tx.Vout[0].PubKeyHash)
+	assert.Equal(t, Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"), tx.Vout[0].PubKeyHash)
 }
 
 func TestNewUTXOTransaction(t *testing.T) {
-	pubKey1Bytes := Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748")
-	fromAddress := "14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh"
+	pubKey1Bytes := Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d")
+	fromAddress := "13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug"
 
-	pubKey2Bytes := Hex2Bytes("c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882dd401732381783c7444112abc729b3bee04643015d80fe67e0c28a5b28a20910")
-	toAddress := "1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX"
+	pubKey2Bytes := Hex2Bytes("02c36d68bc641029e53a38252b436c596ef3d03a4a754743da50fb9a321020e882")
+	toAddress := "1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs"
 
 	// "from" address have 10 (i.e., genesis coinbase) and "to" address have 0
 	bc := newMockBlockchain()
 	utxos := UTXOSet{
-		"9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2": {0: testTransactions["tx0"].Vout[0]},
+		"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": {0: testTransactions["tx0"].Vout[0]},
 	}
 
 	// Reject if there is not sufficient funds
@@ -119,13 +121,16 @@ func TestNewUTXOTransaction(t *testing.T) {
 	if tx1 == nil {
 		t.Fatal("NewUTXOTransaction returned nil")
 	}
-	removeTXInputSignature(tx1)
+	// the signatures are deterministic
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	privKey2, _ := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	assert.Nil(t, bc.SignTransaction(tx1, *privKey1))
 	diff(t, testTransactions["tx1"], tx1, "incorrect transaction")
 
 	// update utxo and blockchain with tx1
 	addMockBlock(bc, testBlockchainData["block1"])
 	utxos = UTXOSet{
-		"397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13": {
+		"3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73": {
 			0: testTransactions["tx1"].Vout[0],
 			1: testTransactions["tx1"].Vout[1],
 		},
@@ -133,12 +138,12 @@ func TestNewUTXOTransaction(t *testing.T) {
 
 	tx2, err := NewUTXOTransaction(pubKey2Bytes, fromAddress, 3, utxos)
 	assert.Nil(t, err)
-	removeTXInputSignature(tx2)
+	assert.Nil(t, bc.SignTransaction(tx2, *privKey2))
 	diff(t, testTransactions["tx2"], tx2, "incorrect transaction")
 
 	tx3, err := NewUTXOTransaction(pubKey1Bytes, toAddress, 1, utxos)
 	assert.Nil(t, err)
-	removeTXInputSignature(tx3)
+	assert.Nil(t, bc.SignTransaction(tx3, *privKey1))
 	diff(t, testTransactions["tx3"], tx3, "incorrect transaction")
 }
 
@@ -146,47 +151,57 @@ func TestSign(t *testing.T) {
 	privKey, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
 
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
 
 	prevTXs := make(map[string]*Transaction)
-	prevTXs["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"] = testTransactions["tx0"]
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
 
 	err := tx.Sign(*privKey, prevTXs)
 	assert.Nil(t, err)
-	assert.NotNil(t, tx.Vin[0].Signature)
+	// signatures are deterministic (RFC 6979)
+	expected := *testTransactions["tx1"]
+	expected.Vin = []TXInput{
+		{
+			Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
+			OutIdx:    0,
+			Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+			PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
+		},
+	}
+	diff(t, &expected, tx, "incorrect signed transaction")
 }
 
 func TestSignIgnoreCoinbaseTX(t *testing.T) {
 	privKey, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
 
 	tx := &Transaction{
-		ID: Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+		ID: Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 		Vin: []TXInput{
 			{Txid: nil, OutIdx: -1, Signature: nil, PubKey: []byte(GenesisCoinbaseData)},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      BlockReward,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
@@ -201,29 +216,29 @@ func TestSignInvalidInputTX(t *testing.T) {
 	privKey, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
 
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
 				Txid:      Hex2Bytes("non-existentID"),
 				OutIdx:    0,
 				Signature: nil,
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
 
 	prevTXs := make(map[string]*Transaction)
-	prevTXs["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"] = testTransactions["tx0"]
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
 
 	err := tx.Sign(*privKey, prevTXs)
 	assert.ErrorIs(t, err, ErrTxInputNotFound)
@@ -233,115 +248,150 @@ func TestSignInvalidInputTX(t *testing.T) {
 func TestVerifyIgnoreCoinbaseTX(t *testing.T) {
 	tx := testTransactions["tx0"]
 	prevTXs := make(map[string]*Transaction)
-	assert.True(t, tx.Verify(prevTXs))
+	assert.Nil(t, tx.Verify(prevTXs))
 }
 
 func TestVerify(t *testing.T) {
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
-				Signature: Hex2Bytes("17b6db89942bb02b485332c9a3b37638e02a3dfafdf4c3a4fad7fc4c7b062cc8156b75957050e049cd307853522f5ef49339b1b1230359f59571af12c612bde2"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
 
 	prevTXs := make(map[string]*Transaction)
-	prevTXs["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"] = testTransactions["tx0"]
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
 	
-	assert.True(t, tx.Verify(prevTXs))
+	assert.Nil(t, tx.Verify(prevTXs))
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	tx := &Transaction{
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
+		Vin: []TXInput{
+			{
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
+				OutIdx:    0,
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
+			},
+		},
+		Vout: []TXOutput{
+			{
+				Value:      5,
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
+			},
+			{
+				Value:      5,
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
+			},
+		},
+	}
+
+	prevTXs := make(map[string]*Transaction)
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
+	assert.Nil(t, tx.Verify(prevTXs))
+
+	// (r, N-s) is also a valid ECDSA signature, but not a canonical one
+	curve := elliptic.P256()
+	r, s, err := parseSignatureDER(curve, tx.Vin[0].Signature)
+	assert.Nil(t, err)
+	tx.Vin[0].Signature = encodeSignatureDER(r, new(big.Int).Sub(curve.Params().N, s))
+	assert.ErrorIs(t, tx.Verify(prevTXs), ErrBadSignature)
 }
 
 func TestVerifyInvalidInputTX(t *testing.T) {
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("a56c8e6cb0c4f2b9e3677f54d27f7f2ef7ef16f09ab4bceb8f8c8f054f0dce2c"),
 		Vin: []TXInput{
 			{
 				Txid:      Hex2Bytes("non-existentID"),
 				OutIdx:    0,
-				Signature: Hex2Bytes("17b6db89942bb02b485332c9a3b37638e02a3dfafdf4c3a4fad7fc4c7b062cc8156b75957050e049cd307853522f5ef49339b1b1230359f59571af12c612bde2"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
 
 	prevTXs := make(map[string]*Transaction)
-	prevTXs["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"] = testTransactions["tx0"]
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
 
-	assert.False(t, tx.Verify(prevTXs))
+	assert.ErrorIs(t, tx.Verify(prevTXs), ErrTxInputNotFound)
 }
 
 func TestVerifyInvalidSignature(t *testing.T) {
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
 				Signature: Hex2Bytes("invalid"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
 
 	prevTXs := make(map[string]*Transaction)
-	prevTXs["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"] = testTransactions["tx0"]
+	prevTXs["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"] = testTransactions["tx0"]
 
-	assert.False(t, tx.Verify(prevTXs))
+	assert.ErrorIs(t, tx.Verify(prevTXs), ErrBadSignature)
 }
 
 func TestTrimmedCopy(t *testing.T) {
 	tx := &Transaction{
-		ID: Hex2Bytes("397b990007845099b4fe50ba23490f277b3bf6f5316b4082c343b14c5504ab13"),
+		ID: Hex2Bytes("3a10cc1b98fe560e802f2be7cce5cee718da1526a02e33e38990c2b4e1dd4c73"),
 		Vin: []TXInput{
 			{
-				Txid:      Hex2Bytes("9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"),
+				Txid:      Hex2Bytes("699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"),
 				OutIdx:    0,
-				Signature: Hex2Bytes("17b6db89942bb02b485332c9a3b37638e02a3dfafdf4c3a4fad7fc4c7b062cc8156b75957050e049cd307853522f5ef49339b1b1230359f59571af12c612bde2"),
-				PubKey:    Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"),
+				Signature: Hex2Bytes("3044022022301c93fca0f92a6a7ee3755fb48c21f6a72c09e5ed33fa2010e96518b14ece02206c51b3b1ec7c9a6061dcc6342e19e422167b64c8c72059f36a489a829ea458ef"),
+				PubKey:    Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"),
 			},
 		},
 		Vout: []TXOutput{
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04"),
+				PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3"),
 			},
 			{
 				Value:      5,
-				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
+				PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d"),
 			},
 		},
 	}
@@ -357,3 +407,107 @@ func TestTrimmedCopy(t *testing.T) {
 	assert.Equal(t, tx.Vout, txCopy.Vout)
 	assert.Equal(t, tx.ID, txCopy.ID)
 }
+
+func TestNewDataCarrierTransaction(t *testing.T) {
+	pubKey1Bytes := Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d")
+	utxos := UTXOSet{
+		"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": {0: testTransactions["tx0"].Vout[0]},
+	}
+	docHash := Hex2Bytes("fdfa9ad1db072757d55c11ba05aecae0bbd99e29b8dc2a869a68ebeb1ca09147")
+
+	tx, err := NewDataCarrierTransaction(pubKey1Bytes, docHash, utxos)
+	assert.Nil(t, err)
+	if tx == nil {
+		t.Fatal("NewDataCarrierTransaction returned nil")
+	}
+	assert.True(t, tx.Vout[0].IsDataCarrier())
+	assert.Equal(t, docHash, tx.Vout[0].Data)
+	assert.Equal(t, 0, tx.Vout[0].Value)
+	assert.Equal(t, BlockReward-1, tx.Vout[1].Value, "the change pays the relay fee")
+	assert.Equal(t, HashPubKey(pubKey1Bytes), tx.Vout[1].PubKeyHash)
+	assert.True(t, tx.IsStandard())
+
+	// Reject oversized data
+	_, err = NewDataCarrierTransaction(pubKey1Bytes, make([]byte, MaxDataCarrierSize+1), utxos)
+	assert.ErrorIs(t, err, ErrInvalidDataSize)
+
+	// Reject if there are no inputs to spend
+	_, err = NewDataCarrierTransaction(pubKey1Bytes, docHash, UTXOSet{})
+	assert.ErrorIs(t, err, ErrNoFunds)
+}
+
+func TestIsStandard(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		outputs  []TXOutput
+		standard bool
+	}{
+		{
+			name:     "payment",
+			outputs:  testTransactions["tx1"].Vout,
+			standard: true,
+		},
+		{
+			name:     "data carrier",
+			outputs:  []TXOutput{{Data: []byte("document hash")}},
+			standard: true,
+		},
+		{
+			name:     "oversized data",
+			outputs:  []TXOutput{{Data: make([]byte, MaxDataCarrierSize+1)}},
+			standard: false,
+		},
+		{
+			name:     "data carrier with value",
+			outputs:  []TXOutput{{Value: 1, Data: []byte("document hash")}},
+			standard: false,
+		},
+		{
+			name:     "multiple data carriers",
+			outputs:  []TXOutput{{Data: []byte("doc1")}, {Data: []byte("doc2")}},
+			standard: false,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tx := Transaction{Vin: testTransactions["tx1"].Vin, Vout: test.outputs}
+			assert.Equal(t, test.standard, tx.IsStandard())
+		})
+	}
+}
+
+func TestHashExcludesWitness(t *testing.T) {
+	privKey, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	prevTXs := map[string]*Transaction{
+		"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": testTransactions["tx0"],
+	}
+	tx := testTransactions["tx1"].TrimmedCopy()
+	tx.ID = tx.Hash()
+	unsignedWitnessHash := tx.WitnessHash()
+
+	// signing does not change the ID a child transaction may already spend
+	assert.Nil(t, tx.Sign(*privKey, prevTXs))
+	assert.True(t, tx.HasWitness())
+	assert.Equal(t, tx.ID, tx.Hash())
+	assert.NotEqual(t, unsignedWitnessHash, tx.WitnessHash())
+
+	// neither does malleating the signature
+	signedWitnessHash := tx.WitnessHash()
+	r, s, err := parseSignatureDER(elliptic.P256(), tx.Vin[0].Signature)
+	assert.Nil(t, err)
+	tx.Vin[0].Signature = encodeSignatureDER(r, new(big.Int).Sub(elliptic.P256().Params().N, s))
+	assert.Equal(t, tx.ID, tx.Hash())
+	assert.NotEqual(t, signedWitnessHash, tx.WitnessHash())
+
+	// the outputs are part of the body
+	tx.Vout = []TXOutput{{Value: 10, PubKeyHash: Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3")}}
+	assert.NotEqual(t, tx.ID, tx.Hash())
+}
+
+func TestCoinbaseHash(t *testing.T) {
+	cbTx1, _ := NewCoinbaseTX(testAddressUser1, "1")
+	cbTx2, _ := NewCoinbaseTX(testAddressUser1, "2")
+	// the coinbase data is part of the body and keeps coinbase IDs unique
+	assert.NotEqual(t, cbTx1.ID, cbTx2.ID)
+	assert.False(t, cbTx1.HasWitness())
+	assert.Equal(t, make([]byte, 32), cbTx1.WitnessHash())
+}
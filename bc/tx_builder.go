@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// estimatedSignatureSize is the size assumed for each missing input signature
+// when estimating the size of an unsigned transaction
+const estimatedSignatureSize = 72
+
+// maxFeeIterations bounds the rounds needed to settle inputs and fee
+const maxFeeIterations = 10
+
+var (
+	ErrNoOutputs       = errors.New("transaction has no outputs")
+	ErrInvalidAmount   = errors.New("output amount must be positive")
+	ErrInvalidAddress  = errors.New("invalid address")
+	ErrDuplicateOutput = errors.New("duplicate transaction output")
+	ErrDuplicateInput  = errors.New("duplicate transaction input")
+	ErrValueOverflow   = errors.New("transaction value overflow")
+	ErrNotSpendable    = errors.New("output cannot be spent with the key")
+	ErrFeeNotSettled   = errors.New("transaction fee did not settle")
+)
+
+// FeePolicy computes the fee a transaction has to pay
+type FeePolicy interface {
+	Fee(tx *Transaction) int
+}
+
+// FixedFee pays the same fee for any transaction
+type FixedFee int
+
+// Fee implements FeePolicy
+func (f FixedFee) Fee(tx *Transaction) int {
+	return int(f)
+}
+
+// FeeRate pays a fee per byte of the estimated signed transaction size
+type FeeRate int
+
+// Fee implements FeePolicy
+func (r FeeRate) Fee(tx *Transaction) int {
+	return int(r) * EstimateSize(tx)
+}
+
+// FeeRatePerKB pays a fee per 1000 bytes of the estimated signed transaction
+// size, rounded up
+type FeeRatePerKB int
+
+// Fee implements FeePolicy
+func (r FeeRatePerKB) Fee(tx *Transaction) int {
+	return r.feeForSize(EstimateSize(tx))
+}
+
+// feeForSize returns the fee of size bytes, rounded up
+func (r FeeRatePerKB) feeForSize(size int) int {
+	return (int(r)*size + 999) / 1000
+}
+
+// EstimateSize returns the serialized size of the transaction once signed
+func EstimateSize(tx *Transaction) int {
+	size := len(tx.Serialize())
+	for _, in := range tx.Vin {
+		if in.Signature == nil {
+			size += estimatedSignatureSize
+		}
+	}
+	return size
+}
+
+// TxBuilder builds an unsigned transaction paying several outputs at once.
+// The inputs are the explicitly added ones, completed with the coins of the
+// builder key chosen by the coin selector.
+type TxBuilder struct {
+	pubKey        []byte
+	utxos         UTXOSet
+	inputs        []Coin
+	inputKeys     map[string][]byte // The keys signing the explicit inputs, by hex pubkey hash
+	outputs       []TXOutput
+	changeAddress string
+	feePolicy     FeePolicy
+	selector      CoinSelector
+}
+
+// NewTxBuilder creates a builder funding transactions with the coins of pubKey.
+// By default the fee pays DefaultMinRelayFeeRate so that the mempool relays
+// the transaction, change goes back to pubKey and inputs are chosen by
+// DefaultCoinSelector.
+func NewTxBuilder(pubKey []byte, utxos UTXOSet) *TxBuilder {
+	return &TxBuilder{
+		pubKey:        pubKey,
+		utxos:         utxos,
+		inputKeys:     map[string][]byte{hex.EncodeToString(HashPubKey(pubKey)): pubKey},
+		changeAddress: string(GetAddress(pubKey)),
+		feePolicy:     DefaultMinRelayFeeRate,
+		selector:      DefaultCoinSelector,
+	}
+}
+
+// AddOutput adds an output paying amount to address
+func (b *TxBuilder) AddOutput(address string, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if !isValidAddress(address) {
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, address)
+	}
+	pubKeyHash := GetPubKeyHashFromAddress(address)
+	for _, out := range b.outputs {
+		if out.IsLockedWithKey(pubKeyHash) {
+			return fmt.Errorf("%w: %s", ErrDuplicateOutput, address)
+		}
+	}
+	if _, err := addValue(b.outputsValue(), amount); err != nil {
+		return err
+	}
+	b.outputs = append(b.outputs, TXOutput{Value: amount, PubKeyHash: pubKeyHash})
+	return nil
+}
+
+// AddSchnorrOutput adds an output paying amount to an x-only Schnorr key
+func (b *TxBuilder) AddSchnorrOutput(pubKey []byte, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	out, err := NewSchnorrOutput(amount, pubKey)
+	if err != nil {
+		return err
+	}
+	for _, o := range b.outputs {
+		if bytes.Equal(o.SchnorrKey, pubKey) {
+			return ErrDuplicateOutput
+		}
+	}
+	if _, err := addValue(b.outputsValue(), amount); err != nil {
+		return err
+	}
+	b.outputs = append(b.outputs, *out)
+	return nil
+}
+
+// AddHTLCOutput adds an output paying amount to a hash time-locked contract
+func (b *TxBuilder) AddHTLCOutput(htlc HTLC, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if len(htlc.SecretHash) != sha256.Size {
+		return ErrInvalidSecretHash
+	}
+	if _, err := addValue(b.outputsValue(), amount); err != nil {
+		return err
+	}
+	b.outputs = append(b.outputs, TXOutput{Value: amount, HTLC: &htlc})
+	return nil
+}
+
+// AddData adds an unspendable data-carrier output
+func (b *TxBuilder) AddData(data []byte) error {
+	out, err := NewDataOutput(data)
+	if err != nil {
+		return err
+	}
+	b.outputs = append(b.outputs, *out)
+	return nil
+}
+
+// AddInput adds the unspent output identified by txID and outIdx as an input.
+// The output must be spendable by the builder key.
+func (b *TxBuilder) AddInput(txID []byte, outIdx int) error {
+	return b.AddForeignInput(txID, outIdx, b.pubKey)
+}
+
+// AddForeignInput adds an unspent output of another key as an input, e.g. for
+// a transaction co-signed with a PSBT. pubKey is the key signing the input:
+// a SEC1 public key for pubkey hash outputs, an x-only key for Schnorr outputs.
+func (b *TxBuilder) AddForeignInput(txID []byte, outIdx int, pubKey []byte) error {
+	out, ok := b.utxos[fmt.Sprintf("%x", txID)][outIdx]
+	if !ok {
+		return ErrTxInputNotFound
+	}
+	if !canSpend(out, pubKey) {
+		return fmt.Errorf("%w: %x:%d", ErrNotSpendable, txID, outIdx)
+	}
+	for _, c := range b.inputs {
+		if c.OutIdx == outIdx && bytes.Equal(c.Txid, txID) {
+			return ErrDuplicateInput
+		}
+	}
+	if !out.IsSchnorr() {
+		b.inputKeys[hex.EncodeToString(out.PubKeyHash)] = pubKey
+	}
+	b.inputs = append(b.inputs, Coin{Txid: txID, OutIdx: outIdx, Output: out})
+	return nil
+}
+
+// SetChangeAddress sets the address receiving the change
+func (b *TxBuilder) SetChangeAddress(address string) error {
+	if !isValidAddress(address) {
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, address)
+	}
+	b.changeAddress = address
+	return nil
+}
+
+// SetFeePolicy sets the policy computing the transaction fee
+func (b *TxBuilder) SetFeePolicy(policy FeePolicy) {
+	b.feePolicy = policy
+}
+
+// SetCoinSelector sets the strategy completing the explicit inputs
+func (b *TxBuilder) SetCoinSelector(selector CoinSelector) {
+	b.selector = selector
+}
+
+// Build returns the unsigned transaction paying all outputs and the fee
+// NOTE: The returned tx is NOT signed!
+func (b *TxBuilder) Build() (*Transaction, error) {
+	if len(b.outputs) == 0 {
+		return nil, ErrNoOutputs
+	}
+	fee := 0
+	for i := 0; i < maxFeeIterations; i++ {
+		txn, err := b.assemble(fee)
+		if err != nil {
+			return nil, err
+		}
+		requiredFee := b.feePolicy.Fee(txn)
+		if requiredFee <= fee {
+			return txn, nil
+		}
+		fee = requiredFee
+	}
+	return nil, ErrFeeNotSettled
+}
+
+// assemble builds the transaction paying the outputs plus fee
+func (b *TxBuilder) assemble(fee int) (*Transaction, error) {
+	target, err := addValue(b.outputsValue(), fee)
+	if err != nil {
+		return nil, err
+	}
+	coins := append([]Coin{}, b.inputs...)
+	if missing := target - coinsValue(coins); missing > 0 || len(coins) == 0 {
+		selector := b.selector
+		if selector == nil {
+			selector = DefaultCoinSelector
+		}
+		selected, err := selector.Select(b.availableCoins(), missing)
+		if err != nil {
+			return nil, err
+		}
+		coins = append(coins, selected...)
+	}
+
+	inputs := []TXInput{}
+	for _, c := range coins {
+		// the output key alone verifies a Schnorr signature
+		in := TXInput{Txid: c.Txid, OutIdx: c.OutIdx}
+		if !c.Output.IsSchnorr() {
+			in.PubKey = b.inputKeys[hex.EncodeToString(c.Output.PubKeyHash)]
+		}
+		inputs = append(inputs, in)
+	}
+	outputs := append([]TXOutput{}, b.outputs...)
+	if change := coinsValue(coins) - target; change > CostOfChange {
+		outputs = append(outputs, TXOutput{Value: change, PubKeyHash: GetPubKeyHashFromAddress(b.changeAddress)})
+	}
+	txn := &Transaction{Vin: inputs, Vout: outputs}
+	txn.ID = txn.Hash()
+	return txn, nil
+}
+
+// availableCoins returns the coins of the builder key not already used as inputs
+func (b *TxBuilder) availableCoins() []Coin {
+	var coins []Coin
+	for _, c := range b.utxos.FindCoins(HashPubKey(b.pubKey)) {
+		used := false
+		for _, in := range b.inputs {
+			if in.OutIdx == c.OutIdx && bytes.Equal(in.Txid, c.Txid) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			coins = append(coins, c)
+		}
+	}
+	return coins
+}
+
+func (b *TxBuilder) outputsValue() int {
+	total := 0
+	for _, out := range b.outputs {
+		total += out.Value
+	}
+	return total
+}
+
+// canSpend checks whether the owner of pubKey signs for the output. The
+// x-only key of a Schnorr output is also matched by the SEC1 compressed key.
+func canSpend(out TXOutput, pubKey []byte) bool {
+	switch out.Type() {
+	case OutputPubKeyHash:
+		return out.IsLockedWithKey(HashPubKey(pubKey))
+	case OutputSchnorr:
+		if len(pubKey) == 33 {
+			pubKey = pubKey[1:]
+		}
+		return bytes.Equal(out.SchnorrKey, pubKey)
+	}
+	return false
+}
+
+// addValue adds two amounts, failing if the sum overflows
+func addValue(a, b int) (int, error) {
+	if b > math.MaxInt-a {
+		return 0, ErrValueOverflow
+	}
+	return a + b, nil
+}
+
+// isValidAddress checks an address without panicking on malformed input
+func isValidAddress(address string) bool {
+	if len(address) == 0 {
+		return false
+	}
+	decoded := Base58Decode([]byte(address))
+	return len(decoded) > addressChecksumLen && ValidateAddress(address)
+}
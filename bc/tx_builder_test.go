@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxBuilderBatchPayment(t *testing.T) {
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	utxos := getTestExpectedUTXOSet("block2") // 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug owns 4 and 3 coins
+
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), utxos)
+	for _, addr := range addressTable {
+		assert.Nil(t, builder.AddOutput(addr.address, 1))
+	}
+	assert.Nil(t, builder.AddData([]byte("payroll")))
+	assert.Nil(t, builder.SetChangeAddress(testAddressUser2))
+	builder.SetFeePolicy(FixedFee(2))
+	builder.SetCoinSelector(LargestFirst{})
+
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	if tx == nil {
+		t.Fatal("Build returned nil")
+	}
+	assert.Equal(t, 2, len(tx.Vin))
+	assert.Equal(t, len(addressTable)+2, len(tx.Vout))
+	for i, addr := range addressTable {
+		assert.Equal(t, TXOutput{Value: 1, PubKeyHash: addr.pubKeyHash}, tx.Vout[i])
+	}
+	assert.True(t, tx.Vout[len(addressTable)].IsDataCarrier())
+	change := tx.Vout[len(tx.Vout)-1]
+	assert.Equal(t, 7-len(addressTable)-2, change.Value)
+	assert.Equal(t, GetPubKeyHashFromAddress(testAddressUser2), change.PubKeyHash)
+	assert.Equal(t, tx.Hash(), tx.ID)
+}
+
+func TestTxBuilderExplicitInputs(t *testing.T) {
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	utxos := getTestExpectedUTXOSet("block2")
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), utxos)
+	tx3ID := Hex2Bytes("481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a")
+
+	assert.ErrorIs(t, builder.AddInput(tx3ID, 5), ErrTxInputNotFound)
+	assert.Nil(t, builder.AddInput(tx3ID, 1))
+	assert.ErrorIs(t, builder.AddInput(tx3ID, 1), ErrDuplicateInput)
+	// the coin of user2 is not signed with the builder key
+	assert.ErrorIs(t, builder.AddInput(tx3ID, 0), ErrNotSpendable)
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 3))
+
+	// the explicit input covers the payment
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tx.Vin))
+	assert.Equal(t, tx3ID, tx.Vin[0].Txid)
+	assert.Equal(t, 1, tx.Vin[0].OutIdx)
+
+	// the explicit input is completed with the other coins
+	builder.SetFeePolicy(FixedFee(2))
+	tx, err = builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tx.Vin))
+	assert.Equal(t, tx3ID, tx.Vin[0].Txid)
+	assert.Equal(t, 2, tx.Vout[1].Value)
+}
+
+func TestTxBuilderForeignInputs(t *testing.T) {
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	_, pubKey2 := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	schnorrKey, _ := newKeyPairOfType(KeyTypeSecp256k1)
+	utxos := UTXOSet{
+		"aa": {
+			0: {Value: 4, PubKeyHash: HashPubKey(pubKeyToByte(*pubKey2))},
+			1: {Value: 4, SchnorrKey: SchnorrPubKey(&schnorrKey)},
+			2: {Value: 4, HTLC: &HTLC{SecretHash: make([]byte, 32), ReceiverPubKeyHash: HashPubKey(pubKeyToByte(*pubKey1))}},
+		},
+	}
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), utxos)
+	txID := Hex2Bytes("aa")
+
+	for outIdx := range utxos["aa"] {
+		assert.ErrorIs(t, builder.AddInput(txID, outIdx), ErrNotSpendable)
+	}
+	assert.ErrorIs(t, builder.AddForeignInput(txID, 0, SchnorrPubKey(&schnorrKey)), ErrNotSpendable)
+	assert.Nil(t, builder.AddForeignInput(txID, 0, pubKeyToByte(*pubKey2)))
+	assert.Nil(t, builder.AddForeignInput(txID, 1, SchnorrPubKey(&schnorrKey)))
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 7))
+
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, pubKeyToByte(*pubKey2), tx.Vin[0].PubKey, "the input is signed by user2")
+	assert.Nil(t, tx.Vin[1].PubKey)
+}
+
+// growingFee asks for one more coin on every call
+type growingFee struct {
+	fee *int
+}
+
+func (f growingFee) Fee(tx *Transaction) int {
+	*f.fee++
+	return *f.fee
+}
+
+func TestTxBuilderFeeRate(t *testing.T) {
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	utxos := UTXOSet{
+		"699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228": {0: {Value: 100000, PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d")}},
+	}
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), utxos)
+	assert.Nil(t, builder.AddOutput(testAddressUser2, 1000))
+	builder.SetFeePolicy(FeeRate(2))
+
+	tx, err := builder.Build()
+	assert.Nil(t, err)
+	fee := 100000 - tx.Vout[0].Value - tx.Vout[1].Value
+	assert.Equal(t, 2*EstimateSize(tx), fee)
+
+	size := EstimateSize(tx)
+	assert.Equal(t, (1500*size+999)/1000, FeeRatePerKB(1500).Fee(tx))
+	assert.Equal(t, 1, FeeRatePerKB(1).Fee(tx), "the fee is rounded up")
+
+	// a fee that never settles is not a lack of funds
+	builder.SetFeePolicy(growingFee{fee: new(int)})
+	_, err = builder.Build()
+	assert.ErrorIs(t, err, ErrFeeNotSettled)
+}
+
+func TestTxBuilderInvalidOutputs(t *testing.T) {
+	_, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	builder := NewTxBuilder(pubKeyToByte(*pubKey1), getTestExpectedUTXOSet("block2"))
+
+	_, err := builder.Build()
+	assert.ErrorIs(t, err, ErrNoOutputs)
+
+	assert.ErrorIs(t, builder.AddOutput(testAddressUser2, 0), ErrInvalidAmount)
+	assert.ErrorIs(t, builder.AddOutput(testAddressUser2, -1), ErrInvalidAmount)
+	assert.ErrorIs(t, builder.AddOutput("", 1), ErrInvalidAddress)
+	assert.ErrorIs(t, builder.AddOutput(invalidAddresses[3], 1), ErrInvalidAddress)
+	assert.ErrorIs(t, builder.SetChangeAddress(invalidAddresses[3]), ErrInvalidAddress)
+
+	assert.ErrorIs(t, builder.AddHTLCOutput(HTLC{SecretHash: make([]byte, 32)}, 0), ErrInvalidAmount)
+	assert.ErrorIs(t, builder.AddHTLCOutput(HTLC{SecretHash: make([]byte, 16)}, 1), ErrInvalidSecretHash)
+
+	assert.Nil(t, builder.AddOutput(testAddressUser2, math.MaxInt))
+	assert.ErrorIs(t, builder.AddOutput(testAddressUser1, 1), ErrValueOverflow)
+	assert.ErrorIs(t, builder.AddOutput(testAddressUser2, 1), ErrDuplicateOutput)
+
+	_, err = builder.Build()
+	assert.ErrorIs(t, err, ErrNoFunds)
+}
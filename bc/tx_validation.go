@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of TxValidationError. Missing inputs and values out of range are
+// reported with ErrTxInputNotFound and ErrValueOverflow.
+var (
+	ErrInputSpent          = errors.New("transaction input is already spent")
+	ErrBadSignature        = errors.New("transaction input does not unlock the spent output")
+	ErrOutputsExceedInputs = errors.New("transaction outputs exceed its inputs")
+	ErrImmatureCoinbase    = errors.New("coinbase output spent before maturity")
+	ErrNonFinal            = errors.New("transaction is not final")
+	ErrTxOversized         = errors.New("transaction is too large")
+	ErrTxIDMismatch        = errors.New("transaction ID is not the hash of the transaction")
+)
+
+// TxValidationError is the reason a transaction is rejected.
+// It matches its Kind with errors.Is.
+type TxValidationError struct {
+	Kind  error
+	Input int // The index of the offending input, -1 when no input is at fault
+}
+
+func txError(kind error, input int) *TxValidationError {
+	return &TxValidationError{Kind: kind, Input: input}
+}
+
+func (e *TxValidationError) Error() string {
+	if e.Input < 0 {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("input %d: %v", e.Input, e.Kind)
+}
+
+func (e *TxValidationError) Unwrap() error {
+	return e.Kind
+}
+
+// hasSpendableOutput checks whether the transaction has an output at idx
+// that an input can spend
+func (tx *Transaction) hasSpendableOutput(idx int) bool {
+	return idx >= 0 && idx < len(tx.Vout) && !tx.Vout[idx].IsDataCarrier()
+}
+
+// checkValues checks that the outputs are in range and do not spend more
+// than the inputs. The inputs must have been checked to exist.
+func (tx Transaction) checkValues(prevTXs map[string]*Transaction) error {
+	in, out := 0, 0
+	for i, inp := range tx.Vin {
+		value := prevTXs[fmt.Sprintf("%x", inp.Txid)].Vout[inp.OutIdx].Value
+		var err error
+		if in, err = addValue(in, value); err != nil || value < 0 {
+			return txError(ErrValueOverflow, i)
+		}
+	}
+	for _, o := range tx.Vout {
+		var err error
+		if out, err = addValue(out, o.Value); err != nil || o.Value < 0 {
+			return txError(ErrValueOverflow, -1)
+		}
+	}
+	if out > in {
+		return txError(ErrOutputsExceedInputs, -1)
+	}
+	return nil
+}
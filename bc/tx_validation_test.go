@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxValidationError(t *testing.T) {
+	var err error = txError(ErrBadSignature, 2)
+	assert.ErrorIs(t, err, ErrBadSignature)
+	assert.Equal(t, "input 2: "+ErrBadSignature.Error(), err.Error())
+	assert.Equal(t, ErrNonFinal.Error(), txError(ErrNonFinal, -1).Error())
+
+	var txErr *TxValidationError
+	assert.True(t, errors.As(err, &txErr))
+	assert.Equal(t, 2, txErr.Input)
+}
+
+func TestVerifyErrors(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	genesisTx := bc.GetGenesisBlock().Transactions[0]
+	privKey1, _ := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	privKey2, _ := decodeKeyPair(testEncPrivKeyUser2, testEncPubKeyUser2)
+	genesisIn := TXInput{Txid: genesisTx.ID, OutIdx: 0}
+
+	for _, test := range []struct {
+		name    string
+		vin     []TXInput
+		vout    []TXOutput
+		privKey *ecdsa.PrivateKey
+		kind    error
+		inputAt int
+	}{
+		{
+			name:    "unknown output",
+			vin:     []TXInput{genesisIn, {Txid: genesisTx.ID, OutIdx: 5}},
+			vout:    []TXOutput{*NewTXOutput(10, testAddressUser2)},
+			kind:    ErrTxInputNotFound,
+			inputAt: 1,
+		},
+		{
+			name:    "duplicate input",
+			vin:     []TXInput{genesisIn, genesisIn},
+			vout:    []TXOutput{*NewTXOutput(20, testAddressUser2)},
+			kind:    ErrInputSpent,
+			inputAt: 1,
+		},
+		{
+			name:    "negative output",
+			vin:     []TXInput{genesisIn},
+			vout:    []TXOutput{*NewTXOutput(11, testAddressUser2), *NewTXOutput(-1, testAddressUser1)},
+			kind:    ErrValueOverflow,
+			inputAt: -1,
+		},
+		{
+			name:    "outputs exceed inputs",
+			vin:     []TXInput{genesisIn},
+			vout:    []TXOutput{*NewTXOutput(11, testAddressUser2)},
+			kind:    ErrOutputsExceedInputs,
+			inputAt: -1,
+		},
+		{
+			name:    "oversized",
+			vin:     []TXInput{{Txid: genesisTx.ID, OutIdx: 0, Preimage: make([]byte, MaxTxSize)}},
+			vout:    []TXOutput{*NewTXOutput(10, testAddressUser2)},
+			kind:    ErrTxOversized,
+			inputAt: -1,
+		},
+		{
+			name:    "wrong key",
+			vin:     []TXInput{genesisIn},
+			vout:    []TXOutput{*NewTXOutput(10, testAddressUser2)},
+			privKey: privKey2,
+			kind:    ErrBadSignature,
+			inputAt: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tx := &Transaction{Vin: test.vin, Vout: test.vout}
+			tx.ID = tx.Hash()
+			privKey := privKey1
+			if test.privKey != nil {
+				privKey = test.privKey
+			}
+			prevTXs := map[string]*Transaction{fmt.Sprintf("%x", genesisTx.ID): genesisTx}
+			tx.Sign(*privKey, prevTXs)
+
+			err := tx.Verify(prevTXs)
+			assert.ErrorIs(t, err, test.kind)
+			var txErr *TxValidationError
+			if assert.True(t, errors.As(err, &txErr)) {
+				assert.Equal(t, test.inputAt, txErr.Input)
+			}
+		})
+	}
+}
+
+func TestVerifyTransactionSpent(t *testing.T) {
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	tx, _ := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, bc.SignTransaction(tx, *privKey1))
+	assert.Nil(t, bc.VerifyTransaction(tx))
+
+	cbTx, _ := NewCoinbaseTX(testAddressUser1, "spent")
+	_, err = bc.MineBlock([]*Transaction{cbTx, tx})
+	assert.Nil(t, err)
+	err = bc.VerifyTransaction(tx)
+	assert.ErrorIs(t, err, ErrInputSpent)
+	assert.Equal(t, "input 0: "+ErrInputSpent.Error(), err.Error())
+
+	_, err = bc.MineBlock([]*Transaction{tx})
+	assert.ErrorIs(t, err, ErrNoValidTx, "a double spend is left out of the block")
+}
+
+func TestVerifyTransactionImmatureCoinbase(t *testing.T) {
+	params := P256ChainParams
+	params.CoinbaseMaturity = 3
+	useChainParams(t, &params)
+
+	bc, err := NewBlockchain(testAddressUser1)
+	assert.Nil(t, err)
+	privKey1, pubKey1 := decodeKeyPair(testEncPrivKeyUser1, testEncPubKeyUser1)
+	tx, _ := NewUTXOTransaction(pubKeyToByte(*pubKey1), testAddressUser2, 4, bc.FindUTXOSet())
+	assert.Nil(t, bc.SignTransaction(tx, *privKey1))
+	assert.ErrorIs(t, bc.VerifyTransaction(tx), ErrImmatureCoinbase)
+
+	for i := 0; i < 2; i++ {
+		cbTx, _ := NewCoinbaseTX(testAddressUser1, fmt.Sprintf("mature %d", i))
+		_, err = bc.MineBlock([]*Transaction{cbTx})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, bc.VerifyTransaction(tx))
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/gob"
 	"encoding/hex"
 	"log"
+	"os"
+	"path/filepath"
 )
 
 // HexSlice2ByteSlice returns a slice of hex string hashes as byte slice.
@@ -33,6 +36,38 @@ func IntToHex(num int64) []byte {
 	return buff.Bytes()
 }
 
+// writeFileAtomic writes data to a temporary file next to path, syncs it and
+// renames it to path, so a crash never leaves a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// writeGobFile atomically writes magic followed by the gob encoding of v
+func writeGobFile(path string, magic []byte, v interface{}) error {
+	var buff bytes.Buffer
+	buff.Write(magic)
+	if err := gob.NewEncoder(&buff).Encode(v); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buff.Bytes())
+}
+
 // ReverseBytes reverses a byte array
 func ReverseBytes(data []byte) {
 	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
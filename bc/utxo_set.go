@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -45,6 +46,24 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 	return UTXO
 }
 
+// FindCoins finds all UTXO in the UTXO Set that can be unlocked by the owner
+// of pubKeyHash, keeping the location of each output. The coins are ordered
+// by transaction ID and output index.
+func (u UTXOSet) FindCoins(pubKeyHash []byte) []Coin {
+	var coins []Coin
+	for id, utxo := range u {
+		for idx, out := range utxo {
+			if out.IsLockedWithKey(pubKeyHash) {
+				coins = append(coins, Coin{Txid: Hex2Bytes(id), OutIdx: idx, Output: out})
+			}
+		}
+	}
+	sort.Slice(coins, func(i, j int) bool {
+		return lessOutpoint(coins[i], coins[j])
+	})
+	return coins
+}
+
 // CountUTXOs returns the number of transactions outputs in the UTXO set
 func (u UTXOSet) CountUTXOs() int {
 	nrOfTxo := 0
@@ -69,6 +88,9 @@ func (u UTXOSet) Update(transactions []*Transaction) {
 			}
 		}
 		for idx, out := range t.Vout {
+			if out.IsDataCarrier() { // data-carrier outputs can never be spent
+				continue
+			}
 			txnOuts[idx] = out
 			u[fmt.Sprintf("%x", t.ID)] = txnOuts
 		}
@@ -9,12 +9,12 @@ import (
 
 func TestFindSpendableOutputsFromOneOutput(t *testing.T) {
 	utxos := getTestExpectedUTXOSet("block0")
-	expectedOut := utxos["9402c56f49de02d2b9c4633837d82e3881227a3ea90c4073c02815fdcf5afaa2"]
+	expectedOut := utxos["699e14b0b1a22fdbf4f6253731c8cbf8675110a22ab9aa2ee3adc0ab1ff50228"]
 	expectedValue := expectedOut[0].Value
 	pubKeyHash := expectedOut[0].PubKeyHash
 	expectedUnspentOutputs := getTestSpendableOutputs(utxos, pubKeyHash)
 
-	// Find the 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh unspent TXOutputs
+	// Find the 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug unspent TXOutputs
 	accumulatedAmount, unspentOutputs := utxos.FindSpendableOutputs(pubKeyHash, 5)
 
 	assert.Equal(t, expectedValue, accumulatedAmount)
@@ -23,13 +23,13 @@ func TestFindSpendableOutputsFromOneOutput(t *testing.T) {
 
 func TestFindSpendableOutputsFromMultipleOutputs(t *testing.T) {
 	utxos := getTestExpectedUTXOSet("block2")
-	out1 := utxos["e9e5fc159f24b2b33310f77aef4e425e77ed71be87dbf9a0c7764b5417bd3e4b"]
-	out2 := utxos["dcd76d254f7a41888e6bda9958c4ceadf510e1bd5fd251f617c91b704fbf9492"]
+	out1 := utxos["481884ecf0817fbd04f5c71e590cdf05bbc5a91b67195d76b784404162af042a"]
+	out2 := utxos["4bd72fb5e6e42ed91e988e44be2d68a324fe819176f2a22410ee9cb138c33154"]
 	expectedValue := out1[1].Value + out2[0].Value
 
 	expectedUnspentOutputs := getTestSpendableOutputs(utxos, out1[1].PubKeyHash)
 
-	// Find the 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh unspent TXOutputs
+	// Find the 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug unspent TXOutputs
 	accumulatedAmount, unspentOutputs := utxos.FindSpendableOutputs(out1[1].PubKeyHash, 5)
 
 	assert.Equal(t, expectedValue, accumulatedAmount)
@@ -37,43 +37,43 @@ func TestFindSpendableOutputsFromMultipleOutputs(t *testing.T) {
 }
 
 func TestFindUTXO(t *testing.T) {
-	// 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh create a coinbase transaction, receiving 10 "coins"
+	// 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug create a coinbase transaction, receiving 10 "coins"
 	utxos := getTestExpectedUTXOSet("block0")
 
-	rodrigoPubKeyHash := Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38")
-	leanderPubKeyHash := Hex2Bytes("b8f3e65b3cabc93fb9459b7e8182fa5ec4e58f04")
+	rodrigoPubKeyHash := Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d")
+	leanderPubKeyHash := Hex2Bytes("9b968de444fa4cc6f483a82ee1fbc6ce160a6fb3")
 
 	utxoRodrigo := utxos.FindUTXO(rodrigoPubKeyHash)
-	assert.Equal(t, []TXOutput{{BlockReward, rodrigoPubKeyHash}}, utxoRodrigo)
+	assert.Equal(t, []TXOutput{{Value: BlockReward, PubKeyHash: rodrigoPubKeyHash}}, utxoRodrigo)
 
 	utxoLeander := utxos.FindUTXO(leanderPubKeyHash)
 	assert.Equal(t, []TXOutput(nil), utxoLeander)
 
-	// 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 5 "coins" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX
+	// 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug sent 5 "coins" to 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs
 	// update utxo
 	utxos = getTestExpectedUTXOSet("block1")
 	utxoRodrigo = utxos.FindUTXO(rodrigoPubKeyHash)
-	assert.Equal(t, []TXOutput{{5, rodrigoPubKeyHash}}, utxoRodrigo)
+	assert.Equal(t, []TXOutput{{Value: 5, PubKeyHash: rodrigoPubKeyHash}}, utxoRodrigo)
 
 	utxoLeander = utxos.FindUTXO(leanderPubKeyHash)
-	assert.Equal(t, []TXOutput{{5, leanderPubKeyHash}}, utxoLeander)
+	assert.Equal(t, []TXOutput{{Value: 5, PubKeyHash: leanderPubKeyHash}}, utxoLeander)
 
-	// 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 1 "coin" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and
-	// 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX sent 3 "coins" to 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh
+	// 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug sent 1 "coin" to 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs and
+	// 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs sent 3 "coins" to 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug
 	// update utxo
 	utxos = getTestExpectedUTXOSet("block2")
 
 	utxoRodrigo = utxos.FindUTXO(rodrigoPubKeyHash)
 	assert.ElementsMatch(t, []TXOutput{
-		{4, rodrigoPubKeyHash},
-		{3, rodrigoPubKeyHash},
+		{Value: 4, PubKeyHash: rodrigoPubKeyHash},
+		{Value: 3, PubKeyHash: rodrigoPubKeyHash},
 	}, utxoRodrigo)
 	assert.Equal(t, 2, len(utxoRodrigo))
 
 	utxoLeander = utxos.FindUTXO(leanderPubKeyHash)
 	assert.ElementsMatch(t, []TXOutput{
-		{2, leanderPubKeyHash},
-		{1, leanderPubKeyHash},
+		{Value: 2, PubKeyHash: leanderPubKeyHash},
+		{Value: 1, PubKeyHash: leanderPubKeyHash},
 	}, utxoLeander)
 	assert.Equal(t, 2, len(utxoLeander))
 }
@@ -114,3 +114,19 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateIgnoresDataCarrierOutputs(t *testing.T) {
+	utxos := UTXOSet{}
+	tx := &Transaction{
+		ID:  Hex2Bytes("5c1aa4e2f6b4e0d3bd7e4f0c8b7a1e0f5c1aa4e2f6b4e0d3bd7e4f0c8b7a1e0f"),
+		Vin: testTransactions["tx1"].Vin,
+		Vout: []TXOutput{
+			{Data: []byte("document hash")},
+			{Value: 5, PubKeyHash: Hex2Bytes("1e3e360c3161daadb8e6cca3a347a9a166953a3d")},
+		},
+	}
+	utxos.Update([]*Transaction{tx})
+	assert.Equal(t, 1, utxos.CountUTXOs())
+	_, ok := utxos["5c1aa4e2f6b4e0d3bd7e4f0c8b7a1e0f5c1aa4e2f6b4e0d3bd7e4f0c8b7a1e0f"][0]
+	assert.False(t, ok, "data-carrier output must not enter the UTXO set")
+}
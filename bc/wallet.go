@@ -18,9 +18,14 @@ const (
 	addressChecksumLen = 4
 )
 
-// newKeyPair creates a new cryptographic key pair
+// newKeyPair creates a new cryptographic key pair of the active chain key type
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return newKeyPairOfType(ActiveChainParams.KeyType)
+}
+
+// newKeyPairOfType creates a new cryptographic key pair on the curve of keyType
+func newKeyPairOfType(keyType KeyType) (ecdsa.PrivateKey, []byte) {
+	pk, err := ecdsa.GenerateKey(keyType.Curve(), rand.Reader)
 	if err != nil {
 		fmt.Printf("Could not generate the ecdsa key pair!\n%v\n", err)
 		return ecdsa.PrivateKey{}, nil
@@ -29,27 +34,28 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	return *pk, pubKey
 }
 
-// pubKeyToByte converts the ecdsa.PublicKey to a concatenation of its coordinates in bytes
+// pubKeyToByte converts the ecdsa.PublicKey to its SEC1 compressed form
+// The compressed form has a fixed size, one byte with the parity of Y
+// followed by the 32 bytes of X, so no leading zeros are ever dropped
 func pubKeyToByte(pubkey ecdsa.PublicKey) []byte {
 	if pubkey.X == nil || pubkey.Y == nil {
 		return nil
 	}
-	//fmt.Printf("%v\n",elliptic.Marshal(pubkey, pubkey.X, pubkey.Y)[0])
-	var xy []byte
-	xy = append(xy, pubkey.X.Bytes()...)
-	xy = append(xy, pubkey.Y.Bytes()...)
-	return xy
-	/* ignoreFirstBit := elliptic.Marshal(pubkey, pubkey.X, pubkey.Y)[1:] // an other method used by rodrigo!?
-	return ignoreFirstBit */
+	return elliptic.MarshalCompressed(pubkey.Curve, pubkey.X, pubkey.Y)
 }
 
 // GetAddress returns address
 // https://en.bitcoin.it/wiki/Technical_background_of_version_1_Bitcoin_addresses#How_to_create_Bitcoin_Address
 func GetAddress(pubKeyBytes []byte) []byte {
+	return addressOfPubKeyHash(HashPubKey(pubKeyBytes))
+}
+
+// addressOfPubKeyHash returns the address of a public key hash, e.g. the one
+// locking an output
+func addressOfPubKeyHash(pubKeyHash []byte) []byte {
 	var versionedAddress []byte
-	address := HashPubKey(pubKeyBytes)
 	versionedAddress = append(versionedAddress, version)
-	versionedAddress = append(versionedAddress, address...)
+	versionedAddress = append(versionedAddress, pubKeyHash...)
 	csAddress := checksum(versionedAddress)
 	versionedAddress = append(versionedAddress, csAddress...)
 	BCaddress := Base58Encode(versionedAddress)
@@ -106,14 +112,24 @@ func encodeKeyPair(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (st
 }
 
 func encodePrivateKey(privateKey *ecdsa.PrivateKey) string {
-	x509Encoded, _ := x509.MarshalECPrivateKey(privateKey)
+	var x509Encoded []byte
+	if privateKey.Curve == S256() {
+		x509Encoded, _ = marshalS256PrivateKey(privateKey)
+	} else {
+		x509Encoded, _ = x509.MarshalECPrivateKey(privateKey)
+	}
 	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
 
 	return string(pemEncoded)
 }
 
 func encodePublicKey(publicKey *ecdsa.PublicKey) string {
-	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
+	var x509EncodedPub []byte
+	if publicKey.Curve == S256() {
+		x509EncodedPub, _ = marshalS256PublicKey(publicKey)
+	} else {
+		x509EncodedPub, _ = x509.MarshalPKIXPublicKey(publicKey)
+	}
 	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
 
 	return string(pemEncodedPub)
@@ -125,6 +141,9 @@ func decodeKeyPair(pemEncoded string, pemEncodedPub string) (*ecdsa.PrivateKey,
 
 func decodePrivateKey(pemEncoded string) *ecdsa.PrivateKey {
 	block, _ := pem.Decode([]byte(pemEncoded))
+	if privateKey := parseS256PrivateKey(block.Bytes); privateKey != nil {
+		return privateKey
+	}
 	privateKey, _ := x509.ParseECPrivateKey(block.Bytes)
 
 	return privateKey
@@ -132,6 +151,9 @@ func decodePrivateKey(pemEncoded string) *ecdsa.PrivateKey {
 
 func decodePublicKey(pemEncodedPub string) *ecdsa.PublicKey {
 	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
+	if publicKey := parseS256PublicKey(blockPub.Bytes); publicKey != nil {
+		return publicKey
+	}
 	genericPubKey, _ := x509.ParsePKIXPublicKey(blockPub.Bytes)
 	publicKey := genericPubKey.(*ecdsa.PublicKey) // cast to ecdsa
 
@@ -2,20 +2,21 @@ package main
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	_ "embed"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-// Keys for address: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh
+// Keys for address: 13kuoG49NDVuPgnEKWjJBXAdbi526Yxiug
 //go:embed keys/testEncPrivKeyUser1.key
 var testEncPrivKeyUser1 string
 
 //go:embed keys/testEncPubKeyUser1.pub
 var testEncPubKeyUser1 string
 
-// Keys for address: 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX
+// Keys for address: 1FBg6RnkCLTmSoTGuXqizLEgRvEXXSN4Fs
 //go:embed keys/testEncPrivKeyUser2.key
 var testEncPrivKeyUser2 string
 
@@ -149,11 +150,12 @@ func TestNewKeyPair(t *testing.T) {
 		t.Fatal("newKeyPair returned an unexpected result")
 	}
 
-	assert.Equalf(t, append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...), pubKey, "The public key should be represented as a concatenation of it's coordinates")
+	assert.Equalf(t, elliptic.MarshalCompressed(privKey.Curve, privKey.X, privKey.Y), pubKey, "The public key should be represented in SEC1 compressed form")
+	assert.Equal(t, compressedPubKeyLen, len(pubKey))
 }
 
 func TestPubKeyToByte(t *testing.T) {
 	pubkey := decodePublicKey(testEncPubKeyUser1)
 
-	assert.Equalf(t, Hex2Bytes("f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3dc19da2c9fb0ed041db106a8fea0382de25edbc83df6893574e40fc2e1e493748"), pubKeyToByte(*pubkey), "The public key should be represented as a concatenation of it's coordinates")
+	assert.Equalf(t, Hex2Bytes("02f86aa0caf08359ee4227d2901ab490172c69a801910f4140cdde2f5dc8f8bb3d"), pubKeyToByte(*pubkey), "The public key should be represented in SEC1 compressed form")
 }